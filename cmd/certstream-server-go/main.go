@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/d-Rickyy-b/certstream-server-go/internal/budget"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/certificatetransparency"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/logging"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/metrics"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/sinks"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/web"
 )
 
@@ -30,28 +38,96 @@ func main() {
 		log.Fatalln("Error while parsing yaml file:", err)
 	}
 
+	if conf.Logging.Syslog.Enabled {
+		logging.SetupSyslog(conf.Logging.Syslog)
+	}
+
 	webserver := web.NewWebsocketServer(conf.Webserver.ListenAddr, conf.Webserver.ListenPort, conf.Webserver.CertPath, conf.Webserver.CertKeyPath)
 
-	setupMetrics(conf, webserver)
+	budget.Goroutines.SetMax(conf.Limits.MaxGoroutines)
 
-	go webserver.Start()
+	fanout, sinkErr := sinks.NewFanout(conf.Sinks)
+	if sinkErr != nil {
+		log.Fatalln("Error while setting up sinks:", sinkErr)
+	}
 
 	watcher := certificatetransparency.Watcher{}
+	watcher.SetSinks(fanout)
+	metrics.SetSinks(fanout)
+	metrics.SetWatcher(&watcher)
+	webserver.RegisterStatus(conf.Webserver.StatusURL, func() any {
+		return watcher.Status()
+	})
+
+	if conf.Webserver.PositionsURL != "" {
+		webserver.RegisterStatus(conf.Webserver.PositionsURL, func() any {
+			return watcher.Positions()
+		})
+	}
+
+	if conf.Webserver.InclusionProofURL != "" {
+		webserver.RegisterInclusionProof(conf.Webserver.InclusionProofURL, func(ctx context.Context, logURL string, index int64) (any, error) {
+			return watcher.InclusionProof(ctx, logURL, index)
+		})
+	}
+
+	setupMetrics(conf, webserver, &watcher)
+
+	go webserver.Start()
+
+	// Stop the watcher on SIGINT/SIGTERM so that buffered entries can be flushed to the sinks
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		watcher.Stop()
+	}()
+
+	// Reload the log filters on SIGHUP without restarting unaffected workers
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+
+	go func() {
+		for range reloadSignals {
+			reloaded, reloadErr := config.ReloadConfig(*configFile)
+			if reloadErr != nil {
+				log.Println("Error while reloading config, keeping the current log filters:", reloadErr)
+				continue
+			}
+
+			watcher.ReloadLogFilters(reloaded.CTLogs.MinShardYear)
+		}
+	}()
+
 	watcher.Start()
+
+	// All remaining entries were handed to the broadcaster, send them to the clients before disconnecting them
+	web.ClientHandler.Drain(conf.Webserver.ShutdownDrain.Timeout, conf.Webserver.ShutdownDrain.ReconnectDelay)
+
+	if closeErr := fanout.Close(); closeErr != nil {
+		log.Println("Error while closing sinks:", closeErr)
+	}
 }
 
 // setupMetrics configures the webserver to handle prometheus metrics according to the config.
-func setupMetrics(conf config.Config, webserver *web.WebServer) {
+func setupMetrics(conf config.Config, webserver *web.WebServer, watcher *certificatetransparency.Watcher) {
+	writeSummary := func(w io.Writer) {
+		metrics.WriteSummary(w, watcher.Status())
+	}
+
 	if conf.Prometheus.Enabled {
 		// If prometheus is enabled, and interface is either unconfigured or same as webserver config, use existing webserver
 		if (conf.Prometheus.ListenAddr == "" || conf.Prometheus.ListenAddr == conf.Webserver.ListenAddr) &&
 			(conf.Prometheus.ListenPort == 0 || conf.Prometheus.ListenPort == conf.Webserver.ListenPort) {
 			log.Println("Starting prometheus server on same interface as webserver")
 			webserver.RegisterPrometheus(conf.Prometheus.MetricsURL, metrics.WritePrometheus)
+			webserver.RegisterSummary(conf.Prometheus.SummaryURL, writeSummary)
 		} else {
 			log.Println("Starting prometheus server on new interface")
 			metricsServer := web.NewMetricsServer(conf.Prometheus.ListenAddr, conf.Prometheus.ListenPort, conf.Prometheus.CertPath, conf.Prometheus.CertKeyPath)
 			metricsServer.RegisterPrometheus(conf.Prometheus.MetricsURL, metrics.WritePrometheus)
+			metricsServer.RegisterSummary(conf.Prometheus.SummaryURL, writeSummary)
 			go metricsServer.Start()
 		}
 	}
@@ -0,0 +1,49 @@
+// Package budget bounds the number of goroutines the watcher and the sinks start in total.
+package budget
+
+import "sync/atomic"
+
+// Goroutines is the budget shared by the ct workers and the sinks. It is unlimited until SetMax is called.
+var Goroutines Budget
+
+// Budget is a counter of used units with an optional maximum. It is safe for concurrent use.
+type Budget struct {
+	max  atomic.Int64
+	used atomic.Int64
+}
+
+// SetMax sets the maximum number of units. Zero or a negative value disables the limit.
+// Units that are already acquired are not affected.
+func (b *Budget) SetMax(maxUnits int) {
+	b.max.Store(int64(maxUnits))
+}
+
+// TryAcquire acquires n units if they are available within the maximum. It never blocks and returns false
+// if the budget is exhausted.
+func (b *Budget) TryAcquire(n int) bool {
+	for {
+		used := b.used.Load()
+		if maxUnits := b.max.Load(); maxUnits > 0 && used+int64(n) > maxUnits {
+			return false
+		}
+
+		if b.used.CompareAndSwap(used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+// Release returns n previously acquired units to the budget.
+func (b *Budget) Release(n int) {
+	b.used.Add(-int64(n))
+}
+
+// Used returns the number of currently acquired units.
+func (b *Budget) Used() int64 {
+	return b.used.Load()
+}
+
+// Max returns the maximum number of units or 0 if the budget is unlimited.
+func (b *Budget) Max() int64 {
+	return max(b.max.Load(), 0)
+}
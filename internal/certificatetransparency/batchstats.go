@@ -0,0 +1,54 @@
+package certificatetransparency
+
+import (
+	"context"
+	"sync/atomic"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+)
+
+// batchStats counts the get-entries requests of a worker and the number of entries requested and returned. Logs may
+// return fewer entries than requested, in which case the scanner requests the remaining entries again.
+type batchStats struct {
+	batches   atomic.Int64
+	requested atomic.Int64
+	returned  atomic.Int64
+	truncated atomic.Int64
+}
+
+// averageBatchSize returns the average number of entries returned per get-entries request.
+func (s *batchStats) averageBatchSize() float64 {
+	batches := s.batches.Load()
+	if batches == 0 {
+		return 0
+	}
+
+	return float64(s.returned.Load()) / float64(batches)
+}
+
+// batchStatsClient is the log client of the scanner that records the batch sizes in the worker's batchStats.
+type batchStatsClient struct {
+	*client.LogClient
+	stats *batchStats
+}
+
+func (c batchStatsClient) GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error) {
+	resp, err := c.LogClient.GetRawEntries(ctx, start, end)
+	if err != nil {
+		return resp, err
+	}
+
+	requested := end - start + 1
+	returned := int64(len(resp.Entries))
+
+	c.stats.batches.Add(1)
+	c.stats.requested.Add(requested)
+	c.stats.returned.Add(returned)
+
+	if returned < requested {
+		c.stats.truncated.Add(1)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,206 @@
+package certificatetransparency
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+// caOwnersByKeyID maps the hex encoded subject key identifiers of CA certificates to their CA owner. The map is
+// replaced as a whole on every ccadb refresh while the workers read it, so it must not be modified after it was stored.
+var caOwnersByKeyID atomic.Pointer[map[string]string]
+
+// lookupCAOwner returns the CA owner of the CA certificate with the given key identifier.
+func lookupCAOwner(keyID string) (string, bool) {
+	owners := caOwnersByKeyID.Load()
+	if owners == nil {
+		return "", false
+	}
+
+	owner, ok := (*owners)[keyID]
+
+	return owner, ok
+}
+
+// caOwnerCount returns the number of CA certificates with a known CA owner.
+func caOwnerCount() int {
+	owners := caOwnersByKeyID.Load()
+	if owners == nil {
+		return 0
+	}
+
+	return len(*owners)
+}
+
+// issuerRecords maps the hex encoded subject key identifiers of CA certificates to their ccadb record.
+// It is only populated if the issuer record is enabled in the config.
+var issuerRecords atomic.Pointer[map[string]certstream.CCADBRecord]
+
+// lookupIssuerRecord returns a copy of the ccadb record for the given key identifier or nil if it is unknown.
+func lookupIssuerRecord(keyID string) *certstream.CCADBRecord {
+	records := issuerRecords.Load()
+	if records == nil {
+		return nil
+	}
+
+	record, ok := (*records)[keyID]
+	if !ok {
+		return nil
+	}
+
+	return &record
+}
+
+// issuerTrustStatus derives the trust status of the issuing CA from its ccadb record: revoked if the CA certificate
+// (or its parent) is revoked, distrusted if the trust status names no root store that includes the CA and trusted
+// otherwise. Without a record or without both trust status and trust bits, the status is unknown.
+// Returns an empty string if the issuer record is disabled.
+func issuerTrustStatus(record *certstream.CCADBRecord) string {
+	if !config.AppConfig.CCADB.IssuerRecord.Enabled {
+		return ""
+	}
+
+	if record == nil {
+		return certstream.IssuerTrustUnknown
+	}
+
+	if revocation := strings.TrimSpace(record.RevocationStatus); revocation != "" && !strings.EqualFold(revocation, "Not Revoked") {
+		return certstream.IssuerTrustRevoked
+	}
+
+	if record.TrustStatus == "" {
+		if record.TrustBits == "" {
+			return certstream.IssuerTrustUnknown
+		}
+
+		return certstream.IssuerTrustTrusted
+	}
+
+	// The trust status lists the status per root store, e.g. "Apple: Included; Chrome: Included; Mozilla: Removed"
+	for _, store := range strings.Split(record.TrustStatus, ";") {
+		_, status, found := strings.Cut(store, ":")
+		if !found {
+			status = store
+		}
+
+		if strings.EqualFold(strings.TrimSpace(status), "Included") {
+			return certstream.IssuerTrustTrusted
+		}
+	}
+
+	return certstream.IssuerTrustDistrusted
+}
+
+// DownloadCCADBRecords downloads the ccadb CSV and returns the records of all CA certificates by their hex encoded
+// subject key identifier. The key and owner column are mandatory, the other columns are left empty if not found.
+func DownloadCCADBRecords(ctx context.Context, ccadbConfig config.CCADBConfig, retry RetryOptions) (map[string]certstream.CCADBRecord, error) {
+	resp, err := downloadCSV(ctx, ccadbConfig.URL, retry)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	reader := csv.NewReader(resp.Body)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV first row: %w", err)
+	}
+
+	keyColIndex, err := resolveCSVColumn(ccadbConfig.KeyColumn, header, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key column: %w", err)
+	}
+
+	ownerColIndex, err := resolveCSVColumn(ccadbConfig.ValueColumn, header, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value column: %w", err)
+	}
+
+	recordConfig := ccadbConfig.IssuerRecord
+	optionalColumn := func(column string) int {
+		index, resolveErr := resolveCSVColumn(column, header, true)
+		if resolveErr != nil {
+			log.Printf("CCADB: Ignoring issuer record column: %s\n", resolveErr)
+			return -1
+		}
+
+		return index
+	}
+	recordTypeColIndex := optionalColumn(recordConfig.RecordTypeColumn)
+	revocationColIndex := optionalColumn(recordConfig.RevocationStatusColumn)
+	trustBitsColIndex := optionalColumn(recordConfig.TrustBitsColumn)
+	auditorColIndex := optionalColumn(recordConfig.AuditorColumn)
+	trustStatusColIndex := optionalColumn(recordConfig.TrustStatusColumn)
+
+	result := make(map[string]certstream.CCADBRecord)
+
+	for {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("error reading CSV record: %w", readErr)
+		}
+
+		if keyColIndex >= len(record) || ownerColIndex >= len(record) {
+			continue
+		}
+
+		column := func(index int) string {
+			if index < 0 || index >= len(record) {
+				return ""
+			}
+
+			return record[index]
+		}
+
+		decodedBytes, _ := base64.StdEncoding.DecodeString(record[keyColIndex])
+		hexKey := strings.ToLower(hex.EncodeToString(decodedBytes))
+
+		result[hexKey] = certstream.CCADBRecord{
+			CAOwner:          record[ownerColIndex],
+			RecordType:       column(recordTypeColIndex),
+			RevocationStatus: column(revocationColIndex),
+			TrustBits:        column(trustBitsColIndex),
+			Auditor:          column(auditorColIndex),
+			TrustStatus:      column(trustStatusColIndex),
+		}
+	}
+
+	log.Printf("CCADB: Loaded %v records\n", len(result))
+
+	return result, nil
+}
+
+// loadCCADB downloads the ccadb data. It returns the CA owners by key identifier and - if the issuer record is
+// enabled - the full records, which are stored for lookupIssuerRecord.
+func loadCCADB(ctx context.Context, ccadbConfig config.CCADBConfig, retry RetryOptions) (map[string]string, error) {
+	if !ccadbConfig.IssuerRecord.Enabled {
+		return DownloadAndParseCSV(ctx, ccadbConfig.URL, ccadbConfig.KeyColumn, ccadbConfig.ValueColumn, true, retry)
+	}
+
+	records, err := DownloadCCADBRecords(ctx, ccadbConfig, retry)
+	if err != nil {
+		return nil, err
+	}
+
+	caOwners := make(map[string]string, len(records))
+	for keyID, record := range records {
+		caOwners[keyID] = record.CAOwner
+	}
+
+	issuerRecords.Store(&records)
+
+	return caOwners, nil
+}
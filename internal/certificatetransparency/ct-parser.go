@@ -16,19 +16,34 @@ import (
 	"log"
 	"math/big"
 	"net"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
 
 	psl "golang.org/x/net/publicsuffix"
 
 	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/asn1"
+	cttls "github.com/google/certificate-transparency-go/tls"
 	"github.com/google/certificate-transparency-go/x509"
 	"github.com/google/certificate-transparency-go/x509/pkix"
 )
 
+var (
+	// errConversionFailed is returned by parseData if a raw log entry could not be converted to a ct.LogEntry.
+	errConversionFailed = errors.New("could not convert raw log entry")
+	// errEmptyDER is returned by parseData (wrapped in errConversionFailed) if the entry contains no certificate data.
+	errEmptyDER = errors.New("entry contains no certificate data")
+)
+
 // JSON version of pkix.Name
 type JSONName struct {
 	CommonName         string        `json:"common_name,omitempty"`
@@ -45,27 +60,49 @@ type JSONName struct {
 
 // parseData converts a *ct.RawLogEntry struct into a certstream.Data struct by copying some values and calculating others.
 func parseData(entry *ct.RawLogEntry, operatorName, logName, ctURL string) (certstream.Data, error) {
-	certLink := fmt.Sprintf("%s/ct/v1/get-entries?start=%d&end=%d", ctURL, entry.Index, entry.Index)
+	certLink := entryLink(ctURL, entry.Index)
+	normalizedURL := normalizeCtlogURL(ctURL)
+
+	now := time.Now()
 
 	// Create main data structure
 	data := certstream.Data{
 		CertIndex: entry.Index,
 		CertLink:  certLink,
-		Seen:      float64(time.Now().UnixMilli()) / 1_000,
+		// The entry ID is unique across all logs, so it can be used as a stable primary key by consumers.
+		EntryID: fmt.Sprintf("%s:%d", normalizedURL, entry.Index),
+		Seen:    float64(now.UnixMilli()) / 1_000,
 		Source: certstream.Source{
-			Name:          logName,
-			URL:           ctURL,
-			Operator:      operatorName,
-			NormalizedURL: normalizeCtlogURL(ctURL),
+			Name:               logName,
+			URL:                ctURL,
+			Operator:           operatorName,
+			NormalizedOperator: normalizeOperatorName(operatorName),
+			NormalizedURL:      normalizedURL,
+			LogID:              getLogID(normalizedURL),
 		},
 		UpdateType: "X509LogEntry",
 	}
 
+	if config.AppConfig.Parser.SeenNanos {
+		data.SeenNanos = monotonicNanos(now)
+	}
+
+	// Without the DER, as_der and the fingerprints would silently be empty - e.g. for precertificates, whose TBS is
+	// taken from the leaf and can be parsed anyway.
+	if len(entry.Cert.Data) == 0 {
+		log.Printf("Entry %d of '%s' contains no certificate data\n", entry.Index, ctURL)
+		atomic.AddInt64(&emptyDERs, 1)
+
+		return data, fmt.Errorf("%w: %w", errConversionFailed, errEmptyDER)
+	}
+
 	// Convert RawLogEntry to ct.LogEntry
 	logEntry, conversionErr := entry.ToLogEntry()
 	if conversionErr != nil {
-		log.Println("Could not convert entry to LogEntry: ", conversionErr)
-		return certstream.Data{}, conversionErr
+		log.Printf("Could not convert entry %d of '%s' to LogEntry: %s\n", entry.Index, ctURL, conversionErr)
+		conversionFailures.Inc(operatorName, normalizedURL)
+
+		return data, fmt.Errorf("%w: %w", errConversionFailed, conversionErr)
 	}
 
 	var cert *x509.Certificate
@@ -96,35 +133,156 @@ func parseData(entry *ct.RawLogEntry, operatorName, logName, ctURL string) (cert
 		data.LeafCert.SHA256 = calculateSHA256(rawData)
 	}
 
+	if config.AppConfig.Processing.TBSConsistency.Enabled || config.AppConfig.Parser.LinkageID {
+		data.LeafCert.TBSDigest = normalizedTBSDigest(cert, isPrecert)
+	}
+
+	if config.AppConfig.Parser.LinkageID {
+		data.LinkageID = data.LeafCert.TBSDigest
+	}
+
+	if config.AppConfig.Parser.TBSHashes {
+		tbs := normalizedTBS(cert, isPrecert)
+		data.LeafCert.TBSSHA1 = calculateSHA1(tbs)
+		data.LeafCert.TBSSHA256 = calculateSHA256(tbs)
+	}
+
+	// Precertificates can't contain SCTs yet, so only final certificates are flagged
+	if minSCTCount := config.AppConfig.Parser.MinSCTCount; !isPrecert && minSCTCount > 0 {
+		data.LeafCert.LowSCTCount = data.LeafCert.CertTypeExt.SCTCount < minSCTCount
+	}
+
 	certAsDER := base64.StdEncoding.EncodeToString(entry.Cert.Data)
 	data.LeafCert.AsDER = certAsDER
 
 	var parseErr error
-	data.Chain, parseErr = parseCertificateChain(logEntry)
+	var chainCerts []*x509.Certificate
+	data.Chain, chainCerts, parseErr = parseCertificateChain(logEntry)
 	if parseErr != nil {
 		log.Println("Could not parse certificate chain: ", parseErr)
 		return certstream.Data{}, parseErr
 	}
 
+	var topCert *x509.Certificate
+	if len(chainCerts) > 0 {
+		topCert = chainCerts[len(chainCerts)-1]
+	}
+
+	if isPrecert && len(chainCerts) > 0 && isPrecertSigningCert(chainCerts[0]) {
+		attributeToPrecertIssuer(&data.LeafCert, chainCerts[0])
+	}
+
+	data.LeafCert.RootCAOwner, data.LeafCert.ChainIncomplete = rootCAOwner(topCert)
+	data.LeafCert.WatchedKeyIDs = matchWatchedKeyIDs(cert, chainCerts)
+	data.LeafCert.RevokedSerial = isRevokedSerial(&data)
+
+	if config.AppConfig.Parser.IncludeSizes {
+		// For precertificates, this is the size of the submitted precertificate
+		data.LeafCert.DERSize = len(entry.Cert.Data)
+		for _, chainEntry := range logEntry.Chain {
+			data.LeafCert.ChainSize += len(chainEntry.Data)
+		}
+	}
+
 	return data, nil
 }
 
-// parseCertificateChain returns the certificate chain in form of a []LeafCert from the given *ct.LogEntry.
-func parseCertificateChain(logEntry *ct.LogEntry) ([]certstream.LeafCert, error) {
+// parseCertificateChain returns the certificate chain in form of a []LeafCert from the given *ct.LogEntry
+// as well as the parsed certificates of the chain in the same order.
+func parseCertificateChain(logEntry *ct.LogEntry) ([]certstream.LeafCert, []*x509.Certificate, error) {
 	chain := make([]certstream.LeafCert, len(logEntry.Chain))
+	chainCerts := make([]*x509.Certificate, len(logEntry.Chain))
 
 	for i, chainEntry := range logEntry.Chain {
 		myCert, parseErr := x509.ParseCertificate(chainEntry.Data)
 		if parseErr != nil {
 			log.Println("Error parsing certificate: ", parseErr)
-			return nil, parseErr
+			return nil, nil, parseErr
 		}
 
 		leafCert := leafCertFromX509cert(*myCert)
 		chain[i] = leafCert
+		chainCerts[i] = myCert
 	}
 
-	return chain, nil
+	return chain, chainCerts, nil
+}
+
+// watchedKeyIDs returns the set of the configured watched key identifiers.
+var watchedKeyIDs = sync.OnceValue(func() map[string]bool {
+	keyIDs := make(map[string]bool, len(config.AppConfig.Parser.WatchedKeyIDs))
+	for _, keyID := range config.AppConfig.Parser.WatchedKeyIDs {
+		keyIDs[keyID] = true
+	}
+
+	return keyIDs
+})
+
+// matchWatchedKeyIDs returns the watched key identifiers that match the authority key identifier of the certificate
+// or the subject key identifier of any certificate of its chain. Returns nil if none matches.
+func matchWatchedKeyIDs(cert *x509.Certificate, chainCerts []*x509.Certificate) []string {
+	watched := watchedKeyIDs()
+	if len(watched) == 0 {
+		return nil
+	}
+
+	var matches []string
+	addMatch := func(keyID []byte) {
+		if len(keyID) == 0 {
+			return
+		}
+
+		formatted := *formatKeyIDShort(keyID)
+		if watched[formatted] && !slices.Contains(matches, formatted) {
+			matches = append(matches, formatted)
+		}
+	}
+
+	addMatch(cert.AuthorityKeyId)
+	for _, chainCert := range chainCerts {
+		addMatch(chainCert.SubjectKeyId)
+	}
+
+	return matches
+}
+
+// rootCAOwner resolves the CA owner of the root certificate at the top of the chain by its subject key identifier.
+// If the top of the chain is not a self-signed root (or the chain is empty), the chain is incomplete and no owner is
+// returned. The owner is also nil if the root is not known in the ccadb data.
+func rootCAOwner(topCert *x509.Certificate) (owner *string, chainIncomplete bool) {
+	if topCert == nil || !bytes.Equal(topCert.RawSubject, topCert.RawIssuer) {
+		return nil, true
+	}
+
+	rootOwner, ok := lookupCAOwner(*formatKeyIDShort(topCert.SubjectKeyId))
+	if !ok || len(topCert.SubjectKeyId) == 0 {
+		return nil, false
+	}
+
+	return &rootOwner, false
+}
+
+// isPrecertSigningCert checks if the certificate is a precertificate signing certificate (RFC 6962, 3.1), which
+// signs precertificates on behalf of a CA and is marked by the certificate transparency extended key usage.
+func isPrecertSigningCert(cert *x509.Certificate) bool {
+	return slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageCertificateTransparency)
+}
+
+// attributeToPrecertIssuer attributes a precertificate signed by the given precertificate signing certificate to the
+// CA that issued the signing certificate. This CA also issues the final certificate, so issuer, CA owner and issuer
+// record match the ones of the final certificate.
+func attributeToPrecertIssuer(leafCert *certstream.LeafCert, signingCert *x509.Certificate) {
+	leafCert.PrecertSigningCert = true
+	leafCert.Issuer = buildSubject(signingCert.Issuer)
+
+	issuerKeyID := *formatKeyIDShort(signingCert.AuthorityKeyId)
+	if owner, ok := lookupCAOwner(issuerKeyID); ok {
+		leafCert.CAOwner = owner
+	} else {
+		leafCert.CAOwner = "unknown"
+	}
+	leafCert.IssuerRecord = lookupIssuerRecord(issuerKeyID)
+	leafCert.IssuerTrust = issuerTrustStatus(leafCert.IssuerRecord)
 }
 
 // Parse Go's pkix.Name into a JSON
@@ -148,6 +306,19 @@ func ParseNameJSON(name pkix.Name) JSONName {
 	return n
 }
 
+// ParseLeafCert parses a DER encoded certificate into the LeafCert data structure that is sent to clients.
+// It applies the same heuristics (validation type, cert type, key type, extensions) as the CT log workers and is the
+// entry point to check the parser output for known certificates. Non-fatal parsing errors are ignored, as they are for log entries.
+// Precertificate specifics (like the recalculated fingerprint) are not applied.
+func ParseLeafCert(der []byte) (certstream.LeafCert, error) {
+	cert, err := x509.ParseCertificate(der)
+	if x509.IsFatal(err) {
+		return certstream.LeafCert{}, fmt.Errorf("could not parse certificate: %w", err)
+	}
+
+	return leafCertFromX509cert(*cert), nil
+}
+
 // leafCertFromX509cert converts a x509.Certificate to the custom LeafCert data structure.
 func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 	leafCert := certstream.LeafCert{
@@ -161,31 +332,43 @@ func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 		IsCA:               cert.IsCA,
 	}
 
+	if config.AppConfig.Parser.ISOTimestamps {
+		leafCert.NotAfterISO = cert.NotAfter.UTC().Format(time.RFC3339)
+		leafCert.NotBeforeISO = cert.NotBefore.UTC().Format(time.RFC3339)
+	}
+
 	// The zero value of DomainsEntry.Data is nil, but we want an empty array - especially for json marshalling later.
 	if leafCert.AllDomains == nil {
 		leafCert.AllDomains = []string{}
 	}
 
+	// Email SANs are kept separately and never end up in the domain or registrable domain fields.
+	emailAddresses := cert.EmailAddresses
+	if config.AppConfig.Parser.RedactEmailAddresses {
+		emailAddresses = redactEmailAddresses(emailAddresses)
+	}
+	leafCert.EmailAddresses = emailAddresses
+
 	leafCert.Subject = buildSubject(cert.Subject)
 	wildcardCount := 0
 	regDomainSlice := []string{}
 	if *leafCert.Subject.CN != "" && !leafCert.IsCA {
 		domainAlreadyAdded := false
-		// TODO check if CN matches domain regex
 		for _, domain := range leafCert.AllDomains {
-			//	Check for wildcards
+			//	Check for wildcards. Only a wildcard as the complete leftmost label is compliant.
 			if strings.Contains(domain, "*") {
-				wildcardCount++
-			}
-			//	Extract 'registerable domain' or 'effective domain plus one' from each SAN
-			isIP := net.ParseIP(domain)
-			if isIP == nil {
-				regDomain, err := psl.EffectiveTLDPlusOne(domain)
-				if err != nil {
-					regDomainSlice = append(regDomainSlice, domain)
+				if isCompliantWildcard(domain) {
+					wildcardCount++
 				} else {
-					regDomainSlice = append(regDomainSlice, regDomain)
+					leafCert.MalformedWildcard = true
 				}
+			}
+			// Special-use names (e.g. .onion) are kept out of the registrable domains, the PSL doesn't handle them properly
+			if isSpecialUseName(domain) {
+				leafCert.SpecialUseNames = append(leafCert.SpecialUseNames, domain)
+			} else if isIP := net.ParseIP(domain); isIP == nil {
+				//	Extract 'registerable domain' or 'effective domain plus one' from each SAN
+				regDomainSlice = append(regDomainSlice, registrableDomain(domain))
 			} else {
 				regDomainSlice = append(regDomainSlice, domain)
 			}
@@ -196,14 +379,21 @@ func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 			}
 		}
 
-		if !domainAlreadyAdded {
+		// CNs are often arbitrary text (e.g. "My Org CA"), so only hostnames and IP addresses are added to the domains.
+		if !domainAlreadyAdded && isHostnameOrIP(*leafCert.Subject.CN) {
+			leafCert.CNNotInSAN = true
 			leafCert.AllDomains = append(leafCert.AllDomains, *leafCert.Subject.CN)
 		}
 	}
 
 	leafCert.Issuer = buildSubject(cert.Issuer)
 
+	leafCert.WeakCrypto, leafCert.WeakCryptoReason = detectWeakCrypto(leafCert.SignatureAlgorithm, leafCert.KeyType)
+
 	leafCert.AsDER = base64.StdEncoding.EncodeToString(cert.Raw)
+	if config.AppConfig.Parser.IncludeSizes {
+		leafCert.DERSize = len(cert.Raw)
+	}
 	leafCert.Fingerprint = calculateSHA1(cert.Raw)
 	leafCert.SHA1 = leafCert.Fingerprint
 	leafCert.SHA256 = calculateSHA256(cert.Raw)
@@ -221,13 +411,14 @@ func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 		case extension.Id.Equal(x509.OIDExtensionBasicConstraints):
 			isCA := strings.ToUpper(fmt.Sprintf("CA:%t", cert.IsCA))
 			leafCert.Extensions.BasicConstraints = &isCA
+			leafCert.Extensions.BasicConstraintsPathLen = basicConstraintsPathLen(&cert)
 		case extension.Id.Equal(x509.OIDExtensionSubjectAltName):
 			var buf bytes.Buffer
 			for _, name := range cert.DNSNames {
 				commaAppend(&buf, "DNS:"+name)
 			}
 
-			for _, email := range cert.EmailAddresses {
+			for _, email := range emailAddresses {
 				commaAppend(&buf, "email:"+email)
 			}
 
@@ -249,33 +440,56 @@ func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 
 			result := buf.String()
 			leafCert.Extensions.AuthorityInfoAccess = &result
+		case extension.Id.Equal(x509.OIDExtensionCRLDistributionPoints):
+			if len(cert.CRLDistributionPoints) == 0 {
+				continue
+			}
+
+			var buf bytes.Buffer
+			for _, crl := range cert.CRLDistributionPoints {
+				commaAppend(&buf, "URI:"+crl)
+			}
+
+			result := buf.String()
+			leafCert.Extensions.CRLDistributionPoints = &result
+		case extension.Id.Equal(x509.OIDExtensionCertificatePolicies):
+			for _, policy := range cert.PolicyIdentifiers {
+				leafCert.Extensions.CertificatePolicies = append(leafCert.Extensions.CertificatePolicies, policy.String())
+			}
 		case extension.Id.Equal(x509.OIDExtensionCTPoison):
 			leafCert.Extensions.CTLPoisonByte = true
+		case extension.Id.Equal(oidExtensionSubjectDirectoryAttributes):
+			// Contains personal data like the date of birth, so it's only decoded if enabled
+			if config.AppConfig.Parser.SubjectDirectoryAttributes {
+				leafCert.Extensions.SubjectDirectoryAttributes = parseSubjectDirectoryAttributes(extension.Value)
+			}
 		}
 	}
 
+	if config.AppConfig.Parser.ExtensionsMap {
+		leafCert.ExtensionsMap = buildExtensionsMap(&cert, &leafCert.Extensions)
+	}
+
 	//	Certificate validation type determination
 	//	Try some of the policy OIDs that some CAs add
+	//	ValidationTypeSource records which of the checks below decided the validation type
 	leafCert.ValidationType = "OV"
-	PolicyOIDSString := fmt.Sprintf("%d", cert.PolicyIdentifiers)
-	if strings.Contains(PolicyOIDSString, "2.23.140.1.2.1") {
-		leafCert.ValidationType = "DV"
-	} else if strings.Contains(PolicyOIDSString, "2.23.140.1.2.2") {
-		leafCert.ValidationType = "OV"
-	} else if strings.Contains(PolicyOIDSString, "2.23.140.1.2.3") {
-		leafCert.ValidationType = "IV"
-	} else if strings.Contains(PolicyOIDSString, "2.23.140.1.1") {
-		leafCert.ValidationType = "EV"
+	leafCert.ValidationTypeSource = "default"
+	if validationType := policyValidationType(cert.PolicyIdentifiers); validationType != "" {
+		leafCert.ValidationType = validationType
+		leafCert.ValidationTypeSource = "policy_oid"
 	}
 	//	Now some basic checks
 	//	No Subject O - it's a DV
 	if leafCert.Subject.O == nil {
 		leafCert.ValidationType = "DV"
+		leafCert.ValidationTypeSource = "no_org_heuristic"
 	}
 
 	//	There's a 'jurisdictionC' in the Subject, so it's an EV
-	if strings.Contains(*leafCert.Subject.Aggregated, "1.3.6.1.4.1.311.60.2.1.3") {
+	if hasNameAttribute(cert.Subject, oidJurisdictionCountry) {
 		leafCert.ValidationType = "EV"
+		leafCert.ValidationTypeSource = "jurisdiction"
 	}
 
 	//	Certificate 'type' determination and SAN/domain information - already checked for wildcards above
@@ -292,6 +506,7 @@ func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 	leafCert.CertTypeExt.SANCount = len(leafCert.AllDomains)
 	leafCert.CertTypeExt.WildcardSANCount = wildcardCount
 	leafCert.CertTypeExt.SingleSANCount = leafCert.CertTypeExt.SANCount - leafCert.CertTypeExt.WildcardSANCount
+	leafCert.CertTypeExt.SCTCount = len(cert.SCTList.SCTList)
 
 	// De-duplicate the reg-domain slice
 	seenRegDomain := map[string]bool{}
@@ -303,28 +518,129 @@ func leafCertFromX509cert(cert x509.Certificate) certstream.LeafCert {
 		}
 	}
 	leafCert.AllRegDomains = regDomainResult
+	leafCert.DistinctRegDomainCount = len(regDomainResult)
+	leafCert.MultiOrgSpan = leafCert.DistinctRegDomainCount > config.AppConfig.Parser.MultiOrgThreshold
 
 	//	CA owner from the periodically-updated Owner map
 	leafAKI := *formatKeyIDShort(cert.AuthorityKeyId)
-	caOwnerCheck, ok := CAOwners[leafAKI]
+	caOwnerCheck, ok := lookupCAOwner(leafAKI)
 	if ok {
 		leafCert.CAOwner = caOwnerCheck
 	} else {
 		leafCert.CAOwner = "unknown"
 	}
+	leafCert.IssuerRecord = lookupIssuerRecord(leafAKI)
+	leafCert.IssuerTrust = issuerTrustStatus(leafCert.IssuerRecord)
 
 	return leafCert
 }
 
+// lastSeenNanos is the last timestamp returned by monotonicNanos.
+var lastSeenNanos atomic.Int64
+
+// monotonicNanos returns the given time in nanoseconds since the epoch. The returned values are strictly increasing
+// across all workers, even if the wall clock jumps backwards or two entries are seen within the same nanosecond.
+func monotonicNanos(now time.Time) int64 {
+	nanos := now.UnixNano()
+
+	for {
+		last := lastSeenNanos.Load()
+		next := max(nanos, last+1)
+
+		if lastSeenNanos.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
+
+// registrableDomain returns the 'registerable domain' or 'effective domain plus one' of the given domain.
+// If it can't be determined, the domain itself is returned. Domains that can't be valid hostnames are not
+// passed to the public suffix list at all and panics during the computation are recovered, so that a single
+// malformed certificate can't crash the worker.
+func registrableDomain(domain string) (regDomain string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while extracting registrable domain from %.100q: %v\n", domain, r)
+			atomic.AddInt64(&regDomainFallbacks, 1)
+			regDomain = domain
+		}
+	}()
+
+	if !isPlausibleDomain(domain) {
+		atomic.AddInt64(&regDomainFallbacks, 1)
+		return domain
+	}
+
+	regDomain, err := psl.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+
+	return regDomain
+}
+
+// isPlausibleDomain checks the length limits of a domain name (253 characters overall, 63 characters per label)
+// and makes sure that it doesn't contain empty labels.
+func isPlausibleDomain(domain string) bool {
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hostnameRegex matches hostnames with an optional leading wildcard label, e.g. "example.com" or "*.example.com".
+var hostnameRegex = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9_])?\.)+[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.?$`)
+
+// isCompliantWildcard checks if the wildcard in the given domain is the complete leftmost label and the only one,
+// e.g. "*.example.com". Wildcards in other labels ("a.*.example.com"), multiple wildcards ("*.*.example.com") and
+// partial labels ("f*.example.com") are malformed.
+func isCompliantWildcard(domain string) bool {
+	rest, ok := strings.CutPrefix(domain, "*.")
+
+	return ok && rest != "" && !strings.Contains(rest, "*")
+}
+
+// isSpecialUseName checks if the given domain is or ends with one of the configured special-use suffixes.
+func isSpecialUseName(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, suffix := range config.AppConfig.Parser.SpecialUseSuffixes {
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHostnameOrIP checks if the given value looks like a hostname with at least two labels or is an IP address.
+func isHostnameOrIP(value string) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+
+	return isPlausibleDomain(strings.TrimSuffix(value, ".")) && hostnameRegex.MatchString(value)
+}
+
 // buildSubject generates a Subject struct from the given pkix.Name.
+// Invalid UTF-8 in the name is replaced, so the fields and the aggregated JSON are always valid.
 func buildSubject(certSubject pkix.Name) certstream.Subject {
+	certSubject, sanitized := sanitizeName(certSubject)
+
 	subject := certstream.Subject{
-		C:  parseName(certSubject.Country),
-		CN: &certSubject.CommonName,
-		L:  parseName(certSubject.Locality),
-		O:  parseName(certSubject.Organization),
-		OU: parseName(certSubject.OrganizationalUnit),
-		ST: parseName(certSubject.StreetAddress),
+		Sanitized: sanitized,
+		C:         parseName(certSubject.Country),
+		CN:        &certSubject.CommonName,
+		L:         parseName(certSubject.Locality),
+		O:         parseName(certSubject.Organization),
+		OU:        parseName(certSubject.OrganizationalUnit),
+		ST:        parseName(certSubject.StreetAddress),
 	}
 	/*
 		if subject.C != nil {
@@ -351,13 +667,142 @@ func buildSubject(certSubject pkix.Name) certstream.Subject {
 			aggregated += fmt.Sprintf("/ST=%s", *subject.ST)
 		}
 	*/
-	aggregatedJSON, _ := json.Marshal(ParseNameJSON(certSubject))
-	jsonSubject := string(aggregatedJSON)
+	var jsonSubject string
+	if config.AppConfig.Parser.NormalizeAggregated {
+		jsonSubject = normalizedNameJSON(certSubject)
+	} else {
+		aggregatedJSON, _ := json.Marshal(ParseNameJSON(certSubject))
+		jsonSubject = string(aggregatedJSON)
+	}
+
 	subject.Aggregated = &jsonSubject
 
 	return subject
 }
 
+// sanitizeName returns a copy of the name with invalid UTF-8 sequences in its string attributes replaced by U+FFFD
+// and whether any attribute had to be sanitized. The slices of the name are shared with the certificate, so they
+// are only copied if an element has to be replaced.
+func sanitizeName(name pkix.Name) (pkix.Name, bool) {
+	sanitized := false
+
+	sanitizeString := func(value string) string {
+		if utf8.ValidString(value) {
+			return value
+		}
+
+		sanitized = true
+
+		return strings.ToValidUTF8(value, string(utf8.RuneError))
+	}
+
+	sanitizeStrings := func(values []string) []string {
+		if !slices.ContainsFunc(values, func(value string) bool { return !utf8.ValidString(value) }) {
+			return values
+		}
+
+		result := make([]string, len(values))
+		for i, value := range values {
+			result[i] = sanitizeString(value)
+		}
+
+		return result
+	}
+
+	sanitizeAttributes := func(attributes []pkix.AttributeTypeAndValue) []pkix.AttributeTypeAndValue {
+		isInvalid := func(attribute pkix.AttributeTypeAndValue) bool {
+			value, isString := attribute.Value.(string)
+			return isString && !utf8.ValidString(value)
+		}
+		if !slices.ContainsFunc(attributes, isInvalid) {
+			return attributes
+		}
+
+		result := slices.Clone(attributes)
+		for i := range result {
+			if value, isString := result[i].Value.(string); isString {
+				result[i].Value = sanitizeString(value)
+			}
+		}
+
+		return result
+	}
+
+	name.CommonName = sanitizeString(name.CommonName)
+	name.SerialNumber = sanitizeString(name.SerialNumber)
+	name.Country = sanitizeStrings(name.Country)
+	name.Organization = sanitizeStrings(name.Organization)
+	name.OrganizationalUnit = sanitizeStrings(name.OrganizationalUnit)
+	name.Locality = sanitizeStrings(name.Locality)
+	name.Province = sanitizeStrings(name.Province)
+	name.StreetAddress = sanitizeStrings(name.StreetAddress)
+	name.PostalCode = sanitizeStrings(name.PostalCode)
+	name.Names = sanitizeAttributes(name.Names)
+	name.ExtraNames = sanitizeAttributes(name.ExtraNames)
+
+	return name, sanitized
+}
+
+// JSONNameAttribute is a single attribute of a distinguished name in the normalized aggregated representation.
+type JSONNameAttribute struct {
+	// Type is the OID of the attribute in dotted notation, e.g. "2.5.4.3" for the common name.
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// normalizedNameJSON returns the deterministic aggregated representation of the name: the fields of JSONName with
+// their keys sorted, empty fields omitted and no HTML escaping. Instead of the bare values, "names" lists the
+// attributes in the order of the RDN sequence with their type and value as string.
+func normalizedNameJSON(name pkix.Name) string {
+	jsonName := ParseNameJSON(name)
+
+	jsonName.Names = nil
+	for _, attribute := range name.Names {
+		jsonName.Names = append(jsonName.Names, JSONNameAttribute{Type: attribute.Type.String(), Value: fmt.Sprint(attribute.Value)})
+	}
+
+	aggregatedJSON, _ := json.Marshal(jsonName)
+
+	return string(certstream.CanonicalJSON(aggregatedJSON))
+}
+
+// validationTypePolicies are the CA/Browser Forum policy OIDs stating the validation type, in the order they are checked.
+var validationTypePolicies = []struct {
+	oid            asn1.ObjectIdentifier
+	validationType string
+}{
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, "DV"},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}, "OV"},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 3}, "IV"},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 1}, "EV"},
+}
+
+// policyValidationType returns the validation type stated by the policy OIDs of the certificate or an empty string
+// if none of the CA/Browser Forum policies is present. OIDs have to match exactly, so e.g. 2.23.140.1.2.10 is no DV policy.
+func policyValidationType(policies []asn1.ObjectIdentifier) string {
+	for _, policy := range validationTypePolicies {
+		if slices.ContainsFunc(policies, policy.oid.Equal) {
+			return policy.validationType
+		}
+	}
+
+	return ""
+}
+
+// oidJurisdictionCountry is the jurisdictionCountryName attribute of the subject of EV certificates.
+var oidJurisdictionCountry = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 60, 2, 1, 3}
+
+// hasNameAttribute checks if the name contains an attribute of the given type.
+func hasNameAttribute(name pkix.Name, oid asn1.ObjectIdentifier) bool {
+	for _, attribute := range name.Names {
+		if attribute.Type.Equal(oid) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // formatKeyID transforms the AuthorityKeyIdentifier to be more readable.
 func formatKeyID(keyID []byte) *string {
 	tmp := hex.EncodeToString(keyID)
@@ -407,6 +852,25 @@ func parseName(input []string) *string {
 	return &result
 }
 
+// redactEmailAddresses returns a copy of the given email addresses with their local part replaced by '*'.
+// The domain is kept, so S/MIME monitoring per domain is still possible.
+func redactEmailAddresses(emailAddresses []string) []string {
+	if len(emailAddresses) == 0 {
+		return emailAddresses
+	}
+
+	redacted := make([]string, len(emailAddresses))
+	for i, email := range emailAddresses {
+		if at := strings.LastIndexByte(email, '@'); at >= 0 {
+			redacted[i] = "*" + email[at:]
+		} else {
+			redacted[i] = "*"
+		}
+	}
+
+	return redacted
+}
+
 // calculateHash takes a hash.Hash struct and calculates the fingerprint of the given data.
 func calculateHash(data []byte, certHasher hash.Hash) string {
 	_, e := certHasher.Write(data)
@@ -415,19 +879,29 @@ func calculateHash(data []byte, certHasher hash.Hash) string {
 		return ""
 	}
 
-	certHash := fmt.Sprintf("%02x", certHasher.Sum(nil))
-	certHash = strings.ToUpper(certHash)
+	return formatFingerprint(certHasher.Sum(nil))
+}
+
+// formatFingerprint formats the given digest as uppercase hex bytes separated by colons (e.g. "AB:CD:EF").
+// The result is written into a single preallocated slice since this runs several times for every certificate.
+func formatFingerprint(digest []byte) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	if len(digest) == 0 {
+		return ""
+	}
 
-	var result bytes.Buffer
-	for i := 0; i < len(certHash); i++ {
-		if i%2 == 0 && i > 0 {
-			result.WriteByte(':')
+	result := make([]byte, len(digest)*3-1)
+	for i, b := range digest {
+		pos := i * 3
+		if i > 0 {
+			result[pos-1] = ':'
 		}
-		c := certHash[i]
-		result.WriteByte(c)
+		result[pos] = hexDigits[b>>4]
+		result[pos+1] = hexDigits[b&0x0f]
 	}
 
-	return result.String()
+	return string(result)
 }
 
 // calculateSHA1 calculates the SHA1 fingerprint of the given data.
@@ -465,8 +939,8 @@ func parseKeyType(keyAlg x509.PublicKeyAlgorithm, rawKey []byte) string {
 		ecdsaKey, err := x509.ParsePKIXPublicKey(rawKey)
 		if err == nil {
 			ecdsaPub := ecdsaKey.(*ecdsa.PublicKey)
-			KeySize := ecdsaPub.X
-			keySizeBits := strconv.Itoa(KeySize.BitLen())
+			// The bit length of the public point can be smaller than the curve size, so use the size of the curve
+			keySizeBits := strconv.Itoa(ecdsaPub.Curve.Params().BitSize)
 			return "ECDSA" + keySizeBits
 		}
 	default:
@@ -516,6 +990,45 @@ func parseSignatureAlgorithm(signatureAlgoritm x509.SignatureAlgorithm) string {
 	}
 }
 
+// detectWeakCrypto checks the parsed signature algorithm and key type (e.g. "SHA1WithRSA" and "RSA1024") against the
+// configured thresholds. It returns whether the certificate uses weak crypto and the reasons for it.
+func detectWeakCrypto(signatureAlgorithm, keyType string) (weak bool, reason string) {
+	weakCryptoConfig := config.AppConfig.Parser.WeakCrypto
+
+	var reasons []string
+
+	for _, weakAlgorithm := range weakCryptoConfig.SignatureAlgorithms {
+		if weakAlgorithm != "" && strings.Contains(strings.ToUpper(signatureAlgorithm), strings.ToUpper(weakAlgorithm)) {
+			reasons = append(reasons, "weak signature algorithm "+signatureAlgorithm)
+			break
+		}
+	}
+
+	minBits := map[string]int{
+		"RSA":   weakCryptoConfig.MinRSABits,
+		"ECDSA": weakCryptoConfig.MinECDSABits,
+		"DSA":   weakCryptoConfig.MinDSABits,
+	}
+
+	for algorithm, minKeyBits := range minBits {
+		bitsString, ok := strings.CutPrefix(keyType, algorithm)
+		if !ok {
+			continue
+		}
+
+		bits, err := strconv.Atoi(bitsString)
+		if err != nil {
+			continue
+		}
+
+		if bits < minKeyBits {
+			reasons = append(reasons, fmt.Sprintf("%s key with %d bits (minimum %d)", algorithm, bits, minKeyBits))
+		}
+	}
+
+	return len(reasons) > 0, strings.Join(reasons, ", ")
+}
+
 // commaAppend lets you append a string with a comma prepended to a buffer.
 func commaAppend(buf *bytes.Buffer, s string) {
 	if buf.Len() > 0 {
@@ -566,6 +1079,18 @@ func keyUsageToString(k x509.KeyUsage) string {
 	return buf.String()
 }
 
+// basicConstraintsPathLen returns the pathLenConstraint of the basic constraints of a CA certificate or nil if the
+// certificate has no path length constraint. A MaxPathLen of 0 only is a constraint if MaxPathLenZero is set.
+func basicConstraintsPathLen(cert *x509.Certificate) *int {
+	if !cert.IsCA || cert.MaxPathLen < 0 || (cert.MaxPathLen == 0 && !cert.MaxPathLenZero) {
+		return nil
+	}
+
+	pathLen := cert.MaxPathLen
+
+	return &pathLen
+}
+
 // parseCertstreamEntry creates an Entry from a ct.RawLogEntry.
 func parseCertstreamEntry(rawEntry *ct.RawLogEntry, operatorName, logname, ctURL string) (certstream.Entry, error) {
 	if rawEntry == nil {
@@ -573,6 +1098,19 @@ func parseCertstreamEntry(rawEntry *ct.RawLogEntry, operatorName, logname, ctURL
 	}
 
 	data, err := parseData(rawEntry, operatorName, logname, ctURL)
+	if errors.Is(err, errConversionFailed) && config.AppConfig.CTLogs.EmitDegradedEntries {
+		// Let consumers know that there is an entry at this index, even though it could not be parsed
+		data.Raw = &certstream.RawEntry{
+			Cert: base64.StdEncoding.EncodeToString(rawEntry.Cert.Data),
+		}
+
+		if leafInput, marshalErr := cttls.Marshal(rawEntry.Leaf); marshalErr == nil {
+			data.Raw.LeafInput = base64.StdEncoding.EncodeToString(leafInput)
+		}
+
+		return certstream.Entry{Data: data, MessageType: "degraded_entry"}, nil
+	}
+
 	if err != nil {
 		return certstream.Entry{}, err
 	}
@@ -0,0 +1,677 @@
+package certificatetransparency
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/asn1"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+)
+
+// The fixtures in testdata are created by testdata/generate.go. All of them are issued by the same test CA with an
+// ECDSA P-256 key and valid from 2024-01-01 to 2024-04-01.
+const (
+	fixtureNotBefore = 1704067200
+	fixtureNotAfter  = 1711929600
+)
+
+// parseFixture parses the DER encoded certificate testdata/<name>.der with ParseLeafCert.
+func parseFixture(t *testing.T, name string) certstream.LeafCert {
+	t.Helper()
+
+	der, err := os.ReadFile(filepath.Join("testdata", name+".der"))
+	if err != nil {
+		t.Fatalf("could not read fixture: %s", err)
+	}
+
+	leafCert, err := ParseLeafCert(der)
+	if err != nil {
+		t.Fatalf("could not parse fixture: %s", err)
+	}
+
+	return leafCert
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+// stringValue dereferences the optional string fields of the LeafCert, nil being returned as "<nil>".
+func stringValue(value *string) string {
+	if value == nil {
+		return "<nil>"
+	}
+
+	return *value
+}
+
+func TestParseLeafCert(t *testing.T) {
+	tests := []struct {
+		fixture              string
+		allDomains           []string
+		allRegDomains        []string
+		subjectAltName       string
+		certificatePolicies  []string
+		serialNumber         string
+		keyType              string
+		signatureAlgorithm   string
+		certType             string
+		certTypeExt          certstream.CertTypeExt
+		malformedWildcard    bool
+		validationType       string
+		validationTypeSource string
+		subjectCN            string
+		subjectO             string
+		cnNotInSAN           bool
+		ctlPoisonByte        bool
+	}{
+		{
+			fixture:              "ev",
+			allDomains:           []string{"ev.example.com", "www.ev.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:ev.example.com, DNS:www.ev.example.com",
+			certificatePolicies:  []string{"2.23.140.1.1"},
+			serialNumber:         "1001",
+			keyType:              "RSA2048",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 2, SingleSANCount: 2},
+			validationType:       "EV",
+			validationTypeSource: "jurisdiction",
+			subjectCN:            "ev.example.com",
+			subjectO:             "Example Corp",
+		},
+		{
+			fixture:              "dv",
+			allDomains:           []string{"dv.example.org"},
+			allRegDomains:        []string{"example.org"},
+			subjectAltName:       "DNS:dv.example.org",
+			certificatePolicies:  []string{"2.23.140.1.2.1"},
+			serialNumber:         "1002",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "DV",
+			validationTypeSource: "no_org_heuristic",
+			subjectCN:            "dv.example.org",
+			subjectO:             "<nil>",
+		},
+		{
+			fixture:              "ov",
+			allDomains:           []string{"ov.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:ov.example.com",
+			certificatePolicies:  []string{"2.23.140.1.2.2"},
+			serialNumber:         "1003",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "OV",
+			validationTypeSource: "policy_oid",
+			subjectCN:            "ov.example.com",
+			subjectO:             "Example Org",
+		},
+		{
+			fixture:              "wildcard",
+			allDomains:           []string{"*.example.net", "example.net"},
+			allRegDomains:        []string{"example.net"},
+			subjectAltName:       "DNS:*.example.net, DNS:example.net",
+			serialNumber:         "1004",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Wildcard",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 2, SingleSANCount: 1, WildcardSANCount: 1},
+			validationType:       "DV",
+			validationTypeSource: "no_org_heuristic",
+			subjectCN:            "*.example.net",
+			subjectO:             "<nil>",
+		},
+		{
+			fixture:              "multisan",
+			allDomains:           []string{"a.example.com", "b.example.com", "www.example.org", "shop.example.co.uk"},
+			allRegDomains:        []string{"example.com", "example.org", "example.co.uk"},
+			subjectAltName:       "DNS:a.example.com, DNS:b.example.com, DNS:www.example.org, DNS:shop.example.co.uk",
+			serialNumber:         "1005",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Multi",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 4, SingleSANCount: 4},
+			validationType:       "DV",
+			validationTypeSource: "no_org_heuristic",
+			subjectCN:            "a.example.com",
+			subjectO:             "<nil>",
+		},
+		{
+			// IP addresses are only listed in the subjectAltName extension, not in the domains.
+			fixture:              "ipsan",
+			allDomains:           []string{"host.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:host.example.com, IP Address:192.0.2.1, IP Address:2001:db8::1",
+			serialNumber:         "1006",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "DV",
+			validationTypeSource: "no_org_heuristic",
+			subjectCN:            "host.example.com",
+			subjectO:             "<nil>",
+		},
+		{
+			fixture:              "ed25519",
+			allDomains:           []string{"ed25519.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:ed25519.example.com",
+			serialNumber:         "1007",
+			keyType:              "Unknown",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "DV",
+			validationTypeSource: "no_org_heuristic",
+			subjectCN:            "ed25519.example.com",
+			subjectO:             "<nil>",
+		},
+		{
+			fixture:              "precert",
+			allDomains:           []string{"precert.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:precert.example.com",
+			serialNumber:         "1008",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "DV",
+			validationTypeSource: "no_org_heuristic",
+			subjectCN:            "precert.example.com",
+			subjectO:             "<nil>",
+			ctlPoisonByte:        true,
+		},
+		{
+			// 2.23.140.1.2.10 only shares its prefix with the DV policy, so the subject organization decides.
+			fixture:              "policy-dv-prefix",
+			allDomains:           []string{"prefix.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:prefix.example.com",
+			certificatePolicies:  []string{"2.23.140.1.2.10"},
+			serialNumber:         "100A",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "OV",
+			validationTypeSource: "default",
+			subjectCN:            "prefix.example.com",
+			subjectO:             "Example Org",
+		},
+		{
+			// A CN that is not a hostname is neither added to the domains nor reported as missing from the SANs.
+			fixture:              "weirdcn",
+			allDomains:           []string{"weird.example.com"},
+			allRegDomains:        []string{"example.com"},
+			subjectAltName:       "DNS:weird.example.com",
+			serialNumber:         "1009",
+			keyType:              "ECDSA256",
+			signatureAlgorithm:   "ECDSAWithSHA256",
+			certType:             "Single",
+			certTypeExt:          certstream.CertTypeExt{SANCount: 1, SingleSANCount: 1},
+			validationType:       "OV",
+			validationTypeSource: "default",
+			subjectCN:            "My Org CA (Test) - Ünïcode",
+			subjectO:             "My Org",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			leafCert := parseFixture(t, tt.fixture)
+
+			if !reflect.DeepEqual(leafCert.AllDomains, tt.allDomains) {
+				t.Errorf("AllDomains = %q, want %q", leafCert.AllDomains, tt.allDomains)
+			}
+			if !reflect.DeepEqual(leafCert.AllRegDomains, tt.allRegDomains) {
+				t.Errorf("AllRegDomains = %q, want %q", leafCert.AllRegDomains, tt.allRegDomains)
+			}
+			if leafCert.DistinctRegDomainCount != len(tt.allRegDomains) {
+				t.Errorf("DistinctRegDomainCount = %d, want %d", leafCert.DistinctRegDomainCount, len(tt.allRegDomains))
+			}
+			if got := stringValue(leafCert.Extensions.SubjectAltName); got != tt.subjectAltName {
+				t.Errorf("Extensions.SubjectAltName = %q, want %q", got, tt.subjectAltName)
+			}
+			if !reflect.DeepEqual(leafCert.Extensions.CertificatePolicies, tt.certificatePolicies) {
+				t.Errorf("Extensions.CertificatePolicies = %q, want %q", leafCert.Extensions.CertificatePolicies, tt.certificatePolicies)
+			}
+			if got := stringValue(leafCert.Extensions.BasicConstraints); got != "CA:FALSE" {
+				t.Errorf("Extensions.BasicConstraints = %q, want %q", got, "CA:FALSE")
+			}
+			if got := stringValue(leafCert.Extensions.AuthorityKeyIdentifier); got != "0102030405060708090a0b0c0d0e0f1011121314" {
+				t.Errorf("Extensions.AuthorityKeyIdentifier = %q, want the test CA key identifier", got)
+			}
+			if leafCert.Extensions.CTLPoisonByte != tt.ctlPoisonByte {
+				t.Errorf("Extensions.CTLPoisonByte = %t, want %t", leafCert.Extensions.CTLPoisonByte, tt.ctlPoisonByte)
+			}
+			if leafCert.SerialNumber != tt.serialNumber {
+				t.Errorf("SerialNumber = %q, want %q", leafCert.SerialNumber, tt.serialNumber)
+			}
+			if leafCert.NotBefore != fixtureNotBefore || leafCert.NotAfter != fixtureNotAfter {
+				t.Errorf("NotBefore, NotAfter = %d, %d, want %d, %d", leafCert.NotBefore, leafCert.NotAfter, fixtureNotBefore, fixtureNotAfter)
+			}
+			if leafCert.KeyType != tt.keyType {
+				t.Errorf("KeyType = %q, want %q", leafCert.KeyType, tt.keyType)
+			}
+			if leafCert.SignatureAlgorithm != tt.signatureAlgorithm {
+				t.Errorf("SignatureAlgorithm = %q, want %q", leafCert.SignatureAlgorithm, tt.signatureAlgorithm)
+			}
+			if leafCert.CertType != tt.certType {
+				t.Errorf("CertType = %q, want %q", leafCert.CertType, tt.certType)
+			}
+			if leafCert.CertTypeExt != tt.certTypeExt {
+				t.Errorf("CertTypeExt = %+v, want %+v", leafCert.CertTypeExt, tt.certTypeExt)
+			}
+			if leafCert.MalformedWildcard != tt.malformedWildcard {
+				t.Errorf("MalformedWildcard = %t, want %t", leafCert.MalformedWildcard, tt.malformedWildcard)
+			}
+			if leafCert.ValidationType != tt.validationType || leafCert.ValidationTypeSource != tt.validationTypeSource {
+				t.Errorf("ValidationType = %q (%s), want %q (%s)", leafCert.ValidationType, leafCert.ValidationTypeSource, tt.validationType, tt.validationTypeSource)
+			}
+			if got := stringValue(leafCert.Subject.CN); got != tt.subjectCN {
+				t.Errorf("Subject.CN = %q, want %q", got, tt.subjectCN)
+			}
+			if got := stringValue(leafCert.Subject.O); got != tt.subjectO {
+				t.Errorf("Subject.O = %q, want %q", got, tt.subjectO)
+			}
+			if leafCert.Subject.Sanitized {
+				t.Errorf("Subject.Sanitized = true, want false")
+			}
+			if got := stringValue(leafCert.Issuer.CN); got != "Certstream Test CA" {
+				t.Errorf("Issuer.CN = %q, want %q", got, "Certstream Test CA")
+			}
+			if leafCert.CNNotInSAN != tt.cnNotInSAN {
+				t.Errorf("CNNotInSAN = %t, want %t", leafCert.CNNotInSAN, tt.cnNotInSAN)
+			}
+			if leafCert.IsCA {
+				t.Errorf("IsCA = true, want false")
+			}
+		})
+	}
+}
+
+func TestParseDataEmptyDER(t *testing.T) {
+	tests := []struct {
+		name string
+		der  []byte
+	}{
+		{name: "nil", der: nil},
+		{name: "empty", der: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := GetEmptyDERs()
+
+			entry := &ct.RawLogEntry{Index: 42, Cert: ct.ASN1Cert{Data: tt.der}}
+			_, err := parseData(entry, "Test Operator", "Test Log", "https://ct.example.com/log/")
+
+			if !errors.Is(err, errEmptyDER) {
+				t.Errorf("parseData() error = %v, want %v", err, errEmptyDER)
+			}
+			if !errors.Is(err, errConversionFailed) {
+				t.Errorf("parseData() error = %v, want it to wrap %v", err, errConversionFailed)
+			}
+			if got := GetEmptyDERs() - before; got != 1 {
+				t.Errorf("GetEmptyDERs() increased by %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestCRLDistributionPoints(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *string
+	}{
+		{fixture: "dv", want: nil},
+		{fixture: "crl-one", want: stringPtr("URI:http://crl.example.com/ca.crl")},
+		{fixture: "crl-several", want: stringPtr("URI:http://crl.example.com/ca.crl, URI:http://crl2.example.com/ca.crl")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			extensions := parseFixture(t, tt.fixture).Extensions
+
+			if got := extensions.CRLDistributionPoints; stringValue(got) != stringValue(tt.want) {
+				t.Errorf("Extensions.CRLDistributionPoints = %q, want %q", stringValue(got), stringValue(tt.want))
+			}
+
+			encoded, err := json.Marshal(extensions)
+			if err != nil {
+				t.Fatalf("could not encode extensions: %s", err)
+			}
+
+			if got := bytes.Contains(encoded, []byte(`"crlDistributionPoints"`)); got != (tt.want != nil) {
+				t.Errorf("crlDistributionPoints in JSON = %t, want %t: %s", got, tt.want != nil, encoded)
+			}
+		})
+	}
+}
+
+func TestPolicyValidationType(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []asn1.ObjectIdentifier
+		want     string
+	}{
+		{name: "no policies", policies: nil, want: ""},
+		{name: "dv", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}}, want: "DV"},
+		{name: "ov", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 2}}, want: "OV"},
+		{name: "iv", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 3}}, want: "IV"},
+		{name: "ev", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 1}}, want: "EV"},
+		{name: "ca specific policy first", policies: []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 6449, 1, 2, 2, 7}, {2, 23, 140, 1, 2, 2}}, want: "OV"},
+		{name: "dv prefix", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 10}}, want: ""},
+		{name: "ev prefix", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 11}}, want: ""},
+		{name: "dv child", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1, 1}}, want: ""},
+		{name: "parent of dv", policies: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2}}, want: ""},
+		{name: "any policy", policies: []asn1.ObjectIdentifier{{2, 5, 29, 32, 0}}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policyValidationType(tt.policies); got != tt.want {
+				t.Errorf("policyValidationType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// referenceFingerprint is the previous implementation of formatFingerprint, kept to compare output and performance.
+func referenceFingerprint(digest []byte) string {
+	certHash := fmt.Sprintf("%02x", digest)
+	certHash = strings.ToUpper(certHash)
+
+	var result bytes.Buffer
+	for i := 0; i < len(certHash); i++ {
+		if i%2 == 0 && i > 0 {
+			result.WriteByte(':')
+		}
+		c := certHash[i]
+		result.WriteByte(c)
+	}
+
+	return result.String()
+}
+
+func TestFormatFingerprint(t *testing.T) {
+	sha1Digest := sha1.Sum([]byte("certstream")) //nolint:gosec
+	sha256Digest := sha256.Sum256([]byte("certstream"))
+
+	tests := []struct {
+		name   string
+		digest []byte
+		want   string
+	}{
+		{name: "empty", digest: nil, want: ""},
+		{name: "single byte", digest: []byte{0x0a}, want: "0A"},
+		{name: "all nibbles", digest: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}, want: "01:23:45:67:89:AB:CD:EF"},
+		{name: "sha1", digest: sha1Digest[:], want: referenceFingerprint(sha1Digest[:])},
+		{name: "sha256", digest: sha256Digest[:], want: referenceFingerprint(sha256Digest[:])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatFingerprint(tt.digest)
+			if got != tt.want {
+				t.Errorf("formatFingerprint() = %q, want %q", got, tt.want)
+			}
+
+			if got != strings.ToUpper(got) {
+				t.Errorf("formatFingerprint() = %q, want uppercase hex", got)
+			}
+
+			if len(tt.digest) > 0 && len(strings.Split(got, ":")) != len(tt.digest) {
+				t.Errorf("formatFingerprint() = %q, want %d colon separated bytes", got, len(tt.digest))
+			}
+		})
+	}
+}
+
+func BenchmarkFormatFingerprint(b *testing.B) {
+	digest := sha256.Sum256([]byte("certstream"))
+
+	b.Run("reference", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = referenceFingerprint(digest[:])
+		}
+	})
+
+	b.Run("current", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = formatFingerprint(digest[:])
+		}
+	})
+}
+
+func TestIsCompliantWildcard(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "*.example.com", want: true},
+		{domain: "*.com", want: true},
+		{domain: "example.com", want: false},
+		{domain: "a.*.example.com", want: false},
+		{domain: "*.*.example.com", want: false},
+		{domain: "f*.example.com", want: false},
+		{domain: "*example.com", want: false},
+		{domain: "*.", want: false},
+		{domain: "*", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := isCompliantWildcard(tt.domain); got != tt.want {
+				t.Errorf("isCompliantWildcard(%q) = %t, want %t", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHostnameOrIP(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "example.com", want: true},
+		{value: "www.example.com", want: true},
+		{value: "*.example.com", want: true},
+		{value: "example.com.", want: true},
+		{value: "192.0.2.1", want: true},
+		{value: "2001:db8::1", want: true},
+		{value: "My Org CA", want: false},
+		{value: "Example Corp. Root CA", want: false},
+		{value: "localhost", want: false},
+		{value: "example..com", want: false},
+		{value: ".", want: false},
+		{value: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := isHostnameOrIP(tt.value); got != tt.want {
+				t.Errorf("isHostnameOrIP(%q) = %t, want %t", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSubjectInvalidUTF8(t *testing.T) {
+	oidCommonName := asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidOrganization := asn1.ObjectIdentifier{2, 5, 4, 10}
+
+	tests := []struct {
+		name          string
+		subject       pkix.Name
+		wantCN        string
+		wantO         string
+		wantSanitized bool
+	}{
+		{
+			name: "valid",
+			subject: pkix.Name{
+				CommonName:   "Ünïcode CA",
+				Organization: []string{"Example Org"},
+				Names:        []pkix.AttributeTypeAndValue{{Type: oidCommonName, Value: "Ünïcode CA"}},
+			},
+			wantCN: "Ünïcode CA",
+			wantO:  "Example Org",
+		},
+		{
+			name: "latin-1",
+			subject: pkix.Name{
+				CommonName:   "M\xfcnchen CA",
+				Organization: []string{"Stadtwerke M\xfcnchen"},
+				Names: []pkix.AttributeTypeAndValue{
+					{Type: oidOrganization, Value: "Stadtwerke M\xfcnchen"},
+					{Type: oidCommonName, Value: "M\xfcnchen CA"},
+				},
+			},
+			wantCN:        "M\uFFFDnchen CA",
+			wantO:         "Stadtwerke M\uFFFDnchen",
+			wantSanitized: true,
+		},
+		{
+			name: "truncated sequence in names only",
+			subject: pkix.Name{
+				CommonName: "example.com",
+				Names:      []pkix.AttributeTypeAndValue{{Type: oidCommonName, Value: "example.com\xe2\x82"}},
+			},
+			wantCN:        "example.com",
+			wantO:         "<nil>",
+			wantSanitized: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := slices.Clone(tt.subject.Organization)
+			subject := buildSubject(tt.subject)
+
+			if subject.Sanitized != tt.wantSanitized {
+				t.Errorf("Sanitized = %t, want %t", subject.Sanitized, tt.wantSanitized)
+			}
+			if got := stringValue(subject.CN); got != tt.wantCN {
+				t.Errorf("CN = %q, want %q", got, tt.wantCN)
+			}
+			if got := stringValue(subject.O); got != tt.wantO {
+				t.Errorf("O = %q, want %q", got, tt.wantO)
+			}
+
+			aggregated := stringValue(subject.Aggregated)
+			if !utf8.ValidString(aggregated) || !json.Valid([]byte(aggregated)) {
+				t.Errorf("Aggregated = %q, want valid UTF-8 JSON", aggregated)
+			}
+			if got := strings.Contains(aggregated, "\uFFFD"); got != tt.wantSanitized {
+				t.Errorf("Aggregated = %q, contains replacement character = %t, want %t", aggregated, got, tt.wantSanitized)
+			}
+
+			encoded, err := json.Marshal(subject)
+			if err != nil {
+				t.Fatalf("could not encode subject: %s", err)
+			}
+			if !utf8.Valid(encoded) {
+				t.Errorf("encoded subject is not valid UTF-8: %q", encoded)
+			}
+
+			// The name of the certificate must not be modified.
+			if !slices.Equal(tt.subject.Organization, original) {
+				t.Errorf("Organization of the certificate was modified: %q", tt.subject.Organization)
+			}
+		})
+	}
+}
+
+func TestIsPlausibleDomain(t *testing.T) {
+	label63 := strings.Repeat("a", 63)
+	label64 := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name   string
+		domain string
+		want   bool
+	}{
+		{name: "domain", domain: "www.example.com", want: true},
+		{name: "single label", domain: "localhost", want: true},
+		{name: "63 character label", domain: label63 + ".example.com", want: true},
+		{name: "64 character label", domain: label64 + ".example.com", want: false},
+		{name: "64 character tld", domain: "example." + label64, want: false},
+		{name: "253 characters", domain: strings.Repeat(label63+".", 3) + strings.Repeat("a", 61), want: true},
+		{name: "254 characters", domain: strings.Repeat(label63+".", 3) + strings.Repeat("a", 62), want: false},
+		{name: "empty", domain: "", want: false},
+		{name: "empty label", domain: "www..example.com", want: false},
+		{name: "leading dot", domain: ".example.com", want: false},
+		{name: "trailing dot", domain: "example.com.", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPlausibleDomain(tt.domain); got != tt.want {
+				t.Errorf("isPlausibleDomain(%q) = %t, want %t", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	label64 := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name         string
+		domain       string
+		want         string
+		wantFallback bool
+	}{
+		{name: "subdomain", domain: "www.example.com", want: "example.com"},
+		{name: "multi-label suffix", domain: "shop.example.co.uk", want: "example.co.uk"},
+		{name: "wildcard", domain: "*.example.net", want: "example.net"},
+		{name: "registrable domain", domain: "example.org", want: "example.org"},
+		{name: "public suffix", domain: "co.uk", want: "co.uk"},
+		{name: "long label", domain: label64 + ".example.com", want: label64 + ".example.com", wantFallback: true},
+		{name: "overly long domain", domain: strings.Repeat("a.", 200) + "example.com", want: strings.Repeat("a.", 200) + "example.com", wantFallback: true},
+		{name: "empty label", domain: "www..example.com", want: "www..example.com", wantFallback: true},
+		{name: "invalid characters", domain: "ex ample!.exa$mple.com", want: "exa$mple.com"},
+		{name: "control characters", domain: "a\x00b.example.com", want: "example.com"},
+		{name: "invalid utf-8", domain: "\xff\xfe.example.com", want: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := GetRegDomainFallbacks()
+
+			if got := registrableDomain(tt.domain); got != tt.want {
+				t.Errorf("registrableDomain(%q) = %q, want %q", tt.domain, got, tt.want)
+			}
+
+			if fallback := GetRegDomainFallbacks() > before; fallback != tt.wantFallback {
+				t.Errorf("fallback = %t, want %t", fallback, tt.wantFallback)
+			}
+		})
+	}
+}
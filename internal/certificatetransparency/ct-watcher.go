@@ -9,15 +9,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/d-Rickyy-b/certstream-server-go/internal/budget"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/sinks"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/web"
 
 	ct "github.com/google/certificate-transparency-go"
@@ -31,16 +35,46 @@ var (
 	errCreatingClient    = errors.New("failed to create JSON client")
 	errFetchingSTHFailed = errors.New("failed to fetch STH")
 	userAgent            = fmt.Sprintf("Certstream Server v%s (github.com/d-Rickyy-b/certstream-server-go)", config.Version)
-	CAOwners             = make(map[string]string)
+
+	// logIDs maps the normalized urls of all known CT logs to their base64 encoded log ID.
+	logIDs      = make(map[string]string)
+	logIDsMutex sync.RWMutex
 )
 
+// workerGoroutines is the number of goroutines a single worker acquires from the goroutine budget: the worker itself,
+// its lag watcher and the scanner with its throughput logger, matcher, fetcher and range generator.
+const workerGoroutines = 6
+
 // Watcher describes a component that watches for new certificates in a CT log.
 type Watcher struct {
-	workers    []*worker
-	wg         sync.WaitGroup
-	context    context.Context
-	certChan   chan certstream.Entry
-	cancelFunc context.CancelFunc
+	workers      []*worker
+	workersMutex sync.RWMutex
+	// queuedLogs are logs that could not be started because the goroutine budget was exhausted, guarded by workersMutex.
+	// They are started in order as soon as the budget allows it.
+	queuedLogs []queuedLog
+	// Last successful refreshes of the ccadb data and the loglist, guarded by workersMutex.
+	ccadbRefreshed   time.Time
+	logListRefreshed time.Time
+	// ccadbFallback is true if the last ccadb refresh failed and previously loaded data is used.
+	ccadbFallback bool
+	wg            sync.WaitGroup
+	context       context.Context
+	certChan      chan certstream.Entry
+	cancelFunc    context.CancelFunc
+	sinks         *sinks.Fanout
+	// logList is the last successfully downloaded loglist. It is only accessed by the goroutine refreshing the logs.
+	logList *loglist3.LogList
+	// reloadChan passes reloaded log filters (ctlogs.min_shard_year) to the goroutine refreshing the logs.
+	reloadChan chan int
+}
+
+// queuedLog is a log waiting for a worker to be started.
+type queuedLog struct {
+	name         string
+	operatorName string
+	// ctURL never contains credentials, they are kept separately.
+	ctURL       string
+	credentials *logCredentials
 }
 
 // NewWatcher creates a new Watcher.
@@ -50,24 +84,54 @@ func NewWatcher(certChan chan certstream.Entry) *Watcher {
 	}
 }
 
-// Start starts the watcher. This method is blocking.
+// SetSinks sets the sinks all emitted entries are written to in addition to the websocket clients.
+// It must be called before Start.
+func (w *Watcher) SetSinks(fanout *sinks.Fanout) {
+	w.sinks = fanout
+}
+
+// Start starts the watcher. This method is blocking until Stop is called.
 func (w *Watcher) Start() {
 	w.context, w.cancelFunc = context.WithCancel(context.Background())
 
 	// Create new certChan if it doesn't exist yet
 	if w.certChan == nil {
-		w.certChan = make(chan certstream.Entry, 5000)
+		w.certChan = make(chan certstream.Entry, config.AppConfig.CTLogs.BufferSize)
+	}
+	certQueue.Store(&w.certChan)
+	w.reloadChan = make(chan int, 1)
+
+	if positionsFile := config.AppConfig.CTLogs.ImportPositions; positionsFile != "" {
+		if err := loadPositions(positionsFile); err != nil {
+			log.Printf("Could not import positions from '%s': %s\n", positionsFile, err)
+		}
+	}
+
+	warmUp.start(w.context, config.AppConfig.CTLogs.WarmUp)
+
+	if config.AppConfig.Revocations.Enabled {
+		go watchRevocations(w.context, config.AppConfig.Revocations)
 	}
 
 	// initialize the watcher with currently available logs
 	w.addNewlyAvailableLogs()
 
 	log.Println("Started CT watcher")
-	go certHandler(w.certChan)
+	handlerDone := make(chan struct{})
+	go func() {
+		certHandler(w.certChan, w.sinks)
+		close(handlerDone)
+	}()
 	go w.watchNewLogs()
 
+	// The watcher runs until it is stopped, even if no worker is running. That happens if the goroutine budget is too
+	// small for a single worker and all logs are queued, or if all logs were removed from the loglist.
+	<-w.context.Done()
 	w.wg.Wait()
 	close(w.certChan)
+
+	// Wait until all queued entries were handed to the clients and sinks
+	<-handlerDone
 }
 
 // watchNewLogs monitors the ct log list for new logs and starts a worker for each new log found.
@@ -83,6 +147,8 @@ func (w *Watcher) watchNewLogs() {
 		select {
 		case <-ticker.C:
 			w.addNewlyAvailableLogs()
+		case minShardYear := <-w.reloadChan:
+			w.applyLogFilters(minShardYear)
 		case <-w.context.Done():
 			ticker.Stop()
 			return
@@ -96,12 +162,29 @@ func (w *Watcher) watchNewLogs() {
 //	ADDED: This will load a list of all the 'trusted' CAs from CCADB, parse the AKIs and 'ca owners' into a map.
 func (w *Watcher) addNewlyAvailableLogs() {
 	log.Println("Checking for new cas from ccadb...")
-	ccadbURL := "https://ccadb.my.salesforce-sites.com/ccadb/AllCertificateRecordsCSVFormatv2"
-
-	//	Download and parse the CSV - the columns we want in the map are 1 - the 'CA Owner' and 19 - SKI. Which is b64-encoded-hex.
-	CAOwners, _ = DownloadAndParseCSV(ccadbURL, 18, 0, true)
+	//	Download and parse the CSV - by default, the columns we want in the map are 1 - the 'CA Owner' and 19 - SKI. Which is b64-encoded-hex.
+	ccadbConfig := config.AppConfig.CCADB
+	retry := RetryOptions{MaxRetries: ccadbConfig.Retries, InitialDelay: ccadbConfig.RetryDelay, MaxDelay: ccadbConfig.MaxRetryDelay}
+
+	caOwners, ccadbErr := loadCCADB(w.context, ccadbConfig, retry)
+	w.workersMutex.Lock()
+	if ccadbErr != nil {
+		// Keep the previously loaded data instead of losing all CA owners due to a temporary error
+		log.Printf("Could not load ccadb data, using previously loaded data (%d entries): %s\n", caOwnerCount(), ccadbErr)
+		w.ccadbFallback = true
+
+		if w.isCCADBStale() {
+			log.Printf("WARNING: ccadb data is stale, the last successful refresh was at %s (max staleness %s). CA owners may be outdated!\n",
+				w.ccadbRefreshed.Format(time.RFC3339), ccadbConfig.MaxStaleness)
+		}
+	} else {
+		caOwnersByKeyID.Store(&caOwners)
+		w.ccadbRefreshed = time.Now()
+		w.ccadbFallback = false
 
-	log.Printf("Got ccadb file - loaded %v icas...\n", len(CAOwners))
+		log.Printf("Got ccadb file - loaded %v icas...\n", len(caOwners))
+	}
+	w.workersMutex.Unlock()
 
 	log.Println("Checking for new ct logs...")
 
@@ -112,57 +195,395 @@ func (w *Watcher) addNewlyAvailableLogs() {
 		return
 	}
 
-	newCTs := 0
+	w.workersMutex.Lock()
+	w.logListRefreshed = time.Now()
+	w.workersMutex.Unlock()
+	w.logList = &logList
+
+	newCTs, _, listedURLs := w.reconcileLogs(logList)
+
+	log.Printf("New ct logs found: %d\n", newCTs)
+	validateImportedPositions(listedURLs)
+	w.removeAbsentLogs(listedURLs)
+	w.startQueuedLogs()
+	w.logMonitoredLogs()
+}
+
+// reconcileLogs diffs the logs of the loglist that pass the log filters against the running workers. Workers are
+// started for newly included logs and the workers of logs excluded by the filters are stopped, all other workers keep
+// running. It returns the number of started and stopped workers and the normalized urls of all included logs.
+func (w *Watcher) reconcileLogs(logList loglist3.LogList) (int, int, map[string]bool) {
+	started := 0
+	listedURLs := make(map[string]bool)
+	excludedURLs := make(map[string]bool)
 
 	// Check the ct log list for new, unwatched logs
 	// For each CT log, create a worker and start downloading certs
 	for _, operator := range logList.Operators {
 		// Iterate over each log of the operator
 		for _, transparencyLog := range operator.Logs {
-			// Check if the log is already being watched
 			newURL := normalizeCtlogURL(transparencyLog.URL)
-
-			alreadyWatched := false
-			for _, ctWorker := range w.workers {
-				workerURL := normalizeCtlogURL(ctWorker.ctURL)
-				if workerURL == newURL {
-					alreadyWatched = true
-					break
-				}
+			if !shouldWatchLog(transparencyLog) {
+				excludedURLs[newURL] = true
+				continue
 			}
 
-			// TODO maybe add a check for logs that are still watched but no longer on the logList and remove them? See also issue #41 and #42
-
-			// If the log is not being watched, create a new worker
-			if !alreadyWatched {
-				w.wg.Add(1)
-				newCTs++
-
-				ctWorker := worker{
-					name:         transparencyLog.Description,
-					operatorName: operator.Name,
-					ctURL:        transparencyLog.URL,
-					entryChan:    w.certChan,
-				}
-				w.workers = append(w.workers, &ctWorker)
-
-				// Start a goroutine for each worker
-				go func() {
-					defer w.wg.Done()
-					ctWorker.startDownloadingCerts(w.context)
-				}()
+			// Check if the log is already being watched
+			listedURLs[newURL] = true
+
+			logIDsMutex.Lock()
+			logIDs[newURL] = base64.StdEncoding.EncodeToString(transparencyLog.LogID)
+			logIDsMutex.Unlock()
+
+			if w.isWatchedOrQueued(newURL) {
+				continue
 			}
+
+			started++
+			ctURL, credentials := splitCredentials(transparencyLog.URL)
+			w.startOrQueueWorker(queuedLog{name: transparencyLog.Description, operatorName: operator.Name, ctURL: ctURL, credentials: credentials})
 		}
 	}
 
-	log.Printf("New ct logs found: %d\n", newCTs)
+	return started, w.stopExcludedLogs(excludedURLs), listedURLs
+}
+
+// stopExcludedLogs stops the workers and drops the queued logs whose normalized url is in excludedURLs and returns
+// the number of stopped workers.
+func (w *Watcher) stopExcludedLogs(excludedURLs map[string]bool) int {
+	if len(excludedURLs) == 0 {
+		return 0
+	}
+
+	w.workersMutex.Lock()
+	defer w.workersMutex.Unlock()
+
+	remaining := w.workers[:0]
+	for _, ctWorker := range w.workers {
+		workerURL := normalizeCtlogURL(ctWorker.ctURL)
+		if !excludedURLs[workerURL] {
+			remaining = append(remaining, ctWorker)
+			continue
+		}
+
+		log.Printf("Log '%s' is excluded by the log filters, stopping its worker\n", ctWorker.ctURL)
+		ctWorker.cancel()
+
+		logIDsMutex.Lock()
+		delete(logIDs, workerURL)
+		logIDsMutex.Unlock()
+	}
+
+	stopped := len(w.workers) - len(remaining)
+	clear(w.workers[len(remaining):])
+	w.workers = remaining
+
+	remainingQueued := w.queuedLogs[:0]
+	for _, queued := range w.queuedLogs {
+		if !excludedURLs[normalizeCtlogURL(queued.ctURL)] {
+			remainingQueued = append(remainingQueued, queued)
+		}
+	}
+	w.queuedLogs = remainingQueued
+
+	return stopped
+}
+
+// ReloadLogFilters applies changed log filters at runtime, e.g. after the config was reloaded. Only the workers of
+// logs that are newly excluded are stopped and only those of newly included logs are started.
+func (w *Watcher) ReloadLogFilters(minShardYear int) {
+	// Replace a reload that wasn't applied yet
+	select {
+	case <-w.reloadChan:
+	default:
+	}
+
+	select {
+	case w.reloadChan <- minShardYear:
+	default:
+	}
+}
+
+// applyLogFilters sets the reloaded log filters and reconciles the workers with the last downloaded loglist,
+// so that no loglist or ccadb download is needed.
+func (w *Watcher) applyLogFilters(minShardYear int) {
+	if minShardYear == config.AppConfig.CTLogs.MinShardYear {
+		log.Println("Log filters unchanged")
+		return
+	}
+
+	log.Printf("Changing ctlogs.min_shard_year from %d to %d\n", config.AppConfig.CTLogs.MinShardYear, minShardYear)
+	config.AppConfig.CTLogs.MinShardYear = minShardYear
+
+	if w.logList == nil {
+		return
+	}
+
+	started, stopped, _ := w.reconcileLogs(*w.logList)
+	log.Printf("Reconciled ct logs with the new log filters: %d started, %d stopped\n", started, stopped)
+	w.startQueuedLogs()
+	w.logMonitoredLogs()
+}
+
+// logMonitoredLogs logs the number of running workers and queued logs.
+func (w *Watcher) logMonitoredLogs() {
+	w.workersMutex.RLock()
+	defer w.workersMutex.RUnlock()
+
 	log.Printf("Currently monitored ct logs: %d\n", len(w.workers))
+	if len(w.queuedLogs) > 0 {
+		log.Printf("Queued ct logs waiting for the goroutine budget: %d\n", len(w.queuedLogs))
+	}
+}
+
+// isWatchedOrQueued checks if a worker is running for the log with the given normalized url or if the log is queued.
+func (w *Watcher) isWatchedOrQueued(normalizedURL string) bool {
+	w.workersMutex.RLock()
+	defer w.workersMutex.RUnlock()
+
+	for _, ctWorker := range w.workers {
+		if normalizeCtlogURL(ctWorker.ctURL) == normalizedURL {
+			return true
+		}
+	}
+
+	for _, queued := range w.queuedLogs {
+		if normalizeCtlogURL(queued.ctURL) == normalizedURL {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startOrQueueWorker starts a worker for the given log. If the goroutine budget is exhausted, the log is queued
+// instead and started once another worker stopped.
+func (w *Watcher) startOrQueueWorker(ctLog queuedLog) {
+	if !budget.Goroutines.TryAcquire(workerGoroutines) {
+		log.Printf("Goroutine budget of %d exhausted, queueing log '%s'\n", budget.Goroutines.Max(), ctLog.ctURL)
+		w.workersMutex.Lock()
+		w.queuedLogs = append(w.queuedLogs, ctLog)
+		w.workersMutex.Unlock()
+
+		return
+	}
+
+	w.startWorker(ctLog)
+}
+
+// startWorker starts a worker for the given log. The goroutines of the worker must already be acquired from the budget
+// and are released once the worker stopped.
+func (w *Watcher) startWorker(ctLog queuedLog) {
+	w.wg.Add(1)
+
+	ctWorker := newWorker(ctLog.name, ctLog.operatorName, ctLog.ctURL, w.certChan)
+	ctWorker.credentials = ctLog.credentials
+	workerCtx, cancel := context.WithCancel(w.context)
+	ctWorker.cancel = cancel
+	w.workersMutex.Lock()
+	w.workers = append(w.workers, ctWorker)
+	w.workersMutex.Unlock()
+
+	// Start a goroutine for each worker
+	go func() {
+		defer w.wg.Done()
+
+		if waitStartJitter(workerCtx) {
+			ctWorker.startDownloadingCerts(workerCtx)
+		}
+
+		budget.Goroutines.Release(workerGoroutines)
+		// Start queued logs before calling Done, so that the WaitGroup of the watcher can't reach zero in between
+		w.startQueuedLogs()
+	}()
+}
+
+// waitStartJitter waits for a random delay below the configured ctlogs.start_jitter, so that many workers started at
+// once (e.g. on boot) don't all fetch their STH and start scanning at the same moment. Returns false if the context
+// was cancelled while waiting.
+func waitStartJitter(ctx context.Context) bool {
+	jitter := config.AppConfig.CTLogs.StartJitter
+	if jitter <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(jitter))))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// startQueuedLogs starts workers for the queued logs in order as long as the goroutine budget allows it.
+func (w *Watcher) startQueuedLogs() {
+	for w.context.Err() == nil {
+		w.workersMutex.Lock()
+		if len(w.queuedLogs) == 0 || !budget.Goroutines.TryAcquire(workerGoroutines) {
+			w.workersMutex.Unlock()
+			return
+		}
+
+		ctLog := w.queuedLogs[0]
+		w.queuedLogs = w.queuedLogs[1:]
+		w.workersMutex.Unlock()
+
+		log.Printf("Starting queued log '%s'\n", ctLog.ctURL)
+		w.startWorker(ctLog)
+	}
+}
+
+// removeAbsentLogs stops the workers of logs that were missing from the loglist for the configured number of
+// consecutive refreshes. Workers of logs that are listed again start counting from zero.
+func (w *Watcher) removeAbsentLogs(listedURLs map[string]bool) {
+	removeAfter := config.AppConfig.CTLogs.RemoveAbsentAfter
+	if removeAfter < 0 {
+		return
+	}
+
+	w.workersMutex.Lock()
+	defer w.workersMutex.Unlock()
+
+	remaining := w.workers[:0]
+	for _, ctWorker := range w.workers {
+		workerURL := normalizeCtlogURL(ctWorker.ctURL)
+		if listedURLs[workerURL] {
+			ctWorker.absentRefreshes = 0
+			remaining = append(remaining, ctWorker)
+
+			continue
+		}
+
+		ctWorker.absentRefreshes++
+		if ctWorker.absentRefreshes < removeAfter {
+			log.Printf("Log '%s' is missing from the loglist (%d/%d refreshes)\n", ctWorker.ctURL, ctWorker.absentRefreshes, removeAfter)
+			remaining = append(remaining, ctWorker)
+
+			continue
+		}
+
+		log.Printf("Log '%s' was missing from the loglist for %d refreshes, removing it\n", ctWorker.ctURL, ctWorker.absentRefreshes)
+		ctWorker.cancel()
+
+		logIDsMutex.Lock()
+		delete(logIDs, workerURL)
+		logIDsMutex.Unlock()
+	}
+
+	// Clear the references to removed workers in the unused part of the slice
+	clear(w.workers[len(remaining):])
+	w.workers = remaining
+
+	// Queued logs haven't been started yet, so they are dropped as soon as they are missing from the loglist
+	remainingQueued := w.queuedLogs[:0]
+	for _, queued := range w.queuedLogs {
+		if listedURLs[normalizeCtlogURL(queued.ctURL)] {
+			remainingQueued = append(remainingQueued, queued)
+		}
+	}
+	w.queuedLogs = remainingQueued
+}
+
+// WatcherStatus describes the current state of the watcher and its workers.
+type WatcherStatus struct {
+	Workers []WorkerStatus `json:"workers"`
+	// QueuedLogs are the urls of the logs waiting for the goroutine budget to start a worker.
+	QueuedLogs []string `json:"queued_logs,omitempty"`
+	// GoroutinesUsed is the number of goroutines acquired from the goroutine budget, GoroutinesMax the size of the
+	// budget or 0 if it is unlimited.
+	GoroutinesUsed int64 `json:"goroutines_used"`
+	GoroutinesMax  int64 `json:"goroutines_max"`
+	// Last successful refreshes of the ccadb data and the loglist. Nil if they were never refreshed successfully.
+	CCADBRefreshed   *time.Time `json:"ccadb_refreshed,omitempty"`
+	LogListRefreshed *time.Time `json:"loglist_refreshed,omitempty"`
+	// CCADBFallback is true if the last ccadb refresh failed and previously loaded data is used.
+	CCADBFallback bool `json:"ccadb_fallback"`
+	// CCADBStale is true if the previously loaded ccadb data is older than the configured ccadb.max_staleness.
+	CCADBStale bool `json:"ccadb_stale"`
+}
+
+// WorkerStatus describes the current state of a single worker.
+type WorkerStatus struct {
+	Name     string `json:"name"`
+	Operator string `json:"operator"`
+	URL      string `json:"url"`
+	// StartIndex is the index the worker started at. TreeSize is the size of the log when the worker was started.
+	StartIndex int64 `json:"start_index"`
+	TreeSize   int64 `json:"tree_size"`
+	// LastIndex is the index of the last entry delivered by the worker or -1 if no entry was delivered yet.
+	LastIndex int64 `json:"last_index"`
+	// CatchingUp is true as long as the worker didn't reach the tree size it was started with.
+	// Remaining is the number of entries left until it did so.
+	CatchingUp bool  `json:"catching_up"`
+	Remaining  int64 `json:"remaining"`
+	// LatestTreeSize is the tree size of the periodically refreshed STH. Lag is the number of entries between
+	// the next index to be delivered and LatestTreeSize. Lagging is true if the lag exceeds the configured thresholds.
+	LatestTreeSize int64 `json:"latest_tree_size"`
+	Lag            int64 `json:"lag"`
+	Lagging        bool  `json:"lagging"`
+	// Batches is the number of get-entries requests and RequestedEntries and ReturnedEntries the number of entries
+	// requested and returned by them. TruncatedBatches counts the responses with fewer entries than requested.
+	// AvgBatchSize is the average number of entries returned per request.
+	Batches          int64   `json:"batches"`
+	RequestedEntries int64   `json:"requested_entries"`
+	ReturnedEntries  int64   `json:"returned_entries"`
+	TruncatedBatches int64   `json:"truncated_batches"`
+	AvgBatchSize     float64 `json:"avg_batch_size"`
+}
+
+// Status returns the current state of the watcher and its workers.
+func (w *Watcher) Status() WatcherStatus {
+	w.workersMutex.RLock()
+	defer w.workersMutex.RUnlock()
+
+	status := WatcherStatus{Workers: make([]WorkerStatus, 0, len(w.workers))}
+	for _, ctWorker := range w.workers {
+		status.Workers = append(status.Workers, ctWorker.status())
+	}
+
+	for _, queued := range w.queuedLogs {
+		status.QueuedLogs = append(status.QueuedLogs, queued.ctURL)
+	}
+
+	status.GoroutinesUsed = budget.Goroutines.Used()
+	status.GoroutinesMax = budget.Goroutines.Max()
+
+	status.CCADBFallback = w.ccadbFallback
+	status.CCADBStale = w.isCCADBStale()
+
+	if !w.ccadbRefreshed.IsZero() {
+		ccadbRefreshed := w.ccadbRefreshed
+		status.CCADBRefreshed = &ccadbRefreshed
+	}
+
+	if !w.logListRefreshed.IsZero() {
+		logListRefreshed := w.logListRefreshed
+		status.LogListRefreshed = &logListRefreshed
+	}
+
+	return status
+}
+
+// isCCADBStale checks if the ccadb data in use is older than the configured maximum staleness, because refreshes
+// failed since. The caller must hold the workersMutex.
+func (w *Watcher) isCCADBStale() bool {
+	maxStaleness := config.AppConfig.CCADB.MaxStaleness
+	if maxStaleness <= 0 || !w.ccadbFallback || w.ccadbRefreshed.IsZero() {
+		return false
+	}
+
+	return time.Since(w.ccadbRefreshed) > maxStaleness
 }
 
 // Stop stops the watcher.
 func (w *Watcher) Stop() {
 	log.Printf("Stopping watcher\n")
-	w.cancelFunc()
+	if w.cancelFunc != nil {
+		w.cancelFunc()
+	}
 }
 
 // A worker processes a single CT log.
@@ -170,19 +591,85 @@ type worker struct {
 	name         string
 	operatorName string
 	ctURL        string
-	entryChan    chan certstream.Entry
-	mu           sync.Mutex
-	running      bool
+	// credentials are the basic auth credentials of private logs or nil.
+	credentials *logCredentials
+	entryChan   chan certstream.Entry
+	mu          sync.Mutex
+	running     bool
+
+	// Progress of the worker, see WorkerStatus.
+	startIndex atomic.Int64
+	treeSize   atomic.Int64
+	lastIndex  atomic.Int64
+	// latestTreeSize is the tree size of the latest STH, which is refreshed periodically. lagging is set while the
+	// lag of the worker exceeds the configured thresholds.
+	latestTreeSize atomic.Int64
+	lagging        atomic.Bool
+	// batches counts the entries requested and returned by the get-entries requests of the scanner.
+	batches batchStats
+
+	// recentIndices holds the recently emitted indices to suppress entries re-delivered after a restart.
+	recentIndices *indexRing
+
+	// cancel stops the worker. absentRefreshes counts the consecutive loglist refreshes the log was missing from
+	// the loglist and is guarded by the workersMutex of the watcher.
+	cancel          context.CancelFunc
+	absentRefreshes int
 }
 
-// startDownloadingCerts starts downloading certificates from the CT log. This method is blocking.
-func (w *worker) startDownloadingCerts(ctx context.Context) {
+// newWorker creates a new worker for the given CT log.
+func newWorker(name, operatorName, ctURL string, entryChan chan certstream.Entry) *worker {
 	// Normalize CT URL. We remove trailing slashes and prepend "https://" if it's not already there.
-	w.ctURL = strings.TrimRight(w.ctURL, "/")
-	if !strings.HasPrefix(w.ctURL, "https://") && !strings.HasPrefix(w.ctURL, "http://") {
-		w.ctURL = "https://" + w.ctURL
+	ctURL = strings.TrimRight(ctURL, "/")
+	if !strings.HasPrefix(ctURL, "https://") && !strings.HasPrefix(ctURL, "http://") {
+		ctURL = "https://" + ctURL
+	}
+
+	ctWorker := &worker{
+		name:          name,
+		operatorName:  operatorName,
+		ctURL:         ctURL,
+		entryChan:     entryChan,
+		recentIndices: newIndexRing(recentIndicesSize),
 	}
+	ctWorker.lastIndex.Store(-1)
 
+	return ctWorker
+}
+
+// status returns the current state of the worker.
+func (w *worker) status() WorkerStatus {
+	status := WorkerStatus{
+		Name:       w.name,
+		Operator:   w.operatorName,
+		URL:        w.ctURL,
+		StartIndex: w.startIndex.Load(),
+		TreeSize:   w.treeSize.Load(),
+		LastIndex:  w.lastIndex.Load(),
+
+		LatestTreeSize: w.latestTreeSize.Load(),
+		Lag:            w.lag(),
+		Lagging:        w.lagging.Load(),
+
+		Batches:          w.batches.batches.Load(),
+		RequestedEntries: w.batches.requested.Load(),
+		ReturnedEntries:  w.batches.returned.Load(),
+		TruncatedBatches: w.batches.truncated.Load(),
+		AvgBatchSize:     w.batches.averageBatchSize(),
+	}
+
+	// The next index to be delivered is either the one after the last delivered index or the start index.
+	nextIndex := max(status.LastIndex+1, status.StartIndex)
+	if nextIndex < status.TreeSize {
+		status.CatchingUp = true
+		status.Remaining = status.TreeSize - nextIndex
+	}
+
+	return status
+}
+
+// startDownloadingCerts starts downloading certificates from the CT log. This method is blocking.
+func (w *worker) startDownloadingCerts(ctx context.Context) {
 	log.Printf("Starting worker for CT log: %s\n", w.ctURL)
 	defer log.Printf("Stopping worker for CT log: %s\n", w.ctURL)
 
@@ -199,6 +686,10 @@ func (w *worker) startDownloadingCerts(ctx context.Context) {
 
 	for {
 		workerErr := w.runWorker(ctx)
+
+		// During the warm-up, restarts are aggregated by warmUp instead of being logged one by one
+		quiet := false
+
 		if workerErr != nil {
 			if errors.Is(workerErr, errFetchingSTHFailed) {
 				log.Printf("Worker for '%s' failed - could not fetch STH\n", w.ctURL)
@@ -211,7 +702,10 @@ func (w *worker) startDownloadingCerts(ctx context.Context) {
 				return
 			}
 
-			log.Printf("Worker for '%s' failed with unexpected error: %s\n", w.ctURL, workerErr)
+			quiet = warmUp.retry(w.ctURL, workerErr)
+			if !quiet {
+				log.Printf("Worker for '%s' failed with unexpected error: %s\n", w.ctURL, workerErr)
+			}
 		}
 
 		// Check if the context was cancelled
@@ -220,18 +714,44 @@ func (w *worker) startDownloadingCerts(ctx context.Context) {
 			log.Printf("Context was cancelled; Stopping worker for '%s'\n", w.ctURL)
 			return
 		default:
-			log.Printf("Worker for '%s' sleeping for 5 seconds due to error\n", w.ctURL)
+			if !quiet {
+				log.Printf("Worker for '%s' sleeping for 5 seconds due to error\n", w.ctURL)
+			}
+
 			time.Sleep(5 * time.Second)
-			log.Printf("Restarting worker for '%s'\n", w.ctURL)
+
+			if !quiet {
+				log.Printf("Restarting worker for '%s'\n", w.ctURL)
+			}
+
 			continue
 		}
 	}
 }
 
+// newLogClient creates a client for the given CT log, using its credentials and configured endpoints.
+func newLogClient(ctURL, operatorName string, credentials *logCredentials) (*client.LogClient, error) {
+	var transport http.RoundTripper = http.DefaultTransport
+	if credentials != nil {
+		transport = basicAuthTransport{credentials: credentials, next: transport}
+	}
+
+	if endpoints := configuredEndpoints(ctURL); endpoints != nil {
+		transport = endpointTransport{endpoints: endpoints, next: transport}
+	}
+
+	if limiter := getOperatorLimiter(operatorName); limiter != nil {
+		transport = operatorLimitTransport{limiter: limiter, next: transport}
+	}
+
+	hc := http.Client{Timeout: 30 * time.Second, Transport: transport}
+
+	return client.New(ctURL, &hc, jsonclient.Options{UserAgent: userAgent})
+}
+
 // runWorker runs a single worker for a single CT log. This method is blocking.
 func (w *worker) runWorker(ctx context.Context) error {
-	hc := http.Client{Timeout: 30 * time.Second}
-	jsonClient, e := client.New(w.ctURL, &hc, jsonclient.Options{UserAgent: userAgent})
+	jsonClient, e := newLogClient(w.ctURL, w.operatorName, w.credentials)
 	if e != nil {
 		log.Printf("Error creating JSON client: %s\n", e)
 		return errCreatingClient
@@ -243,24 +763,31 @@ func (w *worker) runWorker(ctx context.Context) error {
 		return errFetchingSTHFailed
 	}
 
-	//	Check if the log is in the config file with a specific index to start at. If so, use it (checking it's bigger than 0 and smaller than the current tree size!)
-	logStart := int64(sth.TreeSize)
+	// By default, start at the latest STH to skip all the past certificates
+	treeSize := int64(sth.TreeSize)
+	logStart := configuredStartIndex(w.ctURL, treeSize, func(startTime time.Time) (int64, error) {
+		return findIndexByTime(ctx, jsonClient, treeSize, startTime)
+	})
 
-	for _, element := range config.AppConfig.CTLogs.StartIndex {
-		if strings.Contains(w.ctURL, element) {
-			logStartIndex := strings.Split(element, " ")
-			newStartIndex, _ := strconv.Atoi(logStartIndex[1])
-			if newStartIndex > 0 {
-				logStart = int64(newStartIndex)
-			}
-		}
+	w.startIndex.Store(logStart)
+	w.treeSize.Store(treeSize)
+	w.latestTreeSize.Store(treeSize)
+
+	lagCtx, stopLagWatch := context.WithCancel(ctx)
+	defer stopLagWatch()
+	go w.watchLag(lagCtx, jsonClient)
+
+	if logStart < treeSize {
+		log.Printf("Worker for '%s' catching up from index %d to %d\n", w.ctURL, logStart, treeSize)
 	}
 
-	certScanner := scanner.NewScanner(jsonClient, scanner.ScannerOptions{
+	// In continuous mode, the scanner first catches up to the current tree size and then keeps polling for new entries.
+	// Memory usage stays bounded while catching up, because the scanner blocks as soon as its buffer and the entryChan are full.
+	certScanner := scanner.NewScanner(batchStatsClient{LogClient: jsonClient, stats: &w.batches}, scanner.ScannerOptions{
 		FetcherOptions: scanner.FetcherOptions{
 			BatchSize:     100,
 			ParallelFetch: 1,
-			StartIndex:    logStart, // Start at the latest STH to skip all the past certificates
+			StartIndex:    logStart,
 			Continuous:    true,
 		},
 		Matcher:     scanner.MatchAll{},
@@ -271,7 +798,10 @@ func (w *worker) runWorker(ctx context.Context) error {
 
 	scanErr := certScanner.Scan(ctx, w.foundCertCallback, w.foundPrecertCallback)
 	if scanErr != nil {
-		log.Println("Scan error: ", scanErr)
+		if !warmUp.active() {
+			log.Println("Scan error: ", scanErr)
+		}
+
 		return scanErr
 	}
 
@@ -280,8 +810,87 @@ func (w *worker) runWorker(ctx context.Context) error {
 	return nil
 }
 
+// configuredStartIndex returns the index to start the given CT log at. Start indices are configured as
+// "<url> <index>" entries. An index of "earliest" starts at the very first entry of the log. Instead of an index,
+// a point in time (RFC3339 or date) can be given, which is resolved to an index with findIndex.
+// If no (valid) start index is configured for the log, the imported position or the current tree size is returned.
+func configuredStartIndex(ctURL string, treeSize int64, findIndex func(time.Time) (int64, error)) int64 {
+	for _, element := range config.AppConfig.CTLogs.StartIndex {
+		fields := strings.Fields(element)
+		if len(fields) != 2 || normalizeCtlogURL(fields[0]) != normalizeCtlogURL(ctURL) {
+			continue
+		}
+
+		if strings.EqualFold(fields[1], "earliest") {
+			return 0
+		}
+
+		if startTime, ok := parseStartTime(fields[1]); ok {
+			startIndex, err := findIndex(startTime)
+			if err != nil {
+				log.Printf("Could not find index for start time %s in '%s', starting at the head of the log: %s\n", startTime.Format(time.RFC3339), ctURL, err)
+				return treeSize
+			}
+
+			log.Printf("Starting '%s' at index %d for start time %s\n", ctURL, startIndex, startTime.Format(time.RFC3339))
+
+			return startIndex
+		}
+
+		// Check that the index is bigger than 0 and smaller than the current tree size
+		startIndex, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || startIndex <= 0 || startIndex >= treeSize {
+			log.Printf("Ignoring invalid start index '%s' for '%s' (tree size %d)\n", fields[1], ctURL, treeSize)
+			continue
+		}
+
+		return startIndex
+	}
+
+	if startIndex, ok := importedStartIndex(ctURL, treeSize); ok {
+		return startIndex
+	}
+
+	return treeSize
+}
+
+// isDuplicate checks if the index of the given entry was already emitted recently by this worker.
+// Duplicates are counted but not broadcast again.
+func (w *worker) isDuplicate(rawEntry *ct.RawLogEntry) bool {
+	if w.recentIndices.add(rawEntry.Index) {
+		return false
+	}
+
+	atomic.AddInt64(&duplicateIndices, 1)
+
+	return true
+}
+
+// isStale checks if the given entry was found while catching up and was logged before the configured
+// ctlogs.max_catch_up_age. Stale entries are skipped without parsing them, but the index of the worker still advances.
+func (w *worker) isStale(rawEntry *ct.RawLogEntry) bool {
+	maxAge := config.AppConfig.CTLogs.MaxCatchUpAge
+	if maxAge <= 0 || rawEntry.Index >= w.treeSize.Load() {
+		return false
+	}
+
+	loggedAt := time.UnixMilli(int64(rawEntry.Leaf.TimestampedEntry.Timestamp))
+	if time.Since(loggedAt) <= maxAge {
+		return false
+	}
+
+	w.lastIndex.Store(rawEntry.Index)
+	atomic.AddInt64(&staleSkipped, 1)
+
+	return true
+}
+
 // foundCertCallback is the callback that handles cases where new regular certs are found.
 func (w *worker) foundCertCallback(rawEntry *ct.RawLogEntry) {
+	if w.isDuplicate(rawEntry) || w.isStale(rawEntry) {
+		return
+	}
+
 	entry, parseErr := parseCertstreamEntry(rawEntry, w.operatorName, w.name, w.ctURL)
 	if parseErr != nil {
 		log.Println("Error parsing certstream entry: ", parseErr)
@@ -290,12 +899,17 @@ func (w *worker) foundCertCallback(rawEntry *ct.RawLogEntry) {
 
 	entry.Data.UpdateType = "X509LogEntry"
 	w.entryChan <- entry
+	w.lastIndex.Store(rawEntry.Index)
 
 	atomic.AddInt64(&processedCerts, 1)
 }
 
 // foundPrecertCallback is the callback that handles cases where new precerts are found.
 func (w *worker) foundPrecertCallback(rawEntry *ct.RawLogEntry) {
+	if w.isDuplicate(rawEntry) || w.isStale(rawEntry) {
+		return
+	}
+
 	entry, parseErr := parseCertstreamEntry(rawEntry, w.operatorName, w.name, w.ctURL)
 	if parseErr != nil {
 		log.Println("Error parsing certstream entry: ", parseErr)
@@ -304,59 +918,187 @@ func (w *worker) foundPrecertCallback(rawEntry *ct.RawLogEntry) {
 
 	entry.Data.UpdateType = "PrecertLogEntry"
 	w.entryChan <- entry
+	w.lastIndex.Store(rawEntry.Index)
 
 	atomic.AddInt64(&processedPrecerts, 1)
 }
 
 // certHandler takes the entries out of the entryChan channel and broadcasts them to all clients.
-// Only a single instance of the certHandler runs per certstream server.
-func certHandler(entryChan chan certstream.Entry) {
+// Only a single instance of the certHandler runs per certstream server. It returns once entryChan is closed.
+// The dedup, collapser, rollup, heartbeat, issuer tracker, TBS checker and progress logger are owned by the certHandler
+// and not safe for concurrent use.
+func certHandler(entryChan chan certstream.Entry, fanout *sinks.Fanout) {
 	var processed int64
 
-	for {
-		entry := <-entryChan
+	progressConfig := config.AppConfig.CTLogs.ProgressLog
+	progress := newProgressLogger(progressConfig.Entries, progressConfig.Interval)
+
+	// Sequence numbers are assigned here, at the single point of emission, so they stay monotonic per log
+	// regardless of how the entries were fetched and parsed.
+	sequences := make(map[string]int64)
+
+	var dedup *fingerprintDedup
+	if dedupConfig := config.AppConfig.Processing.DedupWindow; dedupConfig.Enabled {
+		dedup = newFingerprintDedup(dedupConfig.Window)
+	}
+
+	var collapser *regDomainCollapser
+	if collapseConfig := config.AppConfig.Processing.CollapseRegDomains; collapseConfig.Enabled {
+		collapser = newRegDomainCollapser(collapseConfig.Window, collapseConfig.MaxEntries)
+	}
+
+	var rollup *regDomainRollup
+	if rollupConfig := config.AppConfig.Processing.RegDomainRollup; rollupConfig.Enabled {
+		rollup = newRegDomainRollup(rollupConfig.Window, rollupConfig.Threshold, rollupConfig.MaxEntries)
+	}
+
+	var heartbeat *issuerHeartbeat
+	if heartbeatConfig := config.AppConfig.Processing.IssuerHeartbeat; heartbeatConfig.Enabled {
+		heartbeat = newIssuerHeartbeat(heartbeatConfig.Key, heartbeatConfig.Window, heartbeatConfig.MaxEntries)
+	}
+
+	var tbsChecker *tbsConsistencyChecker
+	if tbsConfig := config.AppConfig.Processing.TBSConsistency; tbsConfig.Enabled {
+		tbsChecker = newTBSConsistencyChecker(tbsConfig.MaxEntries, tbsConfig.Window)
+	}
+
+	var hook *entryHook
+	if hookConfig := config.AppConfig.Processing.EntryHook; hookConfig.Enabled {
+		var hookErr error
+		if hook, hookErr = newEntryHook(hookConfig.Expression, hookConfig.File, hookConfig.Timeout, hookConfig.OnError); hookErr != nil {
+			log.Fatalln("Could not compile processing.entry_hook expression:", hookErr)
+		}
+	}
+
+	var issuerTracker *newIssuerTracker
+	if newIssuersConfig := config.AppConfig.Processing.NewIssuers; newIssuersConfig.Enabled {
+		issuerTracker = newNewIssuerTracker(newIssuersConfig.MaxEntries, newIssuersConfig.StateFile)
+		defer issuerTracker.save()
+	}
+
+	notYetValidAction := config.AppConfig.Processing.NotYetValid
+
+	for entry := range entryChan {
 		processed++
+		// Suppressed entries are processed as well, so the progress is logged before any of them is dropped
+		progress.entryProcessed(processed, len(entryChan))
+
+		if dedup != nil && entry.MessageType == "certificate_update" && dedup.suppress(&entry, time.Now()) {
+			metrics.Inc(entry.Data.Source.Operator, entry.Data.Source.NormalizedURL)
+			continue
+		}
+
+		if entry.MessageType == "certificate_update" && !entry.ValidityStarted() {
+			atomic.AddInt64(&notYetValidCerts, 1)
+
+			switch notYetValidAction {
+			case "flag":
+				entry.Data.LeafCert.NotYetValid = true
+			case "drop":
+				metrics.Inc(entry.Data.Source.Operator, entry.Data.Source.NormalizedURL)
+				continue
+			}
+		}
+
+		if collapser != nil && entry.MessageType == "certificate_update" && collapser.suppress(&entry) {
+			metrics.Inc(entry.Data.Source.Operator, entry.Data.Source.NormalizedURL)
+			continue
+		}
+
+		if rollup != nil && entry.MessageType == "certificate_update" {
+			now := time.Now()
+			for _, summary := range rollup.summaries(now) {
+				emitEntry(summary, fanout)
+			}
+
+			if rollup.suppress(&entry, now) {
+				metrics.Inc(entry.Data.Source.Operator, entry.Data.Source.NormalizedURL)
+				continue
+			}
+		}
+
+		if heartbeat != nil && entry.MessageType == "certificate_update" && heartbeat.suppress(&entry, time.Now()) {
+			metrics.Inc(entry.Data.Source.Operator, entry.Data.Source.NormalizedURL)
+			continue
+		}
+
+		if issuerTracker != nil && entry.MessageType == "certificate_update" {
+			issuerTracker.track(&entry)
+		}
+
+		if tbsChecker != nil && entry.MessageType == "certificate_update" {
+			tbsChecker.check(&entry)
+		}
+
+		if hook != nil && entry.MessageType == "certificate_update" && !hook.apply(&entry) {
+			metrics.Inc(entry.Data.Source.Operator, entry.Data.Source.NormalizedURL)
+			continue
+		}
 
-		if processed%1000 == 0 {
-			log.Printf("Processed %d entries | Queue length: %d\n", processed, len(entryChan))
+		sequences[entry.Data.Source.NormalizedURL]++
+		entry.Data.Sequence = sequences[entry.Data.Source.NormalizedURL]
+
+		if processed%1000 == 0 && entry.MessageType == "certificate_update" {
 			// Every thousandth entry, we store one certificate as example
 			web.SetExampleCert(entry)
 		}
 
-		// Run json encoding in the background and send the result to the clients.
-		web.ClientHandler.Broadcast <- entry
+		web.RecordAnalytics(&entry)
+
+		emitEntry(entry, fanout)
 
 		// Update metrics
 		url := entry.Data.Source.NormalizedURL
 		operator := entry.Data.Source.Operator
 
 		metrics.Inc(operator, url)
+
+		if entry.MessageType == "certificate_update" {
+			countCertificateTypes(&entry)
+		}
 	}
 }
 
-// getAllLogs returns a list of all CT logs.
-func getAllLogs() (loglist3.LogList, error) {
-	// Download the list of all logs from ctLogInfo and decode json
-	resp, err := http.Get(loglist3.LogListURL)
-	if err != nil {
-		return loglist3.LogList{}, err
+// emitEntry hands the entry to the websocket clients and the sinks.
+func emitEntry(entry certstream.Entry, fanout *sinks.Fanout) {
+	// Run json encoding in the background and send the result to the clients.
+	// Without any connected clients, the entry is not handed to the broadcaster at all to save CPU on idle instances.
+	if web.ClientHandler.HasClients() {
+		web.ClientHandler.Broadcast <- entry
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return loglist3.LogList{}, errors.New("failed to download loglist")
-	}
+	// Each sink filters the entries by their type itself
+	fanout.Dispatch(entry)
+}
 
-	bodyBytes, readErr := io.ReadAll(resp.Body)
-	if readErr != nil {
-		log.Panic(readErr)
+// getAllLogs returns a list of all CT logs of the configured loglists. Multiple loglists are merged into one.
+// Loglists that can't be downloaded are skipped as long as at least one loglist was downloaded.
+func getAllLogs() (loglist3.LogList, error) {
+	var logLists []*loglist3.LogList
+
+	var lastErr error
+	for _, logListURL := range config.AppConfig.CTLogs.LogLists {
+		logList, err := downloadLogList(logListURL)
+		if err != nil {
+			log.Printf("Could not download loglist '%s': %s\n", logListURL, err)
+			lastErr = err
+
+			continue
+		}
+
+		logLists = append(logLists, logList)
 	}
 
-	allLogs, parseErr := loglist3.NewFromJSON(bodyBytes)
-	if parseErr != nil {
-		return loglist3.LogList{}, parseErr
+	if len(logLists) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no loglist configured")
+		}
+
+		return loglist3.LogList{}, lastErr
 	}
 
+	allLogs := mergeLogLists(logLists, config.AppConfig.CTLogs.LogListStatePreference)
+
 	// Add new ct logs to metrics
 	for _, operator := range allLogs.Operators {
 		for _, ctlog := range operator.Logs {
@@ -365,58 +1107,64 @@ func getAllLogs() (loglist3.LogList, error) {
 		}
 	}
 
-	return *allLogs, nil
+	return allLogs, nil
 }
 
+// downloadLogList downloads and decodes the loglist at the given url.
+func downloadLogList(logListURL string) (*loglist3.LogList, error) {
+	resp, err := http.Get(logListURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("failed to download loglist")
+	}
+
+	bodyBytes, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return loglist3.NewFromJSON(bodyBytes)
+}
+
+// normalizeCtlogURL removes the scheme, basic auth credentials and trailing slash from the given log url.
 func normalizeCtlogURL(input string) string {
 	input = strings.TrimPrefix(input, "https://")
 	input = strings.TrimPrefix(input, "http://")
 	input = strings.TrimSuffix(input, "/")
 
+	// Credentials must never end up in metrics or be used to tell logs apart
+	host, _, _ := strings.Cut(input, "/")
+	if at := strings.LastIndexByte(host, '@'); at >= 0 {
+		input = input[at+1:]
+	}
+
 	return input
 }
 
-func DownloadAndParseCSV(url string, keyColIndex, valueColIndex int, skipHeader bool) (map[string]string, error) {
+// RetryOptions configures how often and with which delays a failed download is retried.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of attempts.
+	MaxRetries int
+	// InitialDelay is the delay before the first retry. It is doubled after each attempt up to MaxDelay.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// DownloadAndParseCSV downloads the CSV file at the given url and returns a map built from the key and value columns.
+// Columns are selected either by their index (e.g. "18") or by the name in the header row (e.g. "CA Owner"), which
+// requires skipHeader to be true. Failed downloads are retried according to the given RetryOptions.
+// Retries stop as soon as the context is cancelled.
+func DownloadAndParseCSV(ctx context.Context, url, keyColumn, valueColumn string, skipHeader bool, retry RetryOptions) (map[string]string, error) {
 	// Initialize result map
 	result := make(map[string]string)
 
-	// Maximum number of retry attempts
-	maxRetries := 3
-	// Initial delay between retries (will be increased exponentially)
-	retryDelay := 1 * time.Second
-
-	var resp *http.Response
-	var err error
-
-	// Retry logic for the HTTP request
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Create HTTP client with timeout
-		client := &http.Client{
-			Timeout: 30 * time.Second,
-		}
-
-		// Make the request
-		resp, err = client.Get(url)
-		if err == nil && resp.StatusCode == http.StatusOK {
-			break // Success, exit the retry loop
-		}
-
-		// Check if we should retry
-		if attempt == maxRetries {
-			if err != nil {
-				return nil, fmt.Errorf("failed to download CSV after %d attempts: %w", maxRetries, err)
-			}
-			return nil, fmt.Errorf("failed to download CSV after %d attempts: status code %d", maxRetries, resp.StatusCode)
-		}
-
-		// If we got a response but it wasn't successful, close the body
-		if err == nil && resp.Body != nil {
-			resp.Body.Close()
-		}
-
-		// Wait before retrying with exponential backoff
-		time.Sleep(retryDelay)
-		retryDelay *= 2 // Exponential backoff
+	resp, err := downloadCSV(ctx, url, retry)
+	if err != nil {
+		return nil, err
 	}
 
 	// Don't forget to close the response body when we're done
@@ -431,12 +1179,19 @@ func DownloadAndParseCSV(url string, keyColIndex, valueColIndex int, skipHeader
 		return nil, fmt.Errorf("failed to read CSV first row: %w", err)
 	}
 
-	// Validate column indices
-	if keyColIndex < 0 || keyColIndex >= len(firstRow) {
-		return nil, fmt.Errorf("key column index %d is out of range (0-%d)", keyColIndex, len(firstRow)-1)
+	// Resolve and validate the columns against the first row
+	keyColIndex, err := resolveCSVColumn(keyColumn, firstRow, skipHeader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key column: %w", err)
 	}
-	if valueColIndex < 0 || valueColIndex >= len(firstRow) {
-		return nil, fmt.Errorf("value column index %d is out of range (0-%d)", valueColIndex, len(firstRow)-1)
+
+	valueColIndex, err := resolveCSVColumn(valueColumn, firstRow, skipHeader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value column: %w", err)
+	}
+
+	if skipHeader {
+		log.Printf("CSV: Using column '%s' (%d) as key and '%s' (%d) as value\n", firstRow[keyColIndex], keyColIndex, firstRow[valueColIndex], valueColIndex)
 	}
 
 	// If not skipping header, add the first row to the result
@@ -454,6 +1209,10 @@ func DownloadAndParseCSV(url string, keyColIndex, valueColIndex int, skipHeader
 			return nil, fmt.Errorf("error reading CSV record: %w", err)
 		}
 
+		if keyColIndex >= len(record) || valueColIndex >= len(record) {
+			continue
+		}
+
 		// Convert decoded bytes to lowercase hex without separators
 		decodedBytes, _ := base64.StdEncoding.DecodeString(record[keyColIndex])
 		hexKey := hex.EncodeToString(decodedBytes)
@@ -473,3 +1232,131 @@ func DownloadAndParseCSV(url string, keyColIndex, valueColIndex int, skipHeader
 
 	return result, nil
 }
+
+// downloadCSV downloads the CSV file at the given url. Failed downloads are retried according to the retry options.
+// The caller must close the body of the returned response.
+func downloadCSV(ctx context.Context, url string, retry RetryOptions) (*http.Response, error) {
+	maxRetries := max(retry.MaxRetries, 1)
+	// Delay between retries (will be increased exponentially)
+	retryDelay := retry.InitialDelay
+
+	var resp *http.Response
+	var err error
+
+	// Create HTTP client with timeout
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	// Retry logic for the HTTP request
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+		if reqErr != nil {
+			return nil, fmt.Errorf("failed to create request: %w", reqErr)
+		}
+
+		// Make the request
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			break // Success, exit the retry loop
+		}
+
+		// Check if we should retry
+		if attempt == maxRetries {
+			if err != nil {
+				return nil, fmt.Errorf("failed to download CSV after %d attempts: %w", maxRetries, err)
+			}
+			resp.Body.Close()
+
+			return nil, fmt.Errorf("failed to download CSV after %d attempts: status code %d", maxRetries, resp.StatusCode)
+		}
+
+		// If we got a response but it wasn't successful, close the body
+		if err == nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+
+		// Wait before retrying with exponential backoff
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("download of CSV cancelled: %w", ctx.Err())
+		case <-time.After(retryDelay):
+		}
+
+		retryDelay *= 2
+		if retry.MaxDelay > 0 && retryDelay > retry.MaxDelay {
+			retryDelay = retry.MaxDelay
+		}
+	}
+
+	return resp, nil
+}
+
+// resolveCSVColumn returns the index of the column selected by the given index or header name.
+// Header names are matched case-insensitively and can only be used if the first row is a header.
+func resolveCSVColumn(column string, firstRow []string, hasHeader bool) (int, error) {
+	column = strings.TrimSpace(column)
+
+	if index, err := strconv.Atoi(column); err == nil {
+		if index < 0 || index >= len(firstRow) {
+			return 0, fmt.Errorf("column index %d is out of range (0-%d)", index, len(firstRow)-1)
+		}
+
+		return index, nil
+	}
+
+	if !hasHeader {
+		return 0, fmt.Errorf("column '%s' can't be selected by name without a header row", column)
+	}
+
+	for index, name := range firstRow {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return index, nil
+		}
+	}
+
+	return 0, fmt.Errorf("column '%s' not found in header", column)
+}
+
+// shardYearRegex matches the year in the description of sharded logs, e.g. "Google 'Argon2025h1' log".
+var shardYearRegex = regexp.MustCompile(`20\d{2}`)
+
+// shouldWatchLog checks if a worker should be started for the given log according to the config.
+func shouldWatchLog(transparencyLog *loglist3.Log) bool {
+	minShardYear := config.AppConfig.CTLogs.MinShardYear
+	if minShardYear <= 0 {
+		return true
+	}
+
+	year, ok := shardYear(transparencyLog)
+
+	return ok && year >= minShardYear
+}
+
+// shardYear returns the year of the shard of the given log. It is taken from the start of the temporal interval
+// or - if the log has no temporal interval - from the log description. Returns false for logs without a year.
+func shardYear(transparencyLog *loglist3.Log) (int, bool) {
+	if transparencyLog.TemporalInterval != nil {
+		return transparencyLog.TemporalInterval.StartInclusive.Year(), true
+	}
+
+	match := shardYearRegex.FindString(transparencyLog.Description)
+	if match == "" {
+		return 0, false
+	}
+
+	year, err := strconv.Atoi(match)
+	if err != nil {
+		return 0, false
+	}
+
+	return year, true
+}
+
+// getLogID returns the base64 encoded log ID of the CT log with the given normalized url or an empty string if unknown.
+func getLogID(normalizedURL string) string {
+	logIDsMutex.RLock()
+	defer logIDsMutex.RUnlock()
+
+	return logIDs[normalizedURL]
+}
@@ -0,0 +1,107 @@
+package certificatetransparency
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// configuredEndpoints returns the endpoint overrides configured in ctlogs.endpoints for the given log url or nil if
+// the log uses the RFC 6962 endpoints.
+func configuredEndpoints(ctURL string) *config.LogEndpoints {
+	normalizedURL := normalizeCtlogURL(ctURL)
+	for i, configured := range config.AppConfig.CTLogs.Endpoints {
+		if normalizeCtlogURL(configured.URL) == normalizedURL {
+			return &config.AppConfig.CTLogs.Endpoints[i]
+		}
+	}
+
+	return nil
+}
+
+// endpointPath returns the path of an endpoint of the log with the given base path. Overrides starting with a slash
+// are absolute, all others are relative to the base path. An empty override keeps the default path.
+func endpointPath(basePath, defaultPath, override string) string {
+	if override == "" {
+		return basePath + defaultPath
+	}
+
+	if strings.HasPrefix(override, "/") {
+		return override
+	}
+
+	return basePath + "/" + override
+}
+
+// entryLink returns the url to fetch the entry with the given index from the log, respecting the configured endpoints.
+func entryLink(ctURL string, index int64) string {
+	defaultLink := fmt.Sprintf("%s%s?start=%d&end=%d", ctURL, ct.GetEntriesPath, index, index)
+
+	endpoints := configuredEndpoints(ctURL)
+	if endpoints == nil {
+		return defaultLink
+	}
+
+	linkURL, err := url.Parse(ensureScheme(ctURL))
+	if err != nil {
+		return defaultLink
+	}
+
+	startParam, endParam := entriesParams(endpoints)
+	linkURL.Path = endpointPath(strings.TrimRight(linkURL.Path, "/"), ct.GetEntriesPath, endpoints.GetEntries)
+	linkURL.RawQuery = fmt.Sprintf("%s=%d&%s=%d", url.QueryEscape(startParam), index, url.QueryEscape(endParam), index)
+
+	return linkURL.String()
+}
+
+// entriesParams returns the names of the start and end parameters of get-entries for the given endpoints.
+func entriesParams(endpoints *config.LogEndpoints) (string, string) {
+	startParam, endParam := "start", "end"
+	if endpoints.StartParam != "" {
+		startParam = endpoints.StartParam
+	}
+
+	if endpoints.EndParam != "" {
+		endParam = endpoints.EndParam
+	}
+
+	return startParam, endParam
+}
+
+// endpointTransport rewrites the RFC 6962 requests of the CT client to the configured endpoints of non-conforming logs.
+type endpointTransport struct {
+	endpoints *config.LogEndpoints
+	next      http.RoundTripper
+}
+
+func (t endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the given request
+	req = req.Clone(req.Context())
+
+	switch {
+	case strings.HasSuffix(req.URL.Path, ct.GetSTHPath):
+		basePath := strings.TrimSuffix(req.URL.Path, ct.GetSTHPath)
+		req.URL.Path = endpointPath(basePath, ct.GetSTHPath, t.endpoints.GetSTH)
+	case strings.HasSuffix(req.URL.Path, ct.GetEntriesPath):
+		basePath := strings.TrimSuffix(req.URL.Path, ct.GetEntriesPath)
+		req.URL.Path = endpointPath(basePath, ct.GetEntriesPath, t.endpoints.GetEntries)
+
+		startParam, endParam := entriesParams(t.endpoints)
+		query := req.URL.Query()
+		start, end := query.Get("start"), query.Get("end")
+		query.Del("start")
+		query.Del("end")
+		query.Set(startParam, start)
+		query.Set(endParam, end)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	req.URL.RawPath = ""
+
+	return t.next.RoundTrip(req)
+}
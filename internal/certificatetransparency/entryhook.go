@@ -0,0 +1,176 @@
+package certificatetransparency
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Actions of the entry hook for entries whose evaluation failed or timed out.
+const (
+	hookOnErrorKeep = "keep"
+	hookOnErrorDrop = "drop"
+)
+
+var (
+	// hookDropped counts the entries dropped by the entry hook, hookErrors the failed and hookTimeouts the timed out
+	// evaluations.
+	hookDropped  int64
+	hookErrors   int64
+	hookTimeouts int64
+
+	errHookTimeout = errors.New("evaluation timed out")
+)
+
+// hookEnv is the environment the hook expression is evaluated in. The expression can only read the entry.
+type hookEnv struct {
+	Entry certstream.Entry `expr:"entry"`
+}
+
+// hookResult is the outcome of a single evaluation of the hook expression.
+type hookResult struct {
+	keep bool
+	tags []string
+	err  error
+}
+
+// entryHook evaluates a user supplied expr expression (https://expr-lang.org) for each entry to decide whether the
+// entry is emitted and to tag it. The expression is compiled once and returns either a bool or a map with the
+// keys "keep" (bool) and "tags" (list of strings).
+type entryHook struct {
+	program *vm.Program
+	timeout time.Duration
+	onError string
+}
+
+// newEntryHook compiles the given expression or, if it is empty, the expression in the given file.
+func newEntryHook(expression, file string, timeout time.Duration, onError string) (*entryHook, error) {
+	if expression == "" && file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		expression = string(content)
+	}
+
+	if strings.TrimSpace(expression) == "" {
+		return nil, errors.New("no expression configured")
+	}
+
+	program, err := expr.Compile(expression, expr.Env(hookEnv{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &entryHook{program: program, timeout: timeout, onError: onError}, nil
+}
+
+// apply evaluates the expression for the entry and adds the returned tags to it. It returns false if the entry
+// should be dropped. Failed evaluations are counted and handled according to the onError action.
+func (h *entryHook) apply(entry *certstream.Entry) bool {
+	result := h.evaluate(*entry)
+	if result.err != nil {
+		if errors.Is(result.err, errHookTimeout) {
+			atomic.AddInt64(&hookTimeouts, 1)
+		} else {
+			atomic.AddInt64(&hookErrors, 1)
+		}
+
+		result.keep = h.onError == hookOnErrorKeep
+	}
+
+	if !result.keep {
+		atomic.AddInt64(&hookDropped, 1)
+		return false
+	}
+
+	entry.Data.Tags = append(entry.Data.Tags, result.tags...)
+
+	return true
+}
+
+// evaluate runs the expression for a copy of the entry. Expressions always terminate, so an evaluation exceeding
+// the timeout is abandoned and finishes in the background.
+func (h *entryHook) evaluate(entry certstream.Entry) hookResult {
+	results := make(chan hookResult, 1)
+
+	go func() {
+		output, err := expr.Run(h.program, hookEnv{Entry: entry})
+		if err != nil {
+			results <- hookResult{err: err}
+			return
+		}
+
+		results <- parseHookOutput(output)
+	}()
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		return result
+	case <-timer.C:
+		return hookResult{err: errHookTimeout}
+	}
+}
+
+// parseHookOutput converts the value returned by the expression into a hookResult.
+func parseHookOutput(output any) hookResult {
+	switch value := output.(type) {
+	case bool:
+		return hookResult{keep: value}
+	case map[string]any:
+		result := hookResult{keep: true}
+
+		if keep, ok := value["keep"]; ok {
+			if result.keep, ok = keep.(bool); !ok {
+				return hookResult{err: fmt.Errorf("'keep' must be a bool, got %T", keep)}
+			}
+		}
+
+		if tags, ok := value["tags"]; ok {
+			list, isList := tags.([]any)
+			if !isList {
+				return hookResult{err: fmt.Errorf("'tags' must be a list, got %T", tags)}
+			}
+
+			for _, tag := range list {
+				tagString, isString := tag.(string)
+				if !isString {
+					return hookResult{err: fmt.Errorf("tags must be strings, got %T", tag)}
+				}
+
+				result.tags = append(result.tags, tagString)
+			}
+		}
+
+		return result
+	default:
+		return hookResult{err: fmt.Errorf("expression must return a bool or a map, got %T", output)}
+	}
+}
+
+// GetHookDropped returns the number of entries dropped by the entry hook.
+func GetHookDropped() int64 {
+	return atomic.LoadInt64(&hookDropped)
+}
+
+// GetHookErrors returns the number of failed evaluations of the entry hook.
+func GetHookErrors() int64 {
+	return atomic.LoadInt64(&hookErrors)
+}
+
+// GetHookTimeouts returns the number of evaluations of the entry hook that exceeded the timeout.
+func GetHookTimeouts() int64 {
+	return atomic.LoadInt64(&hookTimeouts)
+}
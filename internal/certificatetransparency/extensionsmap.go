@@ -0,0 +1,106 @@
+package certificatetransparency
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+
+	"github.com/google/certificate-transparency-go/asn1"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// extensionName maps the OIDs of known extensions to the names used as keys of the extensions map. The names
+// match the json names of the typed fields of certstream.Extensions where they exist.
+var extensionName = []struct {
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{x509.OIDExtensionAuthorityInfoAccess, "authorityInfoAccess"},
+	{x509.OIDExtensionAuthorityKeyId, "authorityKeyIdentifier"},
+	{x509.OIDExtensionBasicConstraints, "basicConstraints"},
+	{x509.OIDExtensionCertificatePolicies, "certificatePolicies"},
+	{x509.OIDExtensionCTSCT, "ctlSignedCertificateTimestamp"},
+	{x509.OIDExtensionExtendedKeyUsage, "extendedKeyUsage"},
+	{x509.OIDExtensionKeyUsage, "keyUsage"},
+	{x509.OIDExtensionSubjectAltName, "subjectAltName"},
+	{x509.OIDExtensionSubjectKeyId, "subjectKeyIdentifier"},
+	{x509.OIDExtensionCTPoison, "ctlPoisonByte"},
+	{x509.OIDExtensionCRLDistributionPoints, "crlDistributionPoints"},
+	{x509.OIDExtensionNameConstraints, "nameConstraints"},
+	{x509.OIDExtensionIssuerAltName, "issuerAltName"},
+	{x509.OIDExtensionSubjectDirectoryAttributes, "subjectDirectoryAttributes"},
+	{x509.OIDExtensionPolicyConstraints, "policyConstraints"},
+	{x509.OIDExtensionPolicyMappings, "policyMappings"},
+	{x509.OIDExtensionInhibitAnyPolicy, "inhibitAnyPolicy"},
+	{x509.OIDExtensionFreshestCRL, "freshestCRL"},
+	{x509.OIDExtensionSubjectInfoAccess, "subjectInfoAccess"},
+}
+
+// buildExtensionsMap returns all extensions of the certificate keyed by their name or - for unknown extensions - their
+// OID in dotted notation. Values are taken from the already decoded typed extensions where possible, all other
+// values are the base64 encoded DER value of the extension. Only the first of repeated extensions is kept.
+func buildExtensionsMap(cert *x509.Certificate, typed *certstream.Extensions) map[string]certstream.ExtensionValue {
+	extensions := make(map[string]certstream.ExtensionValue, len(cert.Extensions))
+
+	for _, extension := range cert.Extensions {
+		name := extension.Id.String()
+		for _, known := range extensionName {
+			if extension.Id.Equal(known.oid) {
+				name = known.name
+				break
+			}
+		}
+
+		if _, exists := extensions[name]; exists {
+			continue
+		}
+
+		value, decoded := typedExtensionValue(name, typed)
+		if !decoded {
+			value = base64.StdEncoding.EncodeToString(extension.Value)
+		}
+
+		extensions[name] = certstream.ExtensionValue{Critical: extension.Critical, Value: value}
+	}
+
+	return extensions
+}
+
+// typedExtensionValue returns the decoded value of the extension with the given name, if it was decoded.
+func typedExtensionValue(name string, typed *certstream.Extensions) (string, bool) {
+	var value *string
+
+	switch name {
+	case "authorityInfoAccess":
+		value = typed.AuthorityInfoAccess
+	case "crlDistributionPoints":
+		value = typed.CRLDistributionPoints
+	case "authorityKeyIdentifier":
+		value = typed.AuthorityKeyIdentifier
+	case "basicConstraints":
+		if typed.BasicConstraints != nil && typed.BasicConstraintsPathLen != nil {
+			return *typed.BasicConstraints + ", pathlen:" + strconv.Itoa(*typed.BasicConstraintsPathLen), true
+		}
+
+		value = typed.BasicConstraints
+	case "keyUsage":
+		value = typed.KeyUsage
+	case "subjectAltName":
+		value = typed.SubjectAltName
+	case "subjectKeyIdentifier":
+		value = typed.SubjectKeyIdentifier
+	case "ctlPoisonByte":
+		// The poison extension has a NULL value, its presence is all that matters
+		return "", true
+	case "certificatePolicies":
+		return strings.Join(typed.CertificatePolicies, ", "), true
+	}
+
+	if value == nil {
+		return "", false
+	}
+
+	return *value, true
+}
@@ -0,0 +1,94 @@
+package certificatetransparency
+
+import (
+	"container/list"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+var (
+	// dedupHits counts the entries suppressed because their fingerprint was already emitted within the dedup window.
+	dedupHits int64
+	// dedupEntries is the number of fingerprints currently remembered by the dedup window.
+	dedupEntries int64
+)
+
+// fingerprintDedup suppresses entries whose leaf certificate (by SHA-256 fingerprint) was already emitted within the
+// window, e.g. because the certificate was logged to several logs. Fingerprints are forgotten strictly by age, so the
+// window is measured from the emitted entry and further sightings within the window don't extend it. The number of
+// remembered fingerprints is only bounded by the number of certificates seen per window.
+type fingerprintDedup struct {
+	window time.Duration
+	seen   map[string]struct{}
+	// order holds the fingerprints in the order they were emitted, so the oldest ones can be evicted first.
+	order *list.List
+}
+
+type dedupItem struct {
+	fingerprint string
+	emittedAt   time.Time
+}
+
+// newFingerprintDedup creates a fingerprintDedup with the given window.
+func newFingerprintDedup(window time.Duration) *fingerprintDedup {
+	return &fingerprintDedup{window: window, seen: make(map[string]struct{}), order: list.New()}
+}
+
+// suppress checks if an entry with the same fingerprint was emitted within the window and remembers the entry
+// otherwise. Entries without a fingerprint are never suppressed.
+func (d *fingerprintDedup) suppress(entry *certstream.Entry, now time.Time) bool {
+	d.evict(now)
+
+	fingerprint := entry.Data.LeafCert.SHA256
+	if fingerprint == "" {
+		return false
+	}
+
+	if _, ok := d.seen[fingerprint]; ok {
+		atomic.AddInt64(&dedupHits, 1)
+		return true
+	}
+
+	d.seen[fingerprint] = struct{}{}
+	d.order.PushBack(dedupItem{fingerprint: fingerprint, emittedAt: now})
+	atomic.StoreInt64(&dedupEntries, int64(len(d.seen)))
+
+	return false
+}
+
+// evict forgets the fingerprints that were emitted longer ago than the window.
+func (d *fingerprintDedup) evict(now time.Time) {
+	for element := d.order.Front(); element != nil; element = d.order.Front() {
+		item := element.Value.(dedupItem)
+		if now.Sub(item.emittedAt) < d.window {
+			break
+		}
+
+		d.order.Remove(element)
+		delete(d.seen, item.fingerprint)
+	}
+
+	atomic.StoreInt64(&dedupEntries, int64(len(d.seen)))
+}
+
+// GetDedupWindow returns the configured dedup window or zero if the dedup window is disabled.
+func GetDedupWindow() time.Duration {
+	if !config.AppConfig.Processing.DedupWindow.Enabled {
+		return 0
+	}
+
+	return config.AppConfig.Processing.DedupWindow.Window
+}
+
+// GetDedupHits returns the number of entries suppressed by the dedup window.
+func GetDedupHits() int64 {
+	return atomic.LoadInt64(&dedupHits)
+}
+
+// GetDedupEntries returns the number of fingerprints currently remembered by the dedup window.
+func GetDedupEntries() int64 {
+	return atomic.LoadInt64(&dedupEntries)
+}
@@ -0,0 +1,93 @@
+package certificatetransparency
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/web"
+)
+
+// InclusionProof is the audit path proving the inclusion of an entry in the tree of the log's current STH (RFC 6962, 4.5).
+// Hashes are base64 encoded.
+type InclusionProof struct {
+	LogURL       string   `json:"log_url"`
+	Index        int64    `json:"index"`
+	LeafHash     []byte   `json:"leaf_hash"`
+	TreeSize     uint64   `json:"tree_size"`
+	STHTimestamp uint64   `json:"sth_timestamp"`
+	RootHash     []byte   `json:"root_hash"`
+	AuditPath    [][]byte `json:"audit_path"`
+}
+
+// InclusionProof fetches the inclusion proof of the entry with the given index of a watched log against the current
+// STH of the log. Errors of the log, e.g. logs that don't serve proofs, are returned as is.
+func (w *Watcher) InclusionProof(ctx context.Context, logURL string, index int64) (*InclusionProof, error) {
+	if index < 0 {
+		return nil, fmt.Errorf("%w: index must not be negative", web.ErrBadRequest)
+	}
+
+	normalizedURL := normalizeCtlogURL(logURL)
+
+	var ctURL, operatorName string
+	var credentials *logCredentials
+
+	w.workersMutex.RLock()
+	for _, ctWorker := range w.workers {
+		if normalizeCtlogURL(ctWorker.ctURL) == normalizedURL {
+			ctURL, operatorName, credentials = ctWorker.ctURL, ctWorker.operatorName, ctWorker.credentials
+			break
+		}
+	}
+	w.workersMutex.RUnlock()
+
+	// Only watched logs can be queried, so the endpoint can't be used to send requests to arbitrary hosts
+	if ctURL == "" {
+		return nil, fmt.Errorf("%w: log '%s' is not watched", web.ErrNotFound, logURL)
+	}
+
+	logClient, err := newLogClient(ctURL, operatorName, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	sth, err := logClient.GetSTH(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get STH: %w", err)
+	}
+
+	if uint64(index) >= sth.TreeSize {
+		return nil, fmt.Errorf("%w: index %d is not in the tree of size %d", web.ErrNotFound, index, sth.TreeSize)
+	}
+
+	entries, err := logClient.GetRawEntries(ctx, index, index)
+	if err != nil {
+		return nil, fmt.Errorf("could not get entry %d: %w", index, err)
+	}
+
+	if len(entries.Entries) == 0 {
+		return nil, fmt.Errorf("log returned no entry for index %d", index)
+	}
+
+	// The leaf hash is the hash of the MerkleTreeLeaf with the leaf prefix 0x00 (RFC 6962, 2.1)
+	leafHash := sha256.Sum256(append([]byte{0}, entries.Entries[0].LeafInput...))
+
+	proof, err := logClient.GetProofByHash(ctx, leafHash[:], sth.TreeSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not get proof: %w", err)
+	}
+
+	if proof.LeafIndex != index {
+		return nil, fmt.Errorf("log returned the proof of index %d instead of %d", proof.LeafIndex, index)
+	}
+
+	return &InclusionProof{
+		LogURL:       ctURL,
+		Index:        index,
+		LeafHash:     leafHash[:],
+		TreeSize:     sth.TreeSize,
+		STHTimestamp: sth.Timestamp,
+		RootHash:     sth.SHA256RootHash[:],
+		AuditPath:    proof.AuditPath,
+	}, nil
+}
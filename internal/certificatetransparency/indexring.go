@@ -0,0 +1,46 @@
+package certificatetransparency
+
+import "sync"
+
+// recentIndicesSize is the number of recently emitted indices remembered per worker.
+const recentIndicesSize = 2048
+
+// indexRing remembers the most recently emitted indices of a single CT log. It is used to suppress entries that are
+// re-delivered by the scanner, e.g. when a worker is restarted and the scanner overlaps with already emitted indices.
+type indexRing struct {
+	mu      sync.Mutex
+	indices []int64
+	seen    map[int64]struct{}
+	next    int
+}
+
+// newIndexRing creates a new indexRing that remembers up to size indices.
+func newIndexRing(size int) *indexRing {
+	return &indexRing{
+		indices: make([]int64, 0, size),
+		seen:    make(map[int64]struct{}, size),
+	}
+}
+
+// add records the given index. It returns false if the index was already recorded recently.
+func (r *indexRing) add(index int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.seen[index]; ok {
+		return false
+	}
+
+	if len(r.indices) < cap(r.indices) {
+		r.indices = append(r.indices, index)
+	} else {
+		// Overwrite the oldest index
+		delete(r.seen, r.indices[r.next])
+		r.indices[r.next] = index
+		r.next = (r.next + 1) % len(r.indices)
+	}
+
+	r.seen[index] = struct{}{}
+
+	return true
+}
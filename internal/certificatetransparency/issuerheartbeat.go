@@ -0,0 +1,86 @@
+package certificatetransparency
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+// Keys the issuer heartbeat can group the entries by.
+const (
+	heartbeatKeyCAOwner = "ca_owner"
+	heartbeatKeyIssuer  = "issuer"
+)
+
+// heartbeatSuppressed counts the entries suppressed because their issuer was already emitted in the current window.
+var heartbeatSuppressed int64
+
+// issuerHeartbeat only lets the first entry per issuer and window pass, which turns the stream into a feed of the
+// issuers that are currently active. The seen issuers are reset at the start of each window.
+type issuerHeartbeat struct {
+	key         string
+	window      time.Duration
+	maxEntries  int
+	windowStart time.Time
+	seen        map[string]struct{}
+}
+
+// newIssuerHeartbeat creates an issuerHeartbeat grouping entries by the given key (heartbeatKeyCAOwner or
+// heartbeatKeyIssuer). At most maxEntries issuers are remembered per window, entries of further issuers pass.
+func newIssuerHeartbeat(key string, window time.Duration, maxEntries int) *issuerHeartbeat {
+	return &issuerHeartbeat{
+		key:         key,
+		window:      window,
+		maxEntries:  maxEntries,
+		windowStart: time.Now(),
+		seen:        make(map[string]struct{}),
+	}
+}
+
+// suppress checks if an entry of the same issuer was already emitted in the current window.
+// Entries whose issuer can't be determined are never suppressed.
+func (h *issuerHeartbeat) suppress(entry *certstream.Entry, now time.Time) bool {
+	if now.Sub(h.windowStart) >= h.window {
+		h.windowStart = now
+		clear(h.seen)
+	}
+
+	issuer := h.issuerKey(entry)
+	if issuer == "" {
+		return false
+	}
+
+	if _, seen := h.seen[issuer]; seen {
+		atomic.AddInt64(&heartbeatSuppressed, 1)
+		return true
+	}
+
+	if len(h.seen) < h.maxEntries {
+		h.seen[issuer] = struct{}{}
+	}
+
+	return false
+}
+
+// issuerKey returns the CA owner or the SHA-256 fingerprint of the issuing certificate of the entry. Without a known
+// CA owner or without a chain, the authority key identifier is used instead.
+func (h *issuerHeartbeat) issuerKey(entry *certstream.Entry) string {
+	leafCert := &entry.Data.LeafCert
+
+	switch {
+	case h.key == heartbeatKeyCAOwner && leafCert.CAOwner != "":
+		return leafCert.CAOwner
+	case h.key == heartbeatKeyIssuer && len(entry.Data.Chain) > 0:
+		return entry.Data.Chain[0].SHA256
+	case leafCert.Extensions.AuthorityKeyIdentifier != nil:
+		return *leafCert.Extensions.AuthorityKeyIdentifier
+	default:
+		return ""
+	}
+}
+
+// GetHeartbeatSuppressed returns the number of entries suppressed by the issuer heartbeat.
+func GetHeartbeatSuppressed() int64 {
+	return atomic.LoadInt64(&heartbeatSuppressed)
+}
@@ -0,0 +1,65 @@
+package certificatetransparency
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	"github.com/google/certificate-transparency-go/client"
+)
+
+// lag returns the number of entries between the next index to be delivered by the worker and the latest known
+// tree size of the log.
+func (w *worker) lag() int64 {
+	nextIndex := max(w.lastIndex.Load()+1, w.startIndex.Load())
+
+	return max(w.latestTreeSize.Load()-nextIndex, 0)
+}
+
+// isLagging checks the lag of the worker against the configured absolute and relative thresholds.
+func isLagging(lag, treeSize int64) bool {
+	lagConfig := config.AppConfig.CTLogs.LagAlert
+	if lagConfig.MaxEntries > 0 && lag > lagConfig.MaxEntries {
+		return true
+	}
+
+	return lagConfig.MaxRatio > 0 && treeSize > 0 && float64(lag)/float64(treeSize) > lagConfig.MaxRatio
+}
+
+// watchLag periodically refreshes the latest tree size of the log and logs an alert when the lag of the worker
+// exceeds the configured thresholds (and once it recovered). This method is blocking until the context is cancelled.
+func (w *worker) watchLag(ctx context.Context, jsonClient *client.LogClient) {
+	ticker := time.NewTicker(config.AppConfig.CTLogs.LagAlert.STHRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sth, err := jsonClient.GetSTH(ctx)
+		if err != nil {
+			log.Printf("Could not refresh STH for '%s': %s\n", w.ctURL, err)
+			continue
+		}
+
+		treeSize := int64(sth.TreeSize)
+		w.latestTreeSize.Store(treeSize)
+
+		lag := w.lag()
+		lagging := isLagging(lag, treeSize)
+		if lagging == w.lagging.Swap(lagging) {
+			continue
+		}
+
+		if lagging {
+			log.Printf("Worker for '%s' is lagging behind: %d entries (tree size %d)\n", w.ctURL, lag, treeSize)
+		} else {
+			log.Printf("Worker for '%s' caught up again: %d entries behind (tree size %d)\n", w.ctURL, lag, treeSize)
+		}
+	}
+}
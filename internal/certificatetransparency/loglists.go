@@ -0,0 +1,94 @@
+package certificatetransparency
+
+import (
+	"github.com/google/certificate-transparency-go/loglist3"
+)
+
+// statePermissiveness ranks the log states from the most restrictive (rejected) to the most permissive (usable).
+var statePermissiveness = map[loglist3.LogStatus]int{
+	loglist3.UndefinedLogStatus: 0,
+	loglist3.RejectedLogStatus:  1,
+	loglist3.RetiredLogStatus:   2,
+	loglist3.PendingLogStatus:   3,
+	loglist3.ReadOnlyLogStatus:  4,
+	loglist3.QualifiedLogStatus: 5,
+	loglist3.UsableLogStatus:    6,
+}
+
+// mergeLogLists merges the given loglists into a single loglist, de-duplicating the logs by their normalized url.
+// A log listed multiple times stays with the operator of the first list and takes the metadata of the list that
+// provides the most fields. If the lists disagree on the state of a log, the "permissive" preference picks the most
+// permissive state, "first" keeps the state of the first list that has one.
+func mergeLogLists(logLists []*loglist3.LogList, statePreference string) loglist3.LogList {
+	var merged loglist3.LogList
+	operators := make(map[string]*loglist3.Operator)
+	logs := make(map[string]*loglist3.Log)
+
+	for _, logList := range logLists {
+		for _, operator := range logList.Operators {
+			for _, transparencyLog := range operator.Logs {
+				url := normalizeCtlogURL(transparencyLog.URL)
+
+				if existing, ok := logs[url]; ok {
+					mergeLog(existing, transparencyLog, statePreference)
+					continue
+				}
+
+				mergedOperator, ok := operators[operator.Name]
+				if !ok {
+					mergedOperator = &loglist3.Operator{Name: operator.Name, Email: operator.Email}
+					operators[operator.Name] = mergedOperator
+					merged.Operators = append(merged.Operators, mergedOperator)
+				}
+
+				mergedLog := *transparencyLog
+				logs[url] = &mergedLog
+				mergedOperator.Logs = append(mergedOperator.Logs, &mergedLog)
+			}
+		}
+	}
+
+	return merged
+}
+
+// mergeLog merges the candidate into the already known log in place.
+func mergeLog(existing, candidate *loglist3.Log, statePreference string) {
+	state := existing.State
+	if state == nil || (statePreference == "permissive" &&
+		statePermissiveness[candidate.State.LogStatus()] > statePermissiveness[state.LogStatus()]) {
+		state = candidate.State
+	}
+
+	// Keep the url of the existing log so the normalized url (and thus the worker) stays the same
+	if logRichness(candidate) > logRichness(existing) {
+		url := existing.URL
+		*existing = *candidate
+		existing.URL = url
+	}
+
+	existing.State = state
+}
+
+// logRichness returns the number of optional metadata fields set for the given log.
+func logRichness(transparencyLog *loglist3.Log) int {
+	fields := []bool{
+		transparencyLog.Description != "",
+		len(transparencyLog.LogID) > 0,
+		len(transparencyLog.Key) > 0,
+		transparencyLog.DNS != "",
+		transparencyLog.MMD > 0,
+		len(transparencyLog.PreviousOperators) > 0,
+		transparencyLog.State != nil,
+		transparencyLog.TemporalInterval != nil,
+		transparencyLog.Type != "",
+	}
+
+	richness := 0
+	for _, set := range fields {
+		if set {
+			richness++
+		}
+	}
+
+	return richness
+}
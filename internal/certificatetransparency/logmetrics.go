@@ -1,6 +1,11 @@
 package certificatetransparency
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
 
 type (
 	// OperatorLogs is a map of operator names to a list of CT log urls, operated by said operator.
@@ -14,11 +19,51 @@ type (
 var (
 	processedCerts    int64
 	processedPrecerts int64
-	metrics           = LogMetrics{metrics: make(CTMetrics)}
+	// regDomainFallbacks counts the domains for which the registrable domain could not be computed safely.
+	regDomainFallbacks int64
+	// duplicateIndices counts the entries that were suppressed because their index was already emitted by the worker.
+	duplicateIndices int64
+	// staleSkipped counts the entries that were skipped while catching up, because they were older than max_catch_up_age.
+	staleSkipped int64
+	// emptyDERs counts the entries that were dropped (or emitted as degraded entries) because they contained no certificate data.
+	emptyDERs int64
+	// notYetValidCerts counts the certificates whose NotBefore was in the future when they were seen.
+	notYetValidCerts int64
+	metrics          = LogMetrics{metrics: make(CTMetrics)}
+	// conversionFailures counts the raw log entries per log that could not be converted to a ct.LogEntry.
+	conversionFailures = LogMetrics{metrics: make(CTMetrics)}
+	// caCertificates and endEntityCertificates count the emitted certificates by IsCA, split by whether the certificate
+	// was the logged certificate of an entry or part of its chain. Only written by the certHandler.
+	caCertificates        certPositionCounts
+	endEntityCertificates certPositionCounts
+	// certQueue references the channel between the ct workers and the cert handler for the queue metrics.
+	certQueue atomic.Pointer[chan certstream.Entry]
 )
 
+// certPositionCounts counts certificates by their position in an entry.
+type certPositionCounts struct {
+	entry atomic.Int64
+	chain atomic.Int64
+}
+
+// countCertificateTypes counts the logged certificate and the chain certificates of the entry as CA or end-entity certificates.
+func countCertificateTypes(entry *certstream.Entry) {
+	countersFor := func(isCA bool) *certPositionCounts {
+		if isCA {
+			return &caCertificates
+		}
+
+		return &endEntityCertificates
+	}
+
+	countersFor(entry.Data.LeafCert.IsCA).entry.Add(1)
+	for i := range entry.Data.Chain {
+		countersFor(entry.Data.Chain[i].IsCA).chain.Add(1)
+	}
+}
+
 // LogMetrics is a struct that holds a map of metrics for each CT log grouped by operator.
-// Metrics can be accessed and written concurrently through the Get, Set and Inc methods.
+// Metrics can be accessed and written concurrently through the Get, Set and Inc methods. The zero value is ready to use.
 type LogMetrics struct {
 	mutex   sync.RWMutex
 	metrics CTMetrics
@@ -62,19 +107,29 @@ func (m *LogMetrics) OperatorLogMapping() OperatorLogs {
 	return logOperators
 }
 
+// operatorMetric returns the metrics of the operator, creating them if they don't exist yet. The mutex must be locked.
+func (m *LogMetrics) operatorMetric(operator string) OperatorMetric {
+	if m.metrics == nil {
+		m.metrics = make(CTMetrics)
+	}
+
+	if _, ok := m.metrics[operator]; !ok {
+		m.metrics[operator] = make(OperatorMetric)
+	}
+
+	return m.metrics[operator]
+}
+
 // Init initializes the internal metrics map with the given operator names and CT log urls if it doesn't exist yet.
 func (m *LogMetrics) Init(operator, url string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	// if the operator does not exist, create a new entry
-	if _, ok := m.metrics[operator]; !ok {
-		m.metrics[operator] = make(OperatorMetric)
-	}
+	operatorMetric := m.operatorMetric(operator)
 
 	// if the operator exists but the url does not, create a new entry
-	if _, ok := m.metrics[operator][url]; !ok {
-		m.metrics[operator][url] = 0
+	if _, ok := operatorMetric[url]; !ok {
+		operatorMetric[url] = 0
 	}
 }
 
@@ -84,11 +139,7 @@ func (m *LogMetrics) Get(operator, url string) int64 {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if _, ok := m.metrics[operator]; !ok {
-		m.metrics[operator] = make(OperatorMetric)
-	}
-
-	return m.metrics[operator][url]
+	return m.operatorMetric(operator)[url]
 }
 
 // Set the metric for a given operator and ct url.
@@ -96,23 +147,16 @@ func (m *LogMetrics) Set(operator, url string, value int64) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if _, ok := m.metrics[operator]; !ok {
-		m.metrics[operator] = make(OperatorMetric)
-	}
-
-	m.metrics[operator][url] = value
+	m.operatorMetric(operator)[url] = value
 }
 
-// Inc the metric for a given operator and ct url.
+// Inc the metric for a given operator and ct url. Logs that were not initialized via Init are added to the map, as
+// they always were. They are only exported because the per-log gauges are registered again on every scrape.
 func (m *LogMetrics) Inc(operator, url string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if _, ok := m.metrics[operator]; !ok {
-		m.metrics[operator] = make(OperatorMetric)
-	}
-
-	m.metrics[operator][url]++
+	m.operatorMetric(operator)[url]++
 }
 
 func GetProcessedCerts() int64 {
@@ -123,6 +167,42 @@ func GetProcessedPrecerts() int64 {
 	return processedPrecerts
 }
 
+// GetCACertificates returns the number of CA certificates that were the logged certificate of an entry (entry)
+// or part of the chain of an entry (chain).
+func GetCACertificates() (entry, chain int64) {
+	return caCertificates.entry.Load(), caCertificates.chain.Load()
+}
+
+// GetEndEntityCertificates returns the number of end-entity certificates that were the logged certificate of an entry
+// (entry) or part of the chain of an entry (chain).
+func GetEndEntityCertificates() (entry, chain int64) {
+	return endEntityCertificates.entry.Load(), endEntityCertificates.chain.Load()
+}
+
+func GetRegDomainFallbacks() int64 {
+	return atomic.LoadInt64(&regDomainFallbacks)
+}
+
+func GetDuplicateIndices() int64 {
+	return atomic.LoadInt64(&duplicateIndices)
+}
+
+func GetStaleSkipped() int64 {
+	return atomic.LoadInt64(&staleSkipped)
+}
+
+func GetEmptyDERs() int64 {
+	return atomic.LoadInt64(&emptyDERs)
+}
+
+func GetNotYetValidCerts() int64 {
+	return atomic.LoadInt64(&notYetValidCerts)
+}
+
+func GetConversionFailures() CTMetrics {
+	return conversionFailures.GetCTMetrics()
+}
+
 func GetCertMetrics() CTMetrics {
 	return metrics.GetCTMetrics()
 }
@@ -130,3 +210,23 @@ func GetCertMetrics() CTMetrics {
 func GetLogOperators() map[string][]string {
 	return metrics.OperatorLogMapping()
 }
+
+// GetQueueLength returns the number of entries currently waiting in the queue between the ct workers and the broadcaster.
+func GetQueueLength() int {
+	queue := certQueue.Load()
+	if queue == nil {
+		return 0
+	}
+
+	return len(*queue)
+}
+
+// GetQueueCapacity returns the capacity of the queue between the ct workers and the broadcaster.
+func GetQueueCapacity() int {
+	queue := certQueue.Load()
+	if queue == nil {
+		return 0
+	}
+
+	return cap(*queue)
+}
@@ -0,0 +1,91 @@
+package certificatetransparency
+
+import (
+	"container/list"
+	"time"
+)
+
+// lruCache is a size-bounded least recently used cache, whose entries additionally expire after a fixed ttl.
+// It is not safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+}
+
+type lruItem[K comparable, V any] struct {
+	key     K
+	value   V
+	addedAt time.Time
+}
+
+// newLRUCache creates a new lruCache that holds at most capacity entries. A ttl of zero disables expiry.
+func newLRUCache[K comparable, V any](capacity int, ttl time.Duration) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// get returns the value for the given key if it exists and has not expired yet.
+func (c *lruCache[K, V]) get(key K, now time.Time) (V, bool) {
+	element, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	item := element.Value.(*lruItem[K, V])
+	if c.ttl > 0 && now.Sub(item.addedAt) > c.ttl {
+		c.remove(element)
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return item.value, true
+}
+
+// add adds or replaces the value for the given key. If the cache is full, the least recently used entry is evicted.
+func (c *lruCache[K, V]) add(key K, value V, now time.Time) {
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*lruItem[K, V])
+		item.value = value
+		item.addedAt = now
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	if c.capacity > 0 && c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem[K, V]{key: key, value: value, addedAt: now})
+}
+
+// len returns the number of entries in the cache, including expired entries that were not evicted yet.
+func (c *lruCache[K, V]) len() int {
+	return c.order.Len()
+}
+
+// keys returns the keys of all entries in the cache from the most to the least recently used.
+func (c *lruCache[K, V]) keys() []K {
+	keys := make([]K, 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		keys = append(keys, element.Value.(*lruItem[K, V]).key)
+	}
+
+	return keys
+}
+
+func (c *lruCache[K, V]) remove(element *list.Element) {
+	item := c.order.Remove(element).(*lruItem[K, V])
+	delete(c.items, item.key)
+}
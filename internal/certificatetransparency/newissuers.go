@@ -0,0 +1,115 @@
+package certificatetransparency
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+// newIssuersSaveInterval is the interval in which the seen issuers are written to the state file.
+const newIssuersSaveInterval = 10 * time.Minute
+
+// newIssuers counts the entries that were flagged because their issuer was not seen before.
+var newIssuers int64
+
+// newIssuerTracker remembers the authority key identifiers of all issuers seen and flags the first entry of each new
+// issuer. The seen issuers are optionally persisted in a state file, so they survive restarts.
+type newIssuerTracker struct {
+	seen      *lruCache[string, struct{}]
+	stateFile string
+	lastSaved time.Time
+	changed   bool
+}
+
+// newNewIssuerTracker creates a new newIssuerTracker remembering up to maxEntries issuers. If a state file is given,
+// the issuers seen in previous runs are loaded from it.
+func newNewIssuerTracker(maxEntries int, stateFile string) *newIssuerTracker {
+	tracker := &newIssuerTracker{
+		seen:      newLRUCache[string, struct{}](maxEntries, 0),
+		stateFile: stateFile,
+		lastSaved: time.Now(),
+	}
+
+	if stateFile != "" {
+		if err := tracker.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Could not load seen issuers from '%s': %s\n", stateFile, err)
+		}
+	}
+
+	return tracker
+}
+
+// track flags the entry with new_issuer if the authority key identifier of its certificate was not seen before.
+// Certificates without an authority key identifier are never flagged.
+func (t *newIssuerTracker) track(entry *certstream.Entry) {
+	aki := entry.Data.LeafCert.Extensions.AuthorityKeyIdentifier
+	if aki == nil || *aki == "" {
+		return
+	}
+
+	now := time.Now()
+	if _, seen := t.seen.get(*aki, now); !seen {
+		t.seen.add(*aki, struct{}{}, now)
+		t.changed = true
+		entry.Data.LeafCert.NewIssuer = true
+		atomic.AddInt64(&newIssuers, 1)
+	}
+
+	if t.changed && now.Sub(t.lastSaved) > newIssuersSaveInterval {
+		t.save()
+	}
+}
+
+// load reads the seen issuers from the state file, one authority key identifier per line.
+func (t *newIssuerTracker) load() error {
+	file, err := os.Open(t.stateFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if aki := strings.TrimSpace(scanner.Text()); aki != "" {
+			t.seen.add(aki, struct{}{}, now)
+		}
+	}
+
+	log.Printf("Loaded %d seen issuers from '%s'\n", t.seen.len(), t.stateFile)
+
+	return scanner.Err()
+}
+
+// save writes the seen issuers to the state file. The file is replaced atomically, so a crash while saving
+// doesn't lose the previous state.
+func (t *newIssuerTracker) save() {
+	t.lastSaved = time.Now()
+	if t.stateFile == "" || !t.changed {
+		return
+	}
+
+	tmpFile := t.stateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(strings.Join(t.seen.keys(), "\n")+"\n"), 0o644); err != nil {
+		log.Printf("Could not save seen issuers to '%s': %s\n", tmpFile, err)
+		return
+	}
+
+	if err := os.Rename(tmpFile, t.stateFile); err != nil {
+		log.Printf("Could not save seen issuers to '%s': %s\n", t.stateFile, err)
+		return
+	}
+
+	t.changed = false
+}
+
+// GetNewIssuers returns the number of entries that were flagged because their issuer was not seen before.
+func GetNewIssuers() int64 {
+	return atomic.LoadInt64(&newIssuers)
+}
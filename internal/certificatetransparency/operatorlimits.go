@@ -0,0 +1,111 @@
+package certificatetransparency
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+// operatorLimiter limits the number of simultaneous requests to the logs of an operator. It is shared by all workers
+// of the operator and safe for concurrent use.
+type operatorLimiter struct {
+	slots    chan struct{}
+	inFlight atomic.Int64
+}
+
+var (
+	operatorLimitersMutex sync.Mutex
+	// operatorLimiters holds the limiters by normalized operator name. Operators without a configured limit have none.
+	operatorLimiters = make(map[string]*operatorLimiter)
+)
+
+// getOperatorLimiter returns the shared limiter of the operator or nil if no limit is configured for it. Operator
+// names are matched after normalization, so aliases of an operator share the same limit.
+func getOperatorLimiter(operatorName string) *operatorLimiter {
+	normalized := normalizeOperatorName(operatorName)
+
+	limit := 0
+	for name, concurrency := range config.AppConfig.CTLogs.OperatorConcurrency {
+		if normalizeOperatorName(name) == normalized {
+			limit = concurrency
+			break
+		}
+	}
+
+	if limit <= 0 {
+		return nil
+	}
+
+	operatorLimitersMutex.Lock()
+	defer operatorLimitersMutex.Unlock()
+
+	limiter, ok := operatorLimiters[normalized]
+	if !ok {
+		limiter = &operatorLimiter{slots: make(chan struct{}, limit)}
+		operatorLimiters[normalized] = limiter
+	}
+
+	return limiter
+}
+
+// operatorLimitTransport is a http.RoundTripper that waits for a free slot of the operator before sending a request.
+// The slot is held until the response body is closed, since the log is still busy sending it until then.
+type operatorLimitTransport struct {
+	limiter *operatorLimiter
+	next    http.RoundTripper
+}
+
+func (t operatorLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.limiter.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	t.limiter.inFlight.Add(1)
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.limiter.release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: sync.OnceFunc(t.limiter.release)}
+
+	return resp, nil
+}
+
+// release frees the slot of a finished request.
+func (l *operatorLimiter) release() {
+	l.inFlight.Add(-1)
+	<-l.slots
+}
+
+// releasingBody releases the slot of the request once the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+
+	return b.ReadCloser.Close()
+}
+
+// GetOperatorInFlight returns the number of in-flight requests by normalized operator name for all operators with a
+// configured concurrency limit that sent requests.
+func GetOperatorInFlight() map[string]int64 {
+	operatorLimitersMutex.Lock()
+	defer operatorLimitersMutex.Unlock()
+
+	inFlight := make(map[string]int64, len(operatorLimiters))
+	for operator, limiter := range operatorLimiters {
+		inFlight[operator] = limiter.inFlight.Load()
+	}
+
+	return inFlight
+}
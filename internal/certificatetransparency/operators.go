@@ -0,0 +1,37 @@
+package certificatetransparency
+
+import (
+	"strings"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+// defaultOperatorAliases maps known variants of operator names (already lowercased and trimmed) to their canonical name.
+// Aliases configured via ctlogs.operator_aliases take precedence.
+var defaultOperatorAliases = map[string]string{
+	"google llc":                       "google",
+	"cloudflare, inc.":                 "cloudflare",
+	"digicert, inc.":                   "digicert",
+	"sectigo limited":                  "sectigo",
+	"let's encrypt":                    "letsencrypt",
+	"internet security research group": "letsencrypt",
+	"trustasia technologies, inc.":     "trustasia",
+}
+
+// normalizeOperatorName returns the lowercased and trimmed operator name, canonicalized via the configured
+// and default aliases. The raw name is kept in certstream.Source.Operator.
+func normalizeOperatorName(operatorName string) string {
+	normalized := strings.ToLower(strings.TrimSpace(operatorName))
+
+	for alias, canonical := range config.AppConfig.CTLogs.OperatorAliases {
+		if strings.ToLower(strings.TrimSpace(alias)) == normalized {
+			return strings.ToLower(strings.TrimSpace(canonical))
+		}
+	}
+
+	if canonical, ok := defaultOperatorAliases[normalized]; ok {
+		return canonical
+	}
+
+	return normalized
+}
@@ -0,0 +1,101 @@
+package certificatetransparency
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// LogPosition is the position of the watcher in a single CT log. LastIndex is the index of the last delivered entry,
+// so watching the log resumes at LastIndex+1.
+type LogPosition struct {
+	NormalizedURL string `json:"normalized_url"`
+	LastIndex     int64  `json:"last_index"`
+}
+
+var (
+	// importedPositions maps the normalized urls of the imported positions to the index to resume at.
+	// It is only written by loadPositions before the first worker is started.
+	importedPositions map[string]int64
+	// importValidated is set once the imported positions were checked against the loglist.
+	importValidated sync.Once
+)
+
+// Positions returns the current position of the watcher in each watched log. Logs without a delivered entry yet are
+// exported with the index before their start index, so they resume where they would have started.
+func (w *Watcher) Positions() []LogPosition {
+	w.workersMutex.RLock()
+	defer w.workersMutex.RUnlock()
+
+	positions := make([]LogPosition, 0, len(w.workers))
+	for _, ctWorker := range w.workers {
+		lastIndex := ctWorker.lastIndex.Load()
+		if lastIndex < 0 {
+			lastIndex = ctWorker.startIndex.Load() - 1
+		}
+
+		positions = append(positions, LogPosition{NormalizedURL: normalizeCtlogURL(ctWorker.ctURL), LastIndex: lastIndex})
+	}
+
+	return positions
+}
+
+// loadPositions reads positions exported by Positions from the given file. The workers of the listed logs resume at
+// the imported positions unless a start index is configured for them.
+func loadPositions(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var positions []LogPosition
+	if err = json.Unmarshal(data, &positions); err != nil {
+		return fmt.Errorf("could not parse positions file: %w", err)
+	}
+
+	importedPositions = make(map[string]int64, len(positions))
+	for _, position := range positions {
+		if position.NormalizedURL == "" || position.LastIndex < -1 {
+			log.Printf("Ignoring invalid imported position '%s' %d\n", position.NormalizedURL, position.LastIndex)
+			continue
+		}
+
+		importedPositions[normalizeCtlogURL(position.NormalizedURL)] = position.LastIndex + 1
+	}
+
+	log.Printf("Imported positions of %d ct logs from '%s'\n", len(importedPositions), path)
+
+	return nil
+}
+
+// validateImportedPositions logs the imported positions of logs that are not (or no longer) watched according to
+// the loglist. It only checks the positions of the first loglist download.
+func validateImportedPositions(listedURLs map[string]bool) {
+	importValidated.Do(func() {
+		for normalizedURL := range importedPositions {
+			if !listedURLs[normalizedURL] {
+				log.Printf("Imported position of '%s' is ignored, the log is not watched\n", normalizedURL)
+			}
+		}
+	})
+}
+
+// importedStartIndex returns the imported index to resume the given log at. Imported indices beyond the current tree
+// size are ignored.
+func importedStartIndex(ctURL string, treeSize int64) (int64, bool) {
+	startIndex, ok := importedPositions[normalizeCtlogURL(ctURL)]
+	if !ok {
+		return 0, false
+	}
+
+	if startIndex > treeSize {
+		log.Printf("Ignoring imported index %d for '%s' beyond the tree size %d\n", startIndex, ctURL, treeSize)
+		return 0, false
+	}
+
+	log.Printf("Resuming '%s' at imported index %d\n", ctURL, startIndex)
+
+	return startIndex, true
+}
@@ -0,0 +1,40 @@
+package certificatetransparency
+
+import (
+	"log"
+	"time"
+)
+
+// progressLogger periodically logs the number of processed entries and the queue length.
+type progressLogger struct {
+	// everyEntries logs the progress every n entries, interval after the given time has passed since the last log.
+	// Zero or negative values disable the respective trigger.
+	everyEntries int64
+	interval     time.Duration
+
+	lastLog       time.Time
+	lastProcessed int64
+}
+
+// newProgressLogger creates a progressLogger that logs every everyEntries entries and/or once interval has passed.
+func newProgressLogger(everyEntries int64, interval time.Duration) *progressLogger {
+	return &progressLogger{everyEntries: everyEntries, interval: interval, lastLog: time.Now()}
+}
+
+// entryProcessed logs the progress if one of the triggers is reached. The interval is only checked when an entry is
+// processed, so nothing is logged while no entries arrive.
+func (p *progressLogger) entryProcessed(processed int64, queueLength int) {
+	countReached := p.everyEntries > 0 && processed%p.everyEntries == 0
+	intervalReached := p.interval > 0 && time.Since(p.lastLog) >= p.interval
+
+	if !countReached && !intervalReached {
+		return
+	}
+
+	elapsed := time.Since(p.lastLog)
+	rate := float64(processed-p.lastProcessed) / elapsed.Seconds()
+	log.Printf("Processed %d entries (%.1f/s) | Queue length: %d\n", processed, rate, queueLength)
+
+	p.lastLog = time.Now()
+	p.lastProcessed = processed
+}
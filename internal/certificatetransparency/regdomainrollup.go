@@ -0,0 +1,137 @@
+package certificatetransparency
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+// rolledUpEntries counts the entries that were suppressed in favor of a reg_domain_summary.
+var rolledUpEntries int64
+
+// rollupWindow holds the number of entries of a single registrable domain in the current window.
+type rollupWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// regDomainRollup suppresses the entries of registrable domains that exceed a number of entries per window and
+// reports them as a periodic reg_domain_summary instead.
+type regDomainRollup struct {
+	window     time.Duration
+	threshold  int
+	maxEntries int
+	domains    map[string]*rollupWindow
+	lastSweep  time.Time
+	// pending are the summaries of the windows that were closed since the last call of summaries.
+	pending []certstream.Entry
+}
+
+// newRegDomainRollup creates a regDomainRollup that lets up to threshold entries per registrable domain and window
+// pass. At most maxEntries registrable domains are tracked at once; entries of other domains are never suppressed.
+func newRegDomainRollup(window time.Duration, threshold, maxEntries int) *regDomainRollup {
+	return &regDomainRollup{
+		window:     window,
+		threshold:  threshold,
+		maxEntries: maxEntries,
+		domains:    make(map[string]*rollupWindow),
+		lastSweep:  time.Now(),
+	}
+}
+
+// suppress counts the entry for each of its registrable domains. The entry is suppressed if all of its registrable
+// domains exceeded the threshold within their current window, so entries that also cover less frequent domains are
+// still emitted. Entries without registrable domains are never suppressed.
+func (r *regDomainRollup) suppress(entry *certstream.Entry, now time.Time) bool {
+	regDomains := entry.Data.LeafCert.AllRegDomains
+	if len(regDomains) == 0 {
+		return false
+	}
+
+	exceeded := true
+	var windows []*rollupWindow
+
+	for _, regDomain := range regDomains {
+		window, ok := r.domains[regDomain]
+		if !ok || now.Sub(window.start) >= r.window {
+			if !ok && len(r.domains) >= r.maxEntries {
+				exceeded = false
+				continue
+			}
+
+			if ok {
+				r.closeWindow(regDomain, window)
+			}
+
+			window = &rollupWindow{start: now}
+			r.domains[regDomain] = window
+		}
+
+		window.count++
+		if window.count <= r.threshold {
+			exceeded = false
+		}
+
+		windows = append(windows, window)
+	}
+
+	if !exceeded {
+		return false
+	}
+
+	for _, window := range windows {
+		window.suppressed++
+	}
+
+	atomic.AddInt64(&rolledUpEntries, 1)
+
+	return true
+}
+
+// summaries returns a reg_domain_summary entry for each registrable domain whose window expired with suppressed
+// entries. Expired windows are only swept once per window duration and forgotten afterwards.
+func (r *regDomainRollup) summaries(now time.Time) []certstream.Entry {
+	if now.Sub(r.lastSweep) >= r.window {
+		r.lastSweep = now
+
+		for regDomain, window := range r.domains {
+			if now.Sub(window.start) >= r.window {
+				r.closeWindow(regDomain, window)
+				delete(r.domains, regDomain)
+			}
+		}
+	}
+
+	summaries := r.pending
+	r.pending = nil
+
+	return summaries
+}
+
+// closeWindow adds the summary of the given window to the pending summaries if entries were suppressed in it.
+func (r *regDomainRollup) closeWindow(regDomain string, window *rollupWindow) {
+	if window.suppressed == 0 {
+		return
+	}
+
+	r.pending = append(r.pending, certstream.Entry{
+		MessageType: "reg_domain_summary",
+		Data: certstream.Data{
+			Seen: float64(time.Now().UnixMilli()) / 1_000,
+			RegDomainSummary: &certstream.RegDomainSummary{
+				RegDomain:   regDomain,
+				Count:       window.count,
+				Suppressed:  window.suppressed,
+				WindowStart: window.start.Unix(),
+				WindowEnd:   window.start.Add(r.window).Unix(),
+			},
+		},
+	})
+}
+
+// GetRolledUpEntries returns the number of entries suppressed in favor of a reg_domain_summary.
+func GetRolledUpEntries() int64 {
+	return atomic.LoadInt64(&rolledUpEntries)
+}
@@ -0,0 +1,67 @@
+package certificatetransparency
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+var (
+	// collapsedEntries counts the entries that were suppressed because their registrable domains were seen recently.
+	collapsedEntries int64
+	// collapseCacheSize is the current number of registrable domain sets remembered.
+	collapseCacheSize int64
+)
+
+// regDomainCollapser suppresses entries whose set of registrable domains was already emitted within a rolling window.
+type regDomainCollapser struct {
+	seen *lruCache[string, struct{}]
+}
+
+// newRegDomainCollapser creates a new regDomainCollapser remembering up to maxEntries sets of registrable domains
+// for the given window.
+func newRegDomainCollapser(window time.Duration, maxEntries int) *regDomainCollapser {
+	return &regDomainCollapser{seen: newLRUCache[string, struct{}](maxEntries, window)}
+}
+
+// suppress checks if the registrable domains of the given entry were already seen within the window.
+// The first entry for each set of registrable domains is not suppressed. Entries without registrable domains
+// are never suppressed.
+func (r *regDomainCollapser) suppress(entry *certstream.Entry) bool {
+	regDomains := entry.Data.LeafCert.AllRegDomains
+	if len(regDomains) == 0 {
+		return false
+	}
+
+	sortedDomains := make([]string, len(regDomains))
+	copy(sortedDomains, regDomains)
+	sort.Strings(sortedDomains)
+	key := strings.Join(sortedDomains, ",")
+
+	now := time.Now()
+	_, seen := r.seen.get(key, now)
+	if !seen {
+		r.seen.add(key, struct{}{}, now)
+	}
+
+	atomic.StoreInt64(&collapseCacheSize, int64(r.seen.len()))
+
+	if seen {
+		atomic.AddInt64(&collapsedEntries, 1)
+	}
+
+	return seen
+}
+
+// GetCollapsedEntries returns the number of entries suppressed because their registrable domains were seen recently.
+func GetCollapsedEntries() int64 {
+	return atomic.LoadInt64(&collapsedEntries)
+}
+
+// GetCollapseCacheSize returns the number of registrable domain sets currently remembered.
+func GetCollapseCacheSize() int64 {
+	return atomic.LoadInt64(&collapseCacheSize)
+}
@@ -0,0 +1,177 @@
+package certificatetransparency
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+var (
+	// revokedSerials is the loaded revocation set, keyed by revocationKey. Nil until it was loaded successfully.
+	revokedSerials atomic.Pointer[map[string]struct{}]
+	// revokedSerialCerts counts the entries whose issuer and serial number are in the revocation set.
+	revokedSerialCerts int64
+)
+
+// revocationKey returns the key of a certificate in the revocation set, built from the SHA-256 fingerprint of the
+// issuing certificate and the serial number, both formatted like in the entries.
+func revocationKey(issuerFingerprint, serialNumber string) string {
+	return issuerFingerprint + "/" + serialNumber
+}
+
+// isRevokedSerial reports whether the issuer and serial number of the entry are in the revocation set. The issuer is
+// the first certificate of the chain, so entries without a chain never match.
+func isRevokedSerial(data *certstream.Data) bool {
+	revoked := revokedSerials.Load()
+	if revoked == nil || len(data.Chain) == 0 {
+		return false
+	}
+
+	if _, ok := (*revoked)[revocationKey(data.Chain[0].SHA256, data.LeafCert.SerialNumber)]; !ok {
+		return false
+	}
+
+	atomic.AddInt64(&revokedSerialCerts, 1)
+
+	return true
+}
+
+// watchRevocations loads the revocation set and refreshes it every refresh interval until the context is cancelled.
+// If a refresh fails, the previously loaded set is kept.
+func watchRevocations(ctx context.Context, revocationsConfig config.RevocationsConfig) {
+	ticker := time.NewTicker(revocationsConfig.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		revoked, err := loadRevocations(ctx, revocationsConfig)
+		if err != nil {
+			log.Printf("Could not load revocations from '%s', using previously loaded data: %s\n", revocationsConfig.Source, err)
+		} else {
+			revokedSerials.Store(&revoked)
+			log.Printf("Revocations: Loaded %d revoked certificates\n", len(revoked))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// loadRevocations reads the revocation set from the CSV file at the configured url or path. The first row must be a
+// header. Rows with an invalid issuer fingerprint or serial number are skipped.
+func loadRevocations(ctx context.Context, revocationsConfig config.RevocationsConfig) (map[string]struct{}, error) {
+	var source io.ReadCloser
+
+	if strings.HasPrefix(revocationsConfig.Source, "http://") || strings.HasPrefix(revocationsConfig.Source, "https://") {
+		resp, err := downloadCSV(ctx, revocationsConfig.Source, RetryOptions{MaxRetries: 3, InitialDelay: time.Second, MaxDelay: time.Minute})
+		if err != nil {
+			return nil, err
+		}
+
+		source = resp.Body
+	} else {
+		file, err := os.Open(revocationsConfig.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		source = file
+	}
+	defer source.Close()
+
+	reader := csv.NewReader(source)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV first row: %w", err)
+	}
+
+	issuerColIndex, err := resolveCSVColumn(revocationsConfig.IssuerColumn, header, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer column: %w", err)
+	}
+
+	serialColIndex, err := resolveCSVColumn(revocationsConfig.SerialColumn, header, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid serial column: %w", err)
+	}
+
+	result := make(map[string]struct{})
+	skipped := 0
+
+	for {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("error reading CSV record: %w", readErr)
+		}
+
+		if issuerColIndex >= len(record) || serialColIndex >= len(record) {
+			skipped++
+			continue
+		}
+
+		issuer, serial, ok := normalizeRevocation(record[issuerColIndex], record[serialColIndex])
+		if !ok {
+			skipped++
+			continue
+		}
+
+		result[revocationKey(issuer, serial)] = struct{}{}
+	}
+
+	if skipped > 0 {
+		log.Printf("Revocations: Skipped %d invalid rows\n", skipped)
+	}
+
+	return result, nil
+}
+
+// normalizeRevocation formats the hex encoded issuer fingerprint and serial number like formatFingerprint and
+// formatSerialNumber, so they match regardless of separators, case and leading zeros.
+func normalizeRevocation(issuer, serial string) (string, string, bool) {
+	separators := strings.NewReplacer(":", "", " ", "")
+
+	issuerBytes, err := hex.DecodeString(separators.Replace(strings.TrimSpace(issuer)))
+	if err != nil || len(issuerBytes) != 32 {
+		return "", "", false
+	}
+
+	serialNumber, ok := new(big.Int).SetString(separators.Replace(strings.TrimSpace(serial)), 16)
+	if !ok {
+		return "", "", false
+	}
+
+	return formatFingerprint(issuerBytes), formatSerialNumber(serialNumber), true
+}
+
+// GetRevokedSerialCerts returns the number of entries whose issuer and serial number are in the revocation set.
+func GetRevokedSerialCerts() int64 {
+	return atomic.LoadInt64(&revokedSerialCerts)
+}
+
+// GetRevocationSetSize returns the number of revoked certificates in the loaded revocation set.
+func GetRevocationSetSize() int64 {
+	revoked := revokedSerials.Load()
+	if revoked == nil {
+		return 0
+	}
+
+	return int64(len(*revoked))
+}
@@ -0,0 +1,86 @@
+package certificatetransparency
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+
+	"github.com/google/certificate-transparency-go/asn1"
+)
+
+// oidExtensionSubjectDirectoryAttributes is the OID of the subject directory attributes extension (RFC 5280, 4.2.1.8).
+var oidExtensionSubjectDirectoryAttributes = asn1.ObjectIdentifier{2, 5, 29, 9}
+
+// subjectDirectoryAttributeNames maps the OIDs of the personal data attributes defined in RFC 3739 to their names.
+var subjectDirectoryAttributeNames = map[string]string{
+	"1.3.6.1.5.5.7.9.1": "dateOfBirth",
+	"1.3.6.1.5.5.7.9.2": "placeOfBirth",
+	"1.3.6.1.5.5.7.9.3": "gender",
+	"1.3.6.1.5.5.7.9.4": "countryOfCitizenship",
+	"1.3.6.1.5.5.7.9.5": "countryOfResidence",
+}
+
+// directoryAttribute is the ASN.1 structure of a single attribute of the subject directory attributes extension.
+type directoryAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// parseSubjectDirectoryAttributes decodes the value of the subject directory attributes extension. Values of the
+// attributes in subjectDirectoryAttributeNames are decoded as strings (dates as RFC3339), all other values are
+// returned as base64 encoded DER in Raw. Returns nil if the extension can't be decoded.
+func parseSubjectDirectoryAttributes(extensionValue []byte) []certstream.SubjectDirectoryAttribute {
+	var attributes []directoryAttribute
+
+	rest, err := asn1.Unmarshal(extensionValue, &attributes)
+	if err != nil || len(rest) > 0 {
+		return nil
+	}
+
+	result := make([]certstream.SubjectDirectoryAttribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		oid := attribute.Type.String()
+		name, known := subjectDirectoryAttributeNames[oid]
+		decoded := certstream.SubjectDirectoryAttribute{OID: oid, Name: name}
+
+		for _, value := range attribute.Values {
+			if text, ok := decodeDirectoryAttributeValue(value); known && ok {
+				decoded.Values = append(decoded.Values, text)
+				continue
+			}
+
+			decoded.Raw = append(decoded.Raw, base64.StdEncoding.EncodeToString(value.FullBytes))
+		}
+
+		result = append(result, decoded)
+	}
+
+	return result
+}
+
+// decodeDirectoryAttributeValue decodes string and time values. Returns false for all other types.
+func decodeDirectoryAttributeValue(value asn1.RawValue) (string, bool) {
+	if value.Class != asn1.ClassUniversal {
+		return "", false
+	}
+
+	switch value.Tag {
+	case asn1.TagGeneralizedTime, asn1.TagUTCTime:
+		var t time.Time
+		if _, err := asn1.Unmarshal(value.FullBytes, &t); err != nil {
+			return "", false
+		}
+
+		return t.UTC().Format(time.RFC3339), true
+	case asn1.TagPrintableString, asn1.TagUTF8String, asn1.TagIA5String, asn1.TagT61String, asn1.TagNumericString:
+		var s string
+		if _, err := asn1.Unmarshal(value.FullBytes, &s); err != nil {
+			return "", false
+		}
+
+		return s, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,84 @@
+package certificatetransparency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// tbsMismatches counts the entries that were flagged because their TBS differs from their precertificate or final
+// certificate counterpart.
+var tbsMismatches int64
+
+// tbsRecord is the normalized TBS digest of a precertificate or final certificate seen before.
+type tbsRecord struct {
+	digest     string
+	updateType string
+	entryID    string
+}
+
+// tbsConsistencyChecker correlates precertificates and final certificates by authority key identifier and serial
+// number and flags pairs whose TBS differs in more than the poison extension and the SCT list.
+type tbsConsistencyChecker struct {
+	seen *lruCache[string, tbsRecord]
+}
+
+// newTBSConsistencyChecker creates a tbsConsistencyChecker that remembers up to maxEntries certificates for window.
+func newTBSConsistencyChecker(maxEntries int, window time.Duration) *tbsConsistencyChecker {
+	return &tbsConsistencyChecker{seen: newLRUCache[string, tbsRecord](maxEntries, window)}
+}
+
+// check compares the TBS digest of the entry with the digest of its counterpart if it was seen before and flags the
+// entry with tbs_mismatch if they differ. Certificates without authority key identifier or digest are ignored.
+func (c *tbsConsistencyChecker) check(entry *certstream.Entry) {
+	leafCert := &entry.Data.LeafCert
+	aki := leafCert.Extensions.AuthorityKeyIdentifier
+	if leafCert.TBSDigest == "" || aki == nil || *aki == "" {
+		return
+	}
+
+	key := *aki + "/" + leafCert.SerialNumber
+	now := time.Now()
+
+	if previous, ok := c.seen.get(key, now); ok && previous.updateType != entry.Data.UpdateType {
+		if previous.digest != leafCert.TBSDigest {
+			leafCert.TBSMismatch = true
+			leafCert.TBSMismatchEntryID = previous.entryID
+			atomic.AddInt64(&tbsMismatches, 1)
+		}
+	}
+
+	c.seen.add(key, tbsRecord{digest: leafCert.TBSDigest, updateType: entry.Data.UpdateType, entryID: entry.Data.EntryID}, now)
+}
+
+// normalizedTBS returns the TBS of the certificate without the SCT list. The TBS of precertificates in a log entry
+// already lacks the poison extension and names the final issuer (RFC 6962, 3.2), so it is equal for a
+// precertificate and its final certificate.
+func normalizedTBS(cert *x509.Certificate, isPrecert bool) []byte {
+	tbs := cert.RawTBSCertificate
+	if !isPrecert {
+		// Final certificates delivered without embedded SCTs have no SCT list to remove
+		if withoutSCTs, err := x509.RemoveSCTList(tbs); err == nil {
+			tbs = withoutSCTs
+		}
+	}
+
+	return tbs
+}
+
+// normalizedTBSDigest returns the hex encoded SHA-256 digest of the normalized TBS of the certificate.
+func normalizedTBSDigest(cert *x509.Certificate, isPrecert bool) string {
+	digest := sha256.Sum256(normalizedTBS(cert, isPrecert))
+
+	return hex.EncodeToString(digest[:])
+}
+
+// GetTBSMismatches returns the number of entries whose TBS differs from their precertificate or final certificate.
+func GetTBSMismatches() int64 {
+	return atomic.LoadInt64(&tbsMismatches)
+}
@@ -0,0 +1,180 @@
+//go:build ignore
+
+// generate creates the certificate fixtures used by the parser tests. The fixtures are checked in, so this only has to
+// be run (go run generate.go in this directory) to add new fixtures. Keys are generated on each run, so the
+// fingerprints and signatures of all fixtures change and only the new fixtures should be committed.
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+var (
+	notBefore = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter  = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	oidJurisdictionCountry = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 60, 2, 1, 3}
+	oidCTPoison            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	oidPolicyEV            = asn1.ObjectIdentifier{2, 23, 140, 1, 1}
+	oidPolicyDV            = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	oidPolicyOV            = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}
+)
+
+type fixture struct {
+	name     string
+	template x509.Certificate
+	// key is the type of the subject key, "ecdsa" by default.
+	key string
+}
+
+func main() {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Certstream Test CA", Organization: []string{"Certstream Test"}, Country: []string{"DE"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		SubjectKeyId:          []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14},
+	}
+
+	for _, f := range fixtures() {
+		template := f.template
+		template.NotBefore = notBefore
+		template.NotAfter = notAfter
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+		der, createErr := x509.CreateCertificate(rand.Reader, &template, ca, publicKey(f.key), caKey)
+		if createErr != nil {
+			log.Fatalf("%s: %s", f.name, createErr)
+		}
+
+		if writeErr := os.WriteFile(f.name+".der", der, 0o644); writeErr != nil {
+			log.Fatal(writeErr)
+		}
+	}
+}
+
+func publicKey(keyType string) crypto.PublicKey {
+	switch keyType {
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return &key.PublicKey
+	case "ed25519":
+		public, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return public
+	default:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return &key.PublicKey
+	}
+}
+
+func fixtures() []fixture {
+	return []fixture{
+		{name: "ev", key: "rsa", template: x509.Certificate{
+			SerialNumber: big.NewInt(0x1001),
+			Subject: pkix.Name{
+				CommonName: "ev.example.com", Organization: []string{"Example Corp"}, Country: []string{"US"},
+				ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidJurisdictionCountry, Value: "US"}},
+			},
+			DNSNames:          []string{"ev.example.com", "www.ev.example.com"},
+			PolicyIdentifiers: []asn1.ObjectIdentifier{oidPolicyEV},
+		}},
+		{name: "dv", template: x509.Certificate{
+			SerialNumber:      big.NewInt(0x1002),
+			Subject:           pkix.Name{CommonName: "dv.example.org"},
+			DNSNames:          []string{"dv.example.org"},
+			PolicyIdentifiers: []asn1.ObjectIdentifier{oidPolicyDV},
+		}},
+		{name: "ov", template: x509.Certificate{
+			SerialNumber:      big.NewInt(0x1003),
+			Subject:           pkix.Name{CommonName: "ov.example.com", Organization: []string{"Example Org"}, Country: []string{"GB"}},
+			DNSNames:          []string{"ov.example.com"},
+			PolicyIdentifiers: []asn1.ObjectIdentifier{oidPolicyOV},
+		}},
+		{name: "wildcard", template: x509.Certificate{
+			SerialNumber: big.NewInt(0x1004),
+			Subject:      pkix.Name{CommonName: "*.example.net"},
+			DNSNames:     []string{"*.example.net", "example.net"},
+		}},
+		{name: "multisan", template: x509.Certificate{
+			SerialNumber: big.NewInt(0x1005),
+			Subject:      pkix.Name{CommonName: "a.example.com"},
+			DNSNames:     []string{"a.example.com", "b.example.com", "www.example.org", "shop.example.co.uk"},
+		}},
+		{name: "ipsan", template: x509.Certificate{
+			SerialNumber: big.NewInt(0x1006),
+			Subject:      pkix.Name{CommonName: "host.example.com"},
+			DNSNames:     []string{"host.example.com"},
+			IPAddresses:  []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+		}},
+		{name: "ed25519", key: "ed25519", template: x509.Certificate{
+			SerialNumber: big.NewInt(0x1007),
+			Subject:      pkix.Name{CommonName: "ed25519.example.com"},
+			DNSNames:     []string{"ed25519.example.com"},
+		}},
+		{name: "precert", template: x509.Certificate{
+			SerialNumber:    big.NewInt(0x1008),
+			Subject:         pkix.Name{CommonName: "precert.example.com"},
+			DNSNames:        []string{"precert.example.com"},
+			ExtraExtensions: []pkix.Extension{{Id: oidCTPoison, Critical: true, Value: []byte{0x05, 0x00}}},
+		}},
+		// 2.23.140.1.2.10 starts with the DV policy 2.23.140.1.2.1 but is a different policy.
+		{name: "policy-dv-prefix", template: x509.Certificate{
+			SerialNumber:      big.NewInt(0x100a),
+			Subject:           pkix.Name{CommonName: "prefix.example.com", Organization: []string{"Example Org"}},
+			DNSNames:          []string{"prefix.example.com"},
+			PolicyIdentifiers: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 10}},
+		}},
+		{name: "crl-one", template: x509.Certificate{
+			SerialNumber:          big.NewInt(0x100b),
+			Subject:               pkix.Name{CommonName: "crl.example.com"},
+			DNSNames:              []string{"crl.example.com"},
+			CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"},
+		}},
+		{name: "crl-several", template: x509.Certificate{
+			SerialNumber:          big.NewInt(0x100c),
+			Subject:               pkix.Name{CommonName: "crl.example.com"},
+			DNSNames:              []string{"crl.example.com"},
+			CRLDistributionPoints: []string{"http://crl.example.com/ca.crl", "http://crl2.example.com/ca.crl"},
+		}},
+		{name: "weirdcn", template: x509.Certificate{
+			SerialNumber: big.NewInt(0x1009),
+			Subject:      pkix.Name{CommonName: "My Org CA (Test) - Ünïcode", Organization: []string{"My Org"}},
+			DNSNames:     []string{"weird.example.com"},
+		}},
+	}
+}
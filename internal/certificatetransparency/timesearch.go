@@ -0,0 +1,74 @@
+package certificatetransparency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+)
+
+// maxTimeSearchSteps limits the number of entries fetched while searching for a timestamp.
+// 64 steps are enough for any tree size, so this only protects against logs returning inconsistent data.
+const maxTimeSearchSteps = 64
+
+// parseStartTime parses a start time given as RFC3339 timestamp or date (e.g. "2024-01-01").
+func parseStartTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// findIndexByTime binary searches the log for the first entry with a timestamp at or after the given time.
+// CT logs don't guarantee strictly ordered timestamps, but they are close enough for a start index.
+// Returns treeSize if all entries are older than the given time.
+func findIndexByTime(ctx context.Context, jsonClient *client.LogClient, treeSize int64, target time.Time) (int64, error) {
+	low, high := int64(0), treeSize
+	targetMillis := uint64(target.UnixMilli())
+
+	for step := 0; low < high; step++ {
+		if step >= maxTimeSearchSteps {
+			return 0, errors.New("search did not converge")
+		}
+
+		mid := low + (high-low)/2
+
+		timestamp, err := entryTimestamp(ctx, jsonClient, mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if timestamp < targetMillis {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+
+	return low, nil
+}
+
+// entryTimestamp returns the timestamp in milliseconds at which the entry with the given index was logged.
+func entryTimestamp(ctx context.Context, jsonClient *client.LogClient, index int64) (uint64, error) {
+	resp, err := jsonClient.GetRawEntries(ctx, index, index)
+	if err != nil {
+		return 0, fmt.Errorf("could not get entry %d: %w", index, err)
+	}
+
+	if len(resp.Entries) == 0 {
+		return 0, fmt.Errorf("log returned no entry for index %d", index)
+	}
+
+	rawEntry, err := ct.RawLogEntryFromLeaf(index, &resp.Entries[0])
+	if err != nil {
+		return 0, fmt.Errorf("could not parse entry %d: %w", index, err)
+	}
+
+	return rawEntry.Leaf.TimestampedEntry.Timestamp, nil
+}
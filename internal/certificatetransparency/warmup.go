@@ -0,0 +1,99 @@
+package certificatetransparency
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// warmUpSummaryInterval is the interval in which the aggregated worker restarts are logged during the warm-up.
+const warmUpSummaryInterval = 10 * time.Second
+
+// warmUp aggregates the worker restarts during the warm-up period after the start of the watcher.
+var warmUp = &warmUpLog{}
+
+// warmUpLog collects the workers that restarted due to an error during the warm-up period, when many workers
+// briefly fail (e.g. due to DNS or TLS handshakes), and periodically logs a single summary line instead of one line
+// per restart. After the warm-up, restarts are logged individually again.
+type warmUpLog struct {
+	mu       sync.Mutex
+	until    time.Time
+	retrying map[string]struct{}
+	lastURL  string
+	lastErr  error
+}
+
+// start begins the warm-up period of the given duration. A duration of zero or less disables the warm-up.
+func (l *warmUpLog) start(ctx context.Context, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	l.until = time.Now().Add(duration)
+	l.retrying = make(map[string]struct{})
+	l.mu.Unlock()
+
+	go l.summarize(ctx, duration)
+}
+
+// active checks if the warm-up period is still running.
+func (l *warmUpLog) active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return time.Now().Before(l.until)
+}
+
+// retry records the restart of the worker for the given log. It returns false if the warm-up is over, in which
+// case the caller has to log the error itself.
+func (l *warmUpLog) retry(ctURL string, err error) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !time.Now().Before(l.until) {
+		return false
+	}
+
+	l.retrying[ctURL] = struct{}{}
+	l.lastURL = ctURL
+	l.lastErr = err
+
+	return true
+}
+
+// summarize logs the number of retrying workers every warmUpSummaryInterval until the warm-up is over.
+func (l *warmUpLog) summarize(ctx context.Context, duration time.Duration) {
+	ticker := time.NewTicker(warmUpSummaryInterval)
+	defer ticker.Stop()
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.logSummary()
+		case <-timer.C:
+			l.logSummary()
+			log.Println("Warm-up finished, logging worker errors individually from now on")
+
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// logSummary logs the workers that restarted since the last summary, if any, and resets them.
+func (l *warmUpLog) logSummary() {
+	l.mu.Lock()
+	retrying, lastURL, lastErr := len(l.retrying), l.lastURL, l.lastErr
+	clear(l.retrying)
+	l.mu.Unlock()
+
+	if retrying > 0 {
+		log.Printf("%d workers retrying during warm-up, latest error for '%s': %s\n", retrying, lastURL, lastErr)
+	}
+}
@@ -0,0 +1,37 @@
+package certstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+)
+
+// CanonicalJSON re-encodes the given JSON document canonically, so that equal entries always result in the same bytes
+// and can be hashed or signed:
+//   - the keys of all objects - including nested ones - are sorted by their UTF-8 bytes
+//   - there is no insignificant whitespace and no trailing newline
+//   - numbers are kept exactly as they were encoded, HTML characters (<, >, &) are not escaped
+//
+// If the document can't be decoded, it is returned unchanged.
+func CanonicalJSON(data []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		log.Println(err)
+		return data
+	}
+
+	// Maps are always encoded with sorted keys
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(document); err != nil {
+		log.Println(err)
+		return data
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
@@ -0,0 +1,44 @@
+package certstream
+
+import (
+	"log"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborEncMode is the CBOR encoding mode used for all entries. Field names are taken from the json struct tags,
+// so the CBOR representation uses the same schema as the JSON representation.
+var cborEncMode, _ = cbor.EncOptions{}.EncMode()
+
+// CBORNoCache returns the CBOR encoded Entry as byte slice without caching it.
+func (e *Entry) CBORNoCache() []byte {
+	return encodeCBOR(e)
+}
+
+// CBORLiteNoCache does the same as CBORNoCache() but removes the chain and cert's DER representation.
+func (e *Entry) CBORLiteNoCache() []byte {
+	newEntry := e.liteEntry()
+	return encodeCBOR(&newEntry)
+}
+
+// CBORPEMNoCache does the same as CBORNoCache() but provides the cert and chain as PEM instead of base64 encoded DER.
+func (e *Entry) CBORPEMNoCache() []byte {
+	newEntry := e.pemEntry()
+	return encodeCBOR(&newEntry)
+}
+
+// CBORDomains returns the CBOR encoded domains (DomainsEntry) as byte slice.
+func (e *Entry) CBORDomains() []byte {
+	domainsEntry := e.domainsEntry()
+	return encodeCBOR(&domainsEntry)
+}
+
+// encodeCBOR encodes the given value to a CBOR byte slice.
+func encodeCBOR(v any) []byte {
+	data, err := cborEncMode.Marshal(v)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return data
+}
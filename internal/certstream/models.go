@@ -2,15 +2,25 @@ package certstream
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"log"
 )
 
 type Entry struct {
-	Data           Data   `json:"data"`
-	MessageType    string `json:"message_type"`
+	Data        Data   `json:"data"`
+	MessageType string `json:"message_type"`
+	// MatchedRules lists the filter rules that matched this entry. It is only set for clients subscribed with a filter.
+	MatchedRules []string `json:"matched_rules,omitempty"`
+	// MatchedDomains lists the domains that satisfied a domain predicate of the filter. It is only set for clients subscribed with a filter.
+	MatchedDomains []string `json:"matched_domains,omitempty"`
+	// PrevHash and Hash link the entries written to a sink with hash_chain enabled. They are only set for such sinks.
+	PrevHash       string `json:"prev_hash,omitempty"`
+	Hash           string `json:"hash,omitempty"`
 	cachedJSON     []byte
 	cachedJSONLite []byte
+	cachedJSONPEM  []byte
 }
 
 // Clone returns a new copy of the Entry.
@@ -18,11 +28,22 @@ func (e *Entry) Clone() Entry {
 	return Entry{
 		Data:           e.Data,
 		MessageType:    e.MessageType,
+		MatchedRules:   e.MatchedRules,
+		MatchedDomains: e.MatchedDomains,
+		PrevHash:       e.PrevHash,
+		Hash:           e.Hash,
 		cachedJSON:     e.cachedJSON,
 		cachedJSONLite: e.cachedJSONLite,
+		cachedJSONPEM:  e.cachedJSONPEM,
 	}
 }
 
+// ValidityStarted checks if the validity period of the leaf certificate started before the entry was seen.
+// Pre-issued certificates with a NotBefore in the future are not valid yet.
+func (e *Entry) ValidityStarted() bool {
+	return float64(e.Data.LeafCert.NotBefore) <= e.Data.Seen
+}
+
 // JSON returns the json encoded Entry as byte slice and caches it for later access.
 func (e *Entry) JSON() []byte {
 	if len(e.cachedJSON) > 0 {
@@ -50,21 +71,80 @@ func (e *Entry) JSONLite() []byte {
 
 // JSONLiteNoCache does the same as JSONNoCache() but removes the chain and cert's DER representation.
 func (e *Entry) JSONLiteNoCache() []byte {
+	newEntry := e.liteEntry()
+	return newEntry.entryToJSONBytes()
+}
+
+// liteEntry returns a copy of the Entry without the chain and cert's DER representation.
+func (e *Entry) liteEntry() Entry {
 	newEntry := e.Clone()
 	newEntry.Data.Chain = nil
 	newEntry.Data.LeafCert.AsDER = ""
 
+	if e.Data.Raw != nil {
+		raw := *e.Data.Raw
+		raw.Cert = ""
+		newEntry.Data.Raw = &raw
+	}
+
+	return newEntry
+}
+
+// JSONPEM does the same as JSON() but provides the cert and chain as PEM (as_pem) instead of base64 encoded DER (as_der).
+func (e *Entry) JSONPEM() []byte {
+	if len(e.cachedJSONPEM) > 0 {
+		return e.cachedJSONPEM
+	}
+	e.cachedJSONPEM = e.JSONPEMNoCache()
+
+	return e.cachedJSONPEM
+}
+
+// JSONPEMNoCache does the same as JSONNoCache() but provides the cert and chain as PEM instead of base64 encoded DER.
+func (e *Entry) JSONPEMNoCache() []byte {
+	newEntry := e.pemEntry()
 	return newEntry.entryToJSONBytes()
 }
 
-// JSONDomains returns the json encoded domains (DomainsEntry) as byte slice.
-func (e *Entry) JSONDomains() []byte {
-	domainsEntry := DomainsEntry{
-		Data:        e.Data.LeafCert.AllDomains,
-		MessageType: "dns_entries",
+// pemEntry returns a copy of the Entry with the cert and chain as PEM instead of base64 encoded DER.
+func (e *Entry) pemEntry() Entry {
+	newEntry := e.Clone()
+	newEntry.Data.LeafCert = e.Data.LeafCert.withPEM()
+
+	if e.Data.Chain != nil {
+		newEntry.Data.Chain = make([]LeafCert, len(e.Data.Chain))
+		for i, chainCert := range e.Data.Chain {
+			newEntry.Data.Chain[i] = chainCert.withPEM()
+		}
 	}
 
-	domainsEntryBytes, err := json.Marshal(domainsEntry)
+	return newEntry
+}
+
+// WithCompactChain returns a copy of the Entry whose chain is replaced by the subject DN, fingerprints and CA owner
+// of each chain certificate in CompactChain.
+func (e *Entry) WithCompactChain() Entry {
+	newEntry := e.Clone()
+	newEntry.Data.Chain = nil
+
+	if e.Data.Chain != nil {
+		newEntry.Data.CompactChain = make([]ChainLink, len(e.Data.Chain))
+		for i, chainCert := range e.Data.Chain {
+			link := ChainLink{Fingerprint: chainCert.Fingerprint, SHA256: chainCert.SHA256, CAOwner: chainCert.CAOwner}
+			if chainCert.Subject.Aggregated != nil {
+				link.Subject = *chainCert.Subject.Aggregated
+			}
+
+			newEntry.Data.CompactChain[i] = link
+		}
+	}
+
+	return newEntry
+}
+
+// JSONDomains returns the json encoded domains (DomainsEntry) as byte slice.
+func (e *Entry) JSONDomains() []byte {
+	domainsEntryBytes, err := json.Marshal(e.domainsEntry())
 	if err != nil {
 		log.Println(err)
 	}
@@ -72,6 +152,16 @@ func (e *Entry) JSONDomains() []byte {
 	return domainsEntryBytes
 }
 
+// domainsEntry returns the DomainsEntry containing the domains of the Entry.
+func (e *Entry) domainsEntry() DomainsEntry {
+	return DomainsEntry{
+		Data:           e.Data.LeafCert.AllDomains,
+		MessageType:    "dns_entries",
+		MatchedRules:   e.MatchedRules,
+		MatchedDomains: e.MatchedDomains,
+	}
+}
+
 // entryToJSONBytes encodes an Entry to a JSON byte slice.
 func (e *Entry) entryToJSONBytes() []byte {
 	buf := bytes.Buffer{}
@@ -87,48 +177,191 @@ func (e *Entry) entryToJSONBytes() []byte {
 }
 
 type Data struct {
-	CertIndex  int64      `json:"cert_index"`
-	CertLink   string     `json:"cert_link"`
-	Chain      []LeafCert `json:"chain,omitempty"`
-	LeafCert   LeafCert   `json:"leaf_cert"`
-	Seen       float64    `json:"seen"`
-	Source     Source     `json:"source"`
-	UpdateType string     `json:"update_type"`
+	CertIndex int64      `json:"cert_index"`
+	CertLink  string     `json:"cert_link"`
+	Chain     []LeafCert `json:"chain,omitempty"`
+	// CompactChain replaces Chain for subscriptions of the compact chain, see Entry.WithCompactChain.
+	CompactChain []ChainLink `json:"compact_chain,omitempty"`
+	EntryID      string      `json:"entry_id"`
+	LeafCert     LeafCert    `json:"leaf_cert"`
+	// LinkageID is equal for a precertificate and its final certificate, so consumers can pair both entries. It is the
+	// hex encoded SHA-256 digest of the TBS without the poison extension and the SCT list. Only set if enabled in the config.
+	LinkageID string `json:"linkage_id,omitempty"`
+	// Raw is only set for degraded entries (message type "degraded_entry") that could not be parsed.
+	Raw *RawEntry `json:"raw,omitempty"`
+	// RegDomainSummary is only set for summaries of suppressed entries (message type "reg_domain_summary").
+	RegDomainSummary *RegDomainSummary `json:"reg_domain_summary,omitempty"`
+	Seen             float64           `json:"seen"`
+	// SeenNanos is the same point in time as Seen in nanoseconds. It is strictly increasing across all entries.
+	SeenNanos int64 `json:"seen_nanos,omitempty"`
+	// Sequence is incremented by one for every entry emitted for a log (per normalized url) since the server started.
+	Sequence int64  `json:"sequence"`
+	Source   Source `json:"source"`
+	// Tags are added by the expression of processing.entry_hook.
+	Tags       []string `json:"tags,omitempty"`
+	UpdateType string   `json:"update_type"`
+}
+
+// ChainLink identifies a single certificate of the chain without its full contents.
+type ChainLink struct {
+	Subject     string `json:"subject"`
+	Fingerprint string `json:"fingerprint"`
+	SHA256      string `json:"sha256"`
+	CAOwner     string `json:"ca_owner"`
+}
+
+// RegDomainSummary reports the entries of a registrable domain within a window, of which Suppressed entries were
+// not emitted because the domain exceeded the configured rate. WindowStart and WindowEnd are unix timestamps.
+type RegDomainSummary struct {
+	RegDomain   string `json:"reg_domain"`
+	Count       int    `json:"count"`
+	Suppressed  int    `json:"suppressed"`
+	WindowStart int64  `json:"window_start"`
+	WindowEnd   int64  `json:"window_end"`
+}
+
+// RawEntry holds the base64 encoded raw data of a log entry that could not be parsed.
+type RawEntry struct {
+	// LeafInput is the TLS encoded MerkleTreeLeaf of the entry.
+	LeafInput string `json:"leaf_input,omitempty"`
+	// Cert is the DER encoded (pre-)certificate as logged.
+	Cert string `json:"cert,omitempty"`
 }
 
 type Source struct {
-	Name          string `json:"name"`
-	URL           string `json:"url"`
-	Operator      string `json:"-"`
-	NormalizedURL string `json:"-"`
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	Operator           string `json:"operator"`
+	NormalizedOperator string `json:"normalized_operator"`
+	NormalizedURL      string `json:"-"`
+	// LogID is the base64 encoded log ID (SHA-256 hash of the log's public key) as listed in the loglist.
+	LogID string `json:"log_id,omitempty"`
 }
 
 type LeafCert struct {
-	AllDomains         []string    `json:"all_domains"`
-	AllRegDomains      []string    `json:"all_reg_domains"`
-	AsDER              string      `json:"as_der,omitempty"`
-	Extensions         Extensions  `json:"extensions"`
-	Fingerprint        string      `json:"fingerprint"`
-	SHA1               string      `json:"sha1"`
-	SHA256             string      `json:"sha256"`
-	NotAfter           int64       `json:"not_after"`
-	NotBefore          int64       `json:"not_before"`
-	SerialNumber       string      `json:"serial_number"`
-	SignatureAlgorithm string      `json:"signature_algorithm"`
-	KeyType            string      `json:"key_type"`
-	CertType           string      `json:"cert_type"`
-	CertTypeExt        CertTypeExt `json:"cert_type_ext"`
-	ValidationType     string      `json:"validation_type"`
-	Subject            Subject     `json:"subject"`
-	Issuer             Subject     `json:"issuer"`
-	CAOwner            string      `json:"ca_owner"`
-	IsCA               bool        `json:"is_ca"`
+	AllDomains    []string `json:"all_domains"`
+	AllRegDomains []string `json:"all_reg_domains"`
+	// DistinctRegDomainCount is the number of distinct registrable domains. MultiOrgSpan is set if it is above
+	// the configured threshold, which is typical for shared hosting certificates.
+	DistinctRegDomainCount int  `json:"distinct_reg_domain_count"`
+	MultiOrgSpan           bool `json:"multi_org_span"`
+	// TBSMismatch is set if the TBS of a precertificate and its final certificate differ in more than the poison
+	// extension and the SCT list. TBSMismatchEntryID is the entry ID of the counterpart.
+	TBSMismatch        bool   `json:"tbs_mismatch,omitempty"`
+	TBSMismatchEntryID string `json:"tbs_mismatch_entry_id,omitempty"`
+	// TBSDigest is the digest of the normalized TBS used to correlate precertificates and final certificates.
+	TBSDigest string `json:"-"`
+	// NotYetValid is set for certificates whose NotBefore is after the time the entry was seen. Only set if enabled in the config.
+	NotYetValid bool `json:"not_yet_valid,omitempty"`
+	// LowSCTCount is set for certificates with fewer embedded SCTs than the configured parser.min_sct_count.
+	LowSCTCount bool   `json:"low_sct_count,omitempty"`
+	AsDER       string `json:"as_der,omitempty"`
+	AsPEM       string `json:"as_pem,omitempty"`
+	// DERSize is the size of the DER encoded certificate, ChainSize the sum of the sizes of the chain certificates.
+	// Both are only set if enabled in the config.
+	DERSize        int      `json:"der_size,omitempty"`
+	ChainSize      int      `json:"chain_size,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	// SpecialUseNames are the SANs with a special-use suffix such as .onion. They are not part of AllRegDomains.
+	SpecialUseNames []string   `json:"special_use_names,omitempty"`
+	Extensions      Extensions `json:"extensions"`
+	// ExtensionsMap lists all extensions of the certificate by name (or OID for unknown extensions). Only set if enabled in the config.
+	ExtensionsMap map[string]ExtensionValue `json:"extensions_map,omitempty"`
+	Fingerprint   string                    `json:"fingerprint"`
+	SHA1          string                    `json:"sha1"`
+	SHA256        string                    `json:"sha256"`
+	// TBSSHA1 and TBSSHA256 are computed over the TBSCertificate as logged for precertificates (without the poison
+	// extension) and without the SCT list for final certificates, so they are equal for both. Fingerprint, SHA1 and
+	// SHA256 on the other hand cover the whole certificate as submitted. Only set if enabled in the config.
+	TBSSHA1   string `json:"tbs_sha1,omitempty"`
+	TBSSHA256 string `json:"tbs_sha256,omitempty"`
+	NotAfter  int64  `json:"not_after"`
+	NotBefore int64  `json:"not_before"`
+	// NotAfterISO and NotBeforeISO are the validity period as RFC3339 strings in UTC. Only set if enabled in the config.
+	NotAfterISO        string `json:"not_after_iso,omitempty"`
+	NotBeforeISO       string `json:"not_before_iso,omitempty"`
+	SerialNumber       string `json:"serial_number"`
+	SignatureAlgorithm string `json:"signature_algorithm"`
+	KeyType            string `json:"key_type"`
+	// WeakCrypto is set if the signature algorithm or key size is below the configured thresholds.
+	WeakCrypto       bool        `json:"weak_crypto"`
+	WeakCryptoReason string      `json:"weak_crypto_reason,omitempty"`
+	CertType         string      `json:"cert_type"`
+	CertTypeExt      CertTypeExt `json:"cert_type_ext"`
+	// MalformedWildcard is set if a SAN contains a wildcard that is not the complete leftmost label, e.g.
+	// "a.*.example.com" or "*.*.example.com". Such SANs are not counted in CertTypeExt.WildcardSANCount.
+	MalformedWildcard bool   `json:"malformed_wildcard"`
+	ValidationType    string `json:"validation_type"`
+	// ValidationTypeSource is the check that determined ValidationType: "policy_oid" (CA/B Forum policy OID),
+	// "no_org_heuristic" (no subject organization), "jurisdiction" (EV jurisdiction in the subject) or "default".
+	ValidationTypeSource string  `json:"validation_type_source"`
+	Subject              Subject `json:"subject"`
+	// CNNotInSAN is set if the subject CN is a hostname or IP address that is not listed in the SANs, which the
+	// Baseline Requirements forbid. The CN is added to AllDomains anyway.
+	CNNotInSAN bool    `json:"cn_not_in_san"`
+	Issuer     Subject `json:"issuer"`
+	CAOwner    string  `json:"ca_owner"`
+	// RootCAOwner is the CA owner of the root at the top of the chain. It is nil if the root is unknown or
+	// not part of the chain. ChainIncomplete is set in the latter case.
+	RootCAOwner     *string `json:"root_ca_owner"`
+	ChainIncomplete bool    `json:"chain_incomplete,omitempty"`
+	// PrecertSigningCert is set for precertificates signed by a precertificate signing certificate (the first
+	// certificate of the chain). Issuer, CAOwner and IssuerRecord are those of the CA that issued the signing certificate.
+	PrecertSigningCert bool `json:"precert_signing_cert,omitempty"`
+	// IssuerRecord contains the ccadb metadata of the issuing CA. It is only set if enabled in the config.
+	IssuerRecord *CCADBRecord `json:"issuer_ccadb,omitempty"`
+	// IssuerTrust is the trust status of the issuing CA derived from its ccadb record, one of the IssuerTrust constants.
+	// It is only set if the issuer record is enabled in the config.
+	IssuerTrust string `json:"issuer_trust,omitempty"`
+	// WatchedKeyIDs lists the configured watched key identifiers found in the authority key identifier of the
+	// certificate or the subject key identifiers of its chain.
+	WatchedKeyIDs []string `json:"watched_key_ids,omitempty"`
+	// RevokedSerial is set if the issuer and serial number of the certificate are in the loaded revocation set.
+	RevokedSerial bool `json:"revoked_serial,omitempty"`
+	// NewIssuer is set for the first certificate of an issuer (by authority key identifier) seen by the server.
+	NewIssuer bool `json:"new_issuer,omitempty"`
+	IsCA      bool `json:"is_ca"`
+}
+
+// CCADBRecord is the subset of the ccadb metadata of a CA certificate that is attached to entries.
+type CCADBRecord struct {
+	CAOwner          string `json:"ca_owner"`
+	RecordType       string `json:"record_type,omitempty"`
+	RevocationStatus string `json:"revocation_status,omitempty"`
+	TrustBits        string `json:"trust_bits,omitempty"`
+	Auditor          string `json:"auditor,omitempty"`
+	// TrustStatus is the status of the CA in the root stores, e.g. "Apple: Included; Mozilla: Removed".
+	TrustStatus string `json:"trust_status,omitempty"`
+}
+
+// Trust status of the issuing CA in LeafCert.IssuerTrust.
+const (
+	IssuerTrustTrusted    = "trusted"
+	IssuerTrustDistrusted = "distrusted"
+	IssuerTrustRevoked    = "revoked"
+	IssuerTrustUnknown    = "unknown"
+)
+
+// withPEM returns a copy of the LeafCert with the base64 encoded DER representation replaced by a PEM block.
+func (l LeafCert) withPEM() LeafCert {
+	der, err := base64.StdEncoding.DecodeString(l.AsDER)
+	if err != nil {
+		log.Println("Could not decode DER of certificate: ", err)
+		return l
+	}
+
+	l.AsPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	l.AsDER = ""
+
+	return l
 }
 
 type CertTypeExt struct {
 	SANCount         int `json:"san_count"`
 	SingleSANCount   int `json:"single_san_count"`
 	WildcardSANCount int `json:"wildcard_san_count"`
+	// SCTCount is the number of SCTs embedded in the certificate. Precertificates never contain SCTs.
+	SCTCount int `json:"sct_count"`
 }
 
 type Subject struct {
@@ -140,22 +373,52 @@ type Subject struct {
 	ST           *string `json:"ST"`
 	Aggregated   *string `json:"aggregated"`
 	EmailAddress *string `json:"email_address"`
+	// Sanitized is set if the name contained invalid UTF-8, which was replaced by U+FFFD.
+	Sanitized bool `json:"sanitized,omitempty"`
 }
 
 type Extensions struct {
-	AuthorityInfoAccess           *string `json:"authorityInfoAccess,omitempty"`
-	AuthorityKeyIdentifier        *string `json:"authorityKeyIdentifier,omitempty"`
-	BasicConstraints              *string `json:"basicConstraints,omitempty"`
-	CertificatePolicies           *string `json:"certificatePolicies,omitempty"`
-	CtlSignedCertificateTimestamp *string `json:"ctlSignedCertificateTimestamp,omitempty"`
-	ExtendedKeyUsage              *string `json:"extendedKeyUsage,omitempty"`
-	KeyUsage                      *string `json:"keyUsage,omitempty"`
-	SubjectAltName                *string `json:"subjectAltName,omitempty"`
-	SubjectKeyIdentifier          *string `json:"subjectKeyIdentifier,omitempty"`
-	CTLPoisonByte                 bool    `json:"ctlPoisonByte,omitempty"`
+	AuthorityInfoAccess    *string `json:"authorityInfoAccess,omitempty"`
+	CRLDistributionPoints  *string `json:"crlDistributionPoints,omitempty"`
+	AuthorityKeyIdentifier *string `json:"authorityKeyIdentifier,omitempty"`
+	BasicConstraints       *string `json:"basicConstraints,omitempty"`
+	// CertificatePolicies are the policy OIDs of the certificate policies extension in dotted notation.
+	CertificatePolicies           []string `json:"certificatePolicies,omitempty"`
+	CtlSignedCertificateTimestamp *string  `json:"ctlSignedCertificateTimestamp,omitempty"`
+	ExtendedKeyUsage              *string  `json:"extendedKeyUsage,omitempty"`
+	KeyUsage                      *string  `json:"keyUsage,omitempty"`
+	SubjectAltName                *string  `json:"subjectAltName,omitempty"`
+	SubjectKeyIdentifier          *string  `json:"subjectKeyIdentifier,omitempty"`
+	CTLPoisonByte                 bool     `json:"ctlPoisonByte,omitempty"`
+	// BasicConstraintsPathLen is the pathLenConstraint of CA certificates. It is omitted if the certificate has no
+	// path length constraint, which is different from a path length of 0.
+	BasicConstraintsPathLen *int `json:"basicConstraintsPathLen,omitempty"`
+	// SubjectDirectoryAttributes are the decoded attributes of the subject directory attributes extension, e.g. of
+	// qualified certificates. Only set if enabled in the config.
+	SubjectDirectoryAttributes []SubjectDirectoryAttribute `json:"subjectDirectoryAttributes,omitempty"`
+}
+
+// ExtensionValue is a single extension of LeafCert.ExtensionsMap.
+type ExtensionValue struct {
+	Critical bool `json:"critical"`
+	// Value is the decoded value of known extensions (as in Extensions) or the base64 encoded DER value of all others.
+	Value string `json:"value"`
+}
+
+// SubjectDirectoryAttribute is a single attribute of the subject directory attributes extension.
+type SubjectDirectoryAttribute struct {
+	OID string `json:"oid"`
+	// Name is the name of known attributes, e.g. "dateOfBirth".
+	Name string `json:"name,omitempty"`
+	// Values are the decoded values of known attributes. Dates are formatted as RFC3339.
+	Values []string `json:"values,omitempty"`
+	// Raw are the base64 encoded DER values of unknown attributes or values that could not be decoded.
+	Raw []string `json:"raw,omitempty"`
 }
 
 type DomainsEntry struct {
-	Data        []string `json:"data"`
-	MessageType string   `json:"message_type"`
+	Data           []string `json:"data"`
+	MessageType    string   `json:"message_type"`
+	MatchedRules   []string `json:"matched_rules,omitempty"`
+	MatchedDomains []string `json:"matched_domains,omitempty"`
 }
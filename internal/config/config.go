@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/google/certificate-transparency-go/loglist3"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,30 +19,387 @@ var (
 )
 
 type ServerConfig struct {
-	ListenAddr  string   `yaml:"listen_addr"`
-	ListenPort  int      `yaml:"listen_port"`
-	CertPath    string   `yaml:"cert_path"`
-	CertKeyPath string   `yaml:"cert_key_path"`
-	RealIP      bool     `yaml:"real_ip"`
-	Whitelist   []string `yaml:"whitelist"`
+	ListenAddr  string `yaml:"listen_addr"`
+	ListenPort  int    `yaml:"listen_port"`
+	CertPath    string `yaml:"cert_path"`
+	CertKeyPath string `yaml:"cert_key_path"`
+	// CertReloadInterval is the interval in which the certificate files are checked for changes and reloaded.
+	CertReloadInterval time.Duration `yaml:"cert_reload_interval"`
+	RealIP             bool          `yaml:"real_ip"`
+	Whitelist          []string      `yaml:"whitelist"`
+	ReadTimeout        time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout  time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout       time.Duration `yaml:"write_timeout"`
+	IdleTimeout        time.Duration `yaml:"idle_timeout"`
+	// BasePath is prefixed to all routes of the server, e.g. "/certstream" when running behind a reverse proxy.
+	BasePath string `yaml:"base_path"`
+	// HTTP2 enables HTTP/2 over TLS and h2c (HTTP/2 without TLS). Defaults to true if not set.
+	HTTP2 *bool `yaml:"http2"`
+}
+
+// CCADBConfig configures the download of the ccadb data, which is used to attribute certificates to CA owners.
+type CCADBConfig struct {
+	URL string `yaml:"url"`
+	// KeyColumn and ValueColumn select the columns of the CSV by index or header name.
+	// The key column must contain the base64 encoded key identifier, the value column the CA owner.
+	KeyColumn   string `yaml:"key_column"`
+	ValueColumn string `yaml:"value_column"`
+	// Retries is the number of download attempts. Failed attempts are retried after RetryDelay,
+	// which is doubled after each attempt up to MaxRetryDelay.
+	Retries       int           `yaml:"retries"`
+	RetryDelay    time.Duration `yaml:"retry_delay"`
+	MaxRetryDelay time.Duration `yaml:"max_retry_delay"`
+	// MaxStaleness is the age of the ccadb data after which failed refreshes log a warning and the data is reported as
+	// stale in the status and metrics. Zero disables the check.
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	// IssuerRecord attaches more ccadb metadata of the issuing CA to each entry. The columns are selected
+	// by index or header name like KeyColumn; columns that can't be found are left empty.
+	IssuerRecord struct {
+		Enabled                bool   `yaml:"enabled"`
+		RecordTypeColumn       string `yaml:"record_type_column"`
+		RevocationStatusColumn string `yaml:"revocation_status_column"`
+		TrustBitsColumn        string `yaml:"trust_bits_column"`
+		AuditorColumn          string `yaml:"auditor_column"`
+		TrustStatusColumn      string `yaml:"trust_status_column"`
+	} `yaml:"issuer_record"`
+}
+
+// RevocationsConfig configures the revocation set, which is used to flag certificates reusing the issuer and serial
+// number of a revoked certificate.
+type RevocationsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Source is the url or path of a CSV file with a header row.
+	Source string `yaml:"source"`
+	// IssuerColumn and SerialColumn select the columns of the CSV by index or header name. The issuer column must
+	// contain the hex encoded SHA-256 fingerprint of the issuing certificate, the serial column the hex encoded serial.
+	IssuerColumn    string        `yaml:"issuer_column"`
+	SerialColumn    string        `yaml:"serial_column"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// LogCredentials are the basic auth credentials of the private CT log with the given url.
+type LogCredentials struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// LogEndpoints overrides the RFC 6962 get-sth and get-entries paths and the get-entries parameter names of the
+// CT log with the given url. Empty values keep the defaults.
+type LogEndpoints struct {
+	URL        string `yaml:"url"`
+	GetSTH     string `yaml:"get_sth"`
+	GetEntries string `yaml:"get_entries"`
+	StartParam string `yaml:"start_param"`
+	EndParam   string `yaml:"end_param"`
+}
+
+// SinkConfig configures a single sink that entries are written to in addition to the websocket clients.
+type SinkConfig struct {
+	Name string `yaml:"name"`
+	// Type is the kind of sink, e.g. "file" or "stdout".
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
+	// EntryTypes restricts the sink to "precert" or "final" certificates. Defaults to "all".
+	EntryTypes string `yaml:"entry_types"`
+	// WatchedOnly restricts the sink to entries matching one of the watched key identifiers of the parser.
+	WatchedOnly bool `yaml:"watched_only"`
+	// Lite writes entries without the chain and DER representation of the certificate.
+	Lite bool `yaml:"lite"`
+	// Canonical writes entries as canonical JSON with sorted keys for reproducible hashing.
+	Canonical bool `yaml:"canonical"`
+	// HashChain adds prev_hash and hash to each entry, which link the entries written to the sink to a hash chain.
+	// It requires a single worker, so that the entries are written in the order they were chained.
+	HashChain bool `yaml:"hash_chain"`
+	// Compression compresses the output of the file, stdout and s3 sinks with "gzip" or "zstd". Defaults to "none".
+	Compression string `yaml:"compression"`
+	// QueueSize is the number of entries buffered for the sink, Workers the number of goroutines writing to it.
+	QueueSize int `yaml:"queue_size"`
+	Workers   int `yaml:"workers"`
+	// Overflow decides what happens to entries while the queue is full: "drop" drops them right away, "block" waits
+	// up to BlockTimeout for space in the queue before dropping them, which delays all other sinks and the clients.
+	Overflow     string        `yaml:"overflow"`
+	BlockTimeout time.Duration `yaml:"block_timeout"`
+	// S3 configures sinks of type "s3".
+	S3 S3SinkConfig `yaml:"s3"`
+	// Redis configures sinks of type "redis".
+	Redis RedisSinkConfig `yaml:"redis"`
+	// PubSub configures sinks of type "pubsub".
+	PubSub PubSubSinkConfig `yaml:"pubsub"`
+	// SQLite configures sinks of type "sqlite", which write to the database at Path.
+	SQLite SQLiteSinkConfig `yaml:"sqlite"`
+}
+
+// SQLiteSinkConfig configures a sink that inserts entries into a local SQLite database.
+type SQLiteSinkConfig struct {
+	// Batches are committed in a single transaction when they reach MaxBatchEntries entries or after MaxBatchDelay.
+	MaxBatchEntries int           `yaml:"max_batch_entries"`
+	MaxBatchDelay   time.Duration `yaml:"max_batch_delay"`
+	// Retention deletes entries seen longer ago than this every PruneInterval. Zero keeps all entries.
+	Retention     time.Duration `yaml:"retention"`
+	PruneInterval time.Duration `yaml:"prune_interval"`
+}
+
+// PubSubSinkConfig configures a sink that publishes entries to a Google Cloud Pub/Sub topic.
+type PubSubSinkConfig struct {
+	Project string `yaml:"project"`
+	Topic   string `yaml:"topic"`
+	// CredentialsFile is a service account key or authorized user file. If empty, the application default
+	// credentials are used (GOOGLE_APPLICATION_CREDENTIALS or the metadata server).
+	CredentialsFile string `yaml:"credentials_file"`
+	// Endpoint overrides the Pub/Sub API endpoint, e.g. a regional endpoint.
+	Endpoint string `yaml:"endpoint"`
+	// OrderingKey sets the ordering key of the messages to the normalized url of the "log", the "operator" or "none".
+	OrderingKey string `yaml:"ordering_key"`
+	// Batches are published when they reach MaxBatchMessages messages or after MaxBatchDelay.
+	MaxBatchMessages int           `yaml:"max_batch_messages"`
+	MaxBatchDelay    time.Duration `yaml:"max_batch_delay"`
+}
+
+// RedisSinkConfig configures a sink that appends entries to a redis stream.
+type RedisSinkConfig struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	Stream   string `yaml:"stream"`
+	// Format is either "json" (the entry in a single field) or "fields" (the most common fields flattened).
+	Format string `yaml:"format"`
+	// MaxLen trims the stream to roughly this many entries. Zero disables trimming. ExactTrim trims to exactly
+	// MaxLen entries, which is more expensive for redis.
+	MaxLen    int64 `yaml:"max_len"`
+	ExactTrim bool  `yaml:"exact_trim"`
+}
+
+// S3SinkConfig configures a sink that uploads batches of entries to an S3 compatible object store.
+type S3SinkConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// Insecure uses http instead of https to connect to the endpoint.
+	Insecure bool `yaml:"insecure"`
+	// Prefix is prepended to the object keys, which are structured by date and hour.
+	Prefix string `yaml:"prefix"`
+	// Gzip is the same as compression "gzip" of the sink and only used if no compression is configured.
+	Gzip bool `yaml:"gzip"`
+	// Batches are uploaded when they reach MaxBatchSize bytes or after RotateInterval.
+	MaxBatchSize   int           `yaml:"max_batch_size"`
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+}
+
+// SyslogConfig configures the output of the log to syslog.
+type SyslogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Network is "local" (the local syslog socket), "udp", "tcp" or "tls". Address is the host:port of remote servers.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	// CAPath is an optional PEM file of the CA certificates used to verify the server with network "tls".
+	CAPath   string `yaml:"ca_path"`
+	Facility string `yaml:"facility"`
+	Tag      string `yaml:"tag"`
+	// KeepStderr logs to stderr in addition to syslog.
+	KeepStderr bool `yaml:"keep_stderr"`
 }
 
 type Config struct {
 	Webserver struct {
-		ServerConfig       `yaml:",inline"`
-		FullURL            string `yaml:"full_url"`
-		LiteURL            string `yaml:"lite_url"`
-		DomainsOnlyURL     string `yaml:"domains_only_url"`
+		ServerConfig   `yaml:",inline"`
+		FullURL        string `yaml:"full_url"`
+		LiteURL        string `yaml:"lite_url"`
+		DomainsOnlyURL string `yaml:"domains_only_url"`
+		StatusURL      string `yaml:"status_url"`
+		// PositionsURL serves the last index of each watched log for ctlogs.import_positions. Empty disables the endpoint.
+		PositionsURL string `yaml:"positions_url"`
+		// InclusionProofURL serves inclusion proofs of entries of watched logs on demand. Empty disables the endpoint.
+		InclusionProofURL  string `yaml:"inclusion_proof_url"`
 		CompressionEnabled bool   `yaml:"compression_enabled"`
+		// MaxMessageSize is the maximum size of a single message sent to websocket clients in bytes. Zero disables
+		// the limit. OversizedAction is either "trim" or "skip" for larger messages.
+		MaxMessageSize  int    `yaml:"max_message_size"`
+		OversizedAction string `yaml:"oversized_action"`
+		// MaxClientRate is the maximum number of entries per second sent to each client. Entries exceeding the rate
+		// are dropped. Clients can request a lower rate with the max_rate subscription option. Zero disables the limit.
+		MaxClientRate float64 `yaml:"max_client_rate"`
+		// ShutdownDrain configures how clients are disconnected on shutdown. Queued entries are sent within Timeout,
+		// then the connections are closed with a close frame suggesting to reconnect after ReconnectDelay.
+		ShutdownDrain struct {
+			Timeout        time.Duration `yaml:"timeout"`
+			ReconnectDelay time.Duration `yaml:"reconnect_delay"`
+		} `yaml:"shutdown_drain"`
+		// Analytics serves the counts of recent certificates by operator and registrable domain at URL. The counts
+		// are kept in memory for Window with at most MaxDomains registrable domains per minute.
+		Analytics struct {
+			Enabled    bool          `yaml:"enabled"`
+			URL        string        `yaml:"url"`
+			Window     time.Duration `yaml:"window"`
+			MaxDomains int           `yaml:"max_domains"`
+		} `yaml:"analytics"`
 	}
 	Prometheus struct {
 		ServerConfig        `yaml:",inline"`
 		Enabled             bool   `yaml:"enabled"`
 		MetricsURL          string `yaml:"metrics_url"`
+		SummaryURL          string `yaml:"summary_url"`
 		ExposeSystemMetrics bool   `yaml:"expose_system_metrics"`
+		// SubscriptionLabels labels the per-subscription metrics by subscription "type" or by "client". "none" disables them.
+		SubscriptionLabels string `yaml:"subscription_labels"`
 	}
 	CTLogs struct {
-		StartIndex []string `yaml:"startindex"`
+		StartIndex      []string          `yaml:"startindex"`
+		OperatorAliases map[string]string `yaml:"operator_aliases"`
+		BufferSize      int               `yaml:"buffer_size"`
+		// MaxCatchUpAge skips entries older than this while a log is catching up. Zero disables skipping.
+		MaxCatchUpAge time.Duration `yaml:"max_catch_up_age"`
+		// OperatorConcurrency limits the number of simultaneous requests to the logs of an operator, shared by all
+		// its workers. Operators are matched by their normalized name, operators not listed are not limited.
+		OperatorConcurrency map[string]int `yaml:"operator_concurrency"`
+		// StartJitter delays the start of each worker by a random duration below this value to spread the load of
+		// starting many workers at once. Zero starts all workers immediately.
+		StartJitter time.Duration `yaml:"start_jitter"`
+		// WarmUp is the period after startup during which worker restarts are aggregated into a periodic summary
+		// instead of being logged one by one. Zero disables the warm-up.
+		WarmUp time.Duration `yaml:"warm_up"`
+		// MinShardYear only watches logs whose shard starts in or after the given year. Zero watches all logs.
+		MinShardYear int `yaml:"min_shard_year"`
+		// RemoveAbsentAfter is the number of consecutive loglist refreshes a log must be missing from the loglist
+		// before its worker is stopped. Negative values never remove workers.
+		RemoveAbsentAfter int `yaml:"remove_absent_after"`
+		// LagAlert flags workers whose lag behind the latest tree size exceeds MaxEntries or the ratio MaxRatio of the
+		// tree size. Zero disables the respective threshold. The tree size is refreshed every STHRefreshInterval.
+		LagAlert struct {
+			MaxEntries         int64         `yaml:"max_entries"`
+			MaxRatio           float64       `yaml:"max_ratio"`
+			STHRefreshInterval time.Duration `yaml:"sth_refresh_interval"`
+		} `yaml:"lag_alert"`
+		// LogLists are the urls of the loglists to watch the logs of. Logs listed in multiple loglists are only watched once.
+		// LogListStatePreference is either "permissive" or "first" and decides which state is used if the lists disagree.
+		LogLists               []string `yaml:"loglists"`
+		LogListStatePreference string   `yaml:"loglist_state_preference"`
+		// Credentials are the basic auth credentials of private logs. They take precedence over credentials in the log url.
+		Credentials []LogCredentials `yaml:"credentials"`
+		// Endpoints are the endpoint paths and parameter names of logs that deviate from RFC 6962.
+		Endpoints []LogEndpoints `yaml:"endpoints"`
+		// ProgressLog logs the number of processed entries every Entries entries and/or once Interval passed since the
+		// last log. Zero or negative values disable the respective trigger.
+		ProgressLog struct {
+			Entries  int64         `yaml:"entries"`
+			Interval time.Duration `yaml:"interval"`
+		} `yaml:"progress_log"`
+		// ImportPositions is a file with positions exported from the positions endpoint. Logs resume at the imported
+		// positions unless a start index is configured for them.
+		ImportPositions string `yaml:"import_positions"`
+		// EmitDegradedEntries broadcasts entries that could not be parsed with their raw data as "degraded_entry".
+		EmitDegradedEntries bool `yaml:"emit_degraded_entries"`
+	}
+	CCADB       CCADBConfig
+	Revocations RevocationsConfig `yaml:"revocations"`
+	Processing  struct {
+		// DedupWindow only emits the first certificate per leaf fingerprint (SHA-256) within Window. Unlike the other
+		// processing options, the fingerprints are forgotten strictly by age and not bounded by a maximum count.
+		DedupWindow struct {
+			Enabled bool          `yaml:"enabled"`
+			Window  time.Duration `yaml:"window"`
+		} `yaml:"dedup_window"`
+		// CollapseRegDomains only emits the first certificate for each set of registrable domains within the window.
+		CollapseRegDomains struct {
+			Enabled    bool          `yaml:"enabled"`
+			Window     time.Duration `yaml:"window"`
+			MaxEntries int           `yaml:"max_entries"`
+		} `yaml:"collapse_reg_domains"`
+		// RegDomainRollup suppresses the entries of registrable domains with more than Threshold entries per Window
+		// and emits a reg_domain_summary with their count at the end of the window instead. At most MaxEntries
+		// registrable domains are tracked at once.
+		RegDomainRollup struct {
+			Enabled    bool          `yaml:"enabled"`
+			Window     time.Duration `yaml:"window"`
+			Threshold  int           `yaml:"threshold"`
+			MaxEntries int           `yaml:"max_entries"`
+		} `yaml:"reg_domain_rollup"`
+		// IssuerHeartbeat only emits the first certificate per issuer and Window, grouped by Key ("ca_owner" or "issuer",
+		// the fingerprint of the issuing certificate). At most MaxEntries issuers are tracked per window.
+		IssuerHeartbeat struct {
+			Enabled    bool          `yaml:"enabled"`
+			Key        string        `yaml:"key"`
+			Window     time.Duration `yaml:"window"`
+			MaxEntries int           `yaml:"max_entries"`
+		} `yaml:"issuer_heartbeat"`
+		// NewIssuers flags the first certificate of each issuer not seen before with new_issuer. Up to MaxEntries
+		// issuers are remembered and optionally persisted in StateFile across restarts.
+		NewIssuers struct {
+			Enabled    bool   `yaml:"enabled"`
+			MaxEntries int    `yaml:"max_entries"`
+			StateFile  string `yaml:"state_file"`
+		} `yaml:"new_issuers"`
+		// TBSConsistency correlates precertificates and final certificates seen within Window and flags pairs whose TBS
+		// differs in more than the poison extension and SCT list with tbs_mismatch. Up to MaxEntries are remembered.
+		TBSConsistency struct {
+			Enabled    bool          `yaml:"enabled"`
+			Window     time.Duration `yaml:"window"`
+			MaxEntries int           `yaml:"max_entries"`
+		} `yaml:"tbs_consistency"`
+		// NotYetValid handles certificates whose NotBefore is after the time they were seen: "flag" sets not_yet_valid,
+		// "drop" doesn't emit them. Empty emits them unchanged.
+		NotYetValid string `yaml:"not_yet_valid"`
+		// EntryHook evaluates the expr expression Expression (or the one in File) for each entry to drop or tag it.
+		// Evaluations exceeding Timeout or failing are counted and handled according to OnError ("keep" or "drop").
+		EntryHook struct {
+			Enabled    bool          `yaml:"enabled"`
+			Expression string        `yaml:"expression"`
+			File       string        `yaml:"file"`
+			Timeout    time.Duration `yaml:"timeout"`
+			OnError    string        `yaml:"on_error"`
+		} `yaml:"entry_hook"`
+	}
+	Logging struct {
+		Syslog SyslogConfig `yaml:"syslog"`
+	}
+	// Limits bound the resources used by the server.
+	Limits struct {
+		// MaxGoroutines is the budget of goroutines the ct workers and sinks may use in total. Zero disables the limit.
+		MaxGoroutines int `yaml:"max_goroutines"`
+	}
+	Sinks  []SinkConfig `yaml:"sinks"`
+	Parser struct {
+		RedactEmailAddresses bool `yaml:"redact_email_addresses"`
+		// SeenNanos adds the integer nanosecond timestamp seen_nanos to each entry.
+		SeenNanos bool `yaml:"seen_nanos"`
+		// IncludeSizes adds the size of the DER encoded certificate (der_size) and its chain (chain_size) in bytes.
+		IncludeSizes bool `yaml:"include_sizes"`
+		// TBSHashes adds tbs_sha1 and tbs_sha256 over the TBS of the leaf certificate, which are equal for a
+		// precertificate and its final certificate.
+		TBSHashes bool `yaml:"tbs_hashes"`
+		// LinkageID adds linkage_id to precertificates and final certificates, which is equal for both.
+		LinkageID bool `yaml:"linkage_id"`
+		// ExtensionsMap adds extensions_map with all extensions by name, their value and critical flag.
+		ExtensionsMap bool `yaml:"extensions_map"`
+		// NormalizeAggregated encodes the aggregated subject and issuer deterministically: sorted keys, empty fields
+		// omitted and the name attributes with their type and value as string.
+		NormalizeAggregated bool `yaml:"normalize_aggregated"`
+		// ISOTimestamps adds not_before_iso and not_after_iso as RFC3339 strings in addition to the unix timestamps.
+		ISOTimestamps bool `yaml:"iso_timestamps"`
+		// WatchedKeyIDs are hex encoded key identifiers of (e.g. compromised) CAs. Certificates with a matching authority
+		// key identifier or with a chain certificate with a matching subject key identifier are flagged with watched_key_ids.
+		WatchedKeyIDs []string `yaml:"watched_key_ids"`
+		// SubjectDirectoryAttributes decodes the subject directory attributes extension (e.g. date of birth), which
+		// contains personal data and is therefore disabled by default.
+		SubjectDirectoryAttributes bool `yaml:"subject_directory_attributes"`
+		// SpecialUseSuffixes are the suffixes of special-use names (e.g. "onion"), which are listed in special_use_names
+		// instead of the registrable domains.
+		SpecialUseSuffixes []string `yaml:"special_use_suffixes"`
+		// MultiOrgThreshold is the number of distinct registrable domains above which a certificate is flagged with multi_org_span.
+		MultiOrgThreshold int `yaml:"multi_org_threshold"`
+		// MinSCTCount flags final certificates with fewer embedded SCTs than this with low_sct_count. Zero disables the flag.
+		MinSCTCount int `yaml:"min_sct_count"`
+		// WeakCrypto configures the thresholds for flagging certificates with weak signature algorithms or key sizes.
+		WeakCrypto struct {
+			// SignatureAlgorithms are (parts of) signature algorithm names that are considered weak, e.g. "SHA1".
+			SignatureAlgorithms []string `yaml:"signature_algorithms"`
+			MinRSABits          int      `yaml:"min_rsa_bits"`
+			MinECDSABits        int      `yaml:"min_ecdsa_bits"`
+			MinDSABits          int      `yaml:"min_dsa_bits"`
+		} `yaml:"weak_crypto"`
 	}
 }
 
@@ -53,7 +412,7 @@ func ReadConfig(configPath string) (Config, error) {
 		log.Fatalln("Error while parsing yaml file:", parseErr)
 	}
 
-	if !validateConfig(conf) {
+	if !validateConfig(&conf) {
 		log.Fatalln("Invalid config")
 	}
 	AppConfig = conf
@@ -61,6 +420,14 @@ func ReadConfig(configPath string) (Config, error) {
 	return conf, nil
 }
 
+// ReloadConfig reads the config file again without validating it or replacing AppConfig. Callers must only apply
+// the settings that can be changed at runtime, so that an invalid config can't stop the running server.
+func ReloadConfig(configPath string) (Config, error) {
+	log.Printf("Reloading config file '%s'...\n", configPath)
+
+	return parseConfigFromFile(configPath)
+}
+
 // parseConfigFromFile reads the config file as bytes and passes it to parseConfigFromBytes.
 // It returns a filled Config struct.
 func parseConfigFromFile(configFile string) (Config, error) {
@@ -123,7 +490,7 @@ func parseConfigFromBytes(data []byte) (Config, error) {
 }
 
 // validateConfig validates the config values and sets defaults for missing values.
-func validateConfig(config Config) bool {
+func validateConfig(config *Config) bool {
 	// Still matches invalid IP addresses but good enough for detecting completely wrong formats
 	URLRegex := regexp.MustCompile(`^(/[a-zA-Z0-9\-._]+)+$`)
 
@@ -138,27 +505,285 @@ func validateConfig(config Config) bool {
 		return false
 	}
 
+	validateServerConfig(&config.Webserver.ServerConfig)
+
 	if config.Webserver.FullURL == "" || !URLRegex.MatchString(config.Webserver.FullURL) {
 		log.Println("Webhook full URL is not set or does not match pattern '/...'")
 		config.Webserver.FullURL = "/full-stream"
 	}
 
-	if config.Webserver.LiteURL == "" || !URLRegex.MatchString(config.Webserver.FullURL) {
+	if config.Webserver.LiteURL == "" || (config.Webserver.LiteURL != "/" && !URLRegex.MatchString(config.Webserver.LiteURL)) {
 		log.Println("Webhook lite URL is not set or does not match pattern '/...'")
 		config.Webserver.LiteURL = "/"
 	}
 
 	if config.Webserver.DomainsOnlyURL == "" || !URLRegex.MatchString(config.Webserver.DomainsOnlyURL) {
 		log.Println("Webhook domains only URL is not set or does not match pattern '/...'")
-		config.Webserver.FullURL = "/domains-only"
+		config.Webserver.DomainsOnlyURL = "/domains-only"
 	}
 
 	if config.Webserver.FullURL == config.Webserver.LiteURL {
 		log.Fatalln("Webhook full URL is the same as lite URL - please fix the config!")
 	}
 
-	if config.Webserver.DomainsOnlyURL == "" {
-		config.Webserver.FullURL = "/domains-only"
+	if config.Webserver.StatusURL == "" || !URLRegex.MatchString(config.Webserver.StatusURL) {
+		log.Println("Webhook status URL is not set or does not match pattern '/...'")
+		config.Webserver.StatusURL = "/status"
+	}
+
+	if config.Webserver.PositionsURL != "" && !URLRegex.MatchString(config.Webserver.PositionsURL) {
+		log.Fatalln("Webserver positions URL does not match pattern '/...':", config.Webserver.PositionsURL)
+	}
+
+	if config.Webserver.InclusionProofURL != "" && !URLRegex.MatchString(config.Webserver.InclusionProofURL) {
+		log.Fatalln("Webserver inclusion proof URL does not match pattern '/...':", config.Webserver.InclusionProofURL)
+	}
+
+	switch config.Webserver.OversizedAction = strings.ToLower(config.Webserver.OversizedAction); config.Webserver.OversizedAction {
+	case "":
+		config.Webserver.OversizedAction = "trim"
+	case "trim", "skip":
+	default:
+		log.Fatalln("Webserver oversized_action must be 'trim' or 'skip', got:", config.Webserver.OversizedAction)
+	}
+
+	if config.Webserver.Analytics.Enabled {
+		if config.Webserver.Analytics.URL == "" || !URLRegex.MatchString(config.Webserver.Analytics.URL) {
+			log.Println("Analytics URL is not set or does not match pattern '/...'")
+			config.Webserver.Analytics.URL = "/analytics"
+		}
+
+		if config.Webserver.Analytics.Window <= 0 {
+			config.Webserver.Analytics.Window = time.Hour
+		}
+
+		if config.Webserver.Analytics.MaxDomains <= 0 {
+			config.Webserver.Analytics.MaxDomains = 10000
+		}
+	}
+
+	if config.Logging.Syslog.Enabled {
+		validateSyslogConfig(&config.Logging.Syslog)
+	}
+
+	if config.Webserver.ShutdownDrain.Timeout <= 0 {
+		config.Webserver.ShutdownDrain.Timeout = 5 * time.Second
+	}
+
+	if config.Webserver.ShutdownDrain.ReconnectDelay < 0 {
+		config.Webserver.ShutdownDrain.ReconnectDelay = 0
+	}
+
+	for operator, concurrency := range config.CTLogs.OperatorConcurrency {
+		if concurrency <= 0 {
+			log.Fatalf("ctlogs.operator_concurrency of '%s' must be greater than 0\n", operator)
+		}
+	}
+
+	if config.Revocations.Enabled {
+		if config.Revocations.Source == "" {
+			log.Fatalln("revocations.source must be set if revocations are enabled")
+		}
+
+		if config.Revocations.IssuerColumn == "" {
+			config.Revocations.IssuerColumn = "0"
+		}
+
+		if config.Revocations.SerialColumn == "" {
+			config.Revocations.SerialColumn = "1"
+		}
+
+		if config.Revocations.RefreshInterval <= 0 {
+			config.Revocations.RefreshInterval = time.Hour
+		}
+	}
+
+	if config.CCADB.URL == "" {
+		config.CCADB.URL = "https://ccadb.my.salesforce-sites.com/ccadb/AllCertificateRecordsCSVFormatv2"
+	}
+
+	if config.CCADB.KeyColumn == "" {
+		config.CCADB.KeyColumn = "18"
+	}
+
+	if config.CCADB.ValueColumn == "" {
+		config.CCADB.ValueColumn = "0"
+	}
+
+	if config.CCADB.Retries <= 0 {
+		config.CCADB.Retries = 3
+	}
+
+	if config.CCADB.RetryDelay <= 0 {
+		config.CCADB.RetryDelay = time.Second
+	}
+
+	if config.CCADB.MaxRetryDelay <= 0 {
+		config.CCADB.MaxRetryDelay = time.Minute
+	}
+
+	if config.CCADB.IssuerRecord.RecordTypeColumn == "" {
+		config.CCADB.IssuerRecord.RecordTypeColumn = "Certificate Record Type"
+	}
+
+	if config.CCADB.IssuerRecord.RevocationStatusColumn == "" {
+		config.CCADB.IssuerRecord.RevocationStatusColumn = "Revocation Status"
+	}
+
+	if config.CCADB.IssuerRecord.TrustBitsColumn == "" {
+		config.CCADB.IssuerRecord.TrustBitsColumn = "Derived Trust Bits"
+	}
+
+	if config.CCADB.IssuerRecord.AuditorColumn == "" {
+		config.CCADB.IssuerRecord.AuditorColumn = "Auditor"
+	}
+
+	if config.CCADB.IssuerRecord.TrustStatusColumn == "" {
+		config.CCADB.IssuerRecord.TrustStatusColumn = "Status of Root Cert"
+	}
+
+	switch strings.ToLower(config.Processing.IssuerHeartbeat.Key) {
+	case "", "ca_owner":
+		config.Processing.IssuerHeartbeat.Key = "ca_owner"
+	case "issuer":
+		config.Processing.IssuerHeartbeat.Key = "issuer"
+	default:
+		log.Fatalln("Processing issuer_heartbeat key must be 'ca_owner' or 'issuer', got:", config.Processing.IssuerHeartbeat.Key)
+	}
+
+	if config.Processing.DedupWindow.Window <= 0 {
+		config.Processing.DedupWindow.Window = time.Minute
+	}
+
+	if config.Processing.IssuerHeartbeat.Window <= 0 {
+		config.Processing.IssuerHeartbeat.Window = time.Minute
+	}
+
+	if config.Processing.IssuerHeartbeat.MaxEntries <= 0 {
+		config.Processing.IssuerHeartbeat.MaxEntries = 10_000
+	}
+
+	if config.Processing.NewIssuers.MaxEntries <= 0 {
+		config.Processing.NewIssuers.MaxEntries = 100_000
+	}
+
+	if config.Webserver.MaxClientRate < 0 {
+		log.Fatalln("Webserver max_client_rate must not be negative")
+	}
+
+	switch config.Processing.NotYetValid = strings.ToLower(config.Processing.NotYetValid); config.Processing.NotYetValid {
+	case "", "flag", "drop":
+	default:
+		log.Fatalln("Processing not_yet_valid must be 'flag' or 'drop', got:", config.Processing.NotYetValid)
+	}
+
+	if config.Processing.EntryHook.Timeout <= 0 {
+		config.Processing.EntryHook.Timeout = 10 * time.Millisecond
+	}
+
+	switch config.Processing.EntryHook.OnError = strings.ToLower(config.Processing.EntryHook.OnError); config.Processing.EntryHook.OnError {
+	case "":
+		config.Processing.EntryHook.OnError = "keep"
+	case "keep", "drop":
+	default:
+		log.Fatalln("Processing entry_hook on_error must be 'keep' or 'drop', got:", config.Processing.EntryHook.OnError)
+	}
+
+	if config.Processing.TBSConsistency.Window <= 0 {
+		config.Processing.TBSConsistency.Window = 24 * time.Hour
+	}
+
+	if config.Processing.TBSConsistency.MaxEntries <= 0 {
+		config.Processing.TBSConsistency.MaxEntries = 1_000_000
+	}
+
+	if config.Processing.CollapseRegDomains.Window <= 0 {
+		config.Processing.CollapseRegDomains.Window = 24 * time.Hour
+	}
+
+	if config.Processing.CollapseRegDomains.MaxEntries <= 0 {
+		config.Processing.CollapseRegDomains.MaxEntries = 1_000_000
+	}
+
+	if config.Processing.RegDomainRollup.Window <= 0 {
+		config.Processing.RegDomainRollup.Window = time.Minute
+	}
+
+	if config.Processing.RegDomainRollup.Threshold <= 0 {
+		config.Processing.RegDomainRollup.Threshold = 100
+	}
+
+	if config.Processing.RegDomainRollup.MaxEntries <= 0 {
+		config.Processing.RegDomainRollup.MaxEntries = 100_000
+	}
+
+	if config.Parser.SpecialUseSuffixes == nil {
+		config.Parser.SpecialUseSuffixes = []string{"onion"}
+	}
+
+	for i, suffix := range config.Parser.SpecialUseSuffixes {
+		config.Parser.SpecialUseSuffixes[i] = strings.ToLower(strings.Trim(suffix, "."))
+	}
+
+	if config.Parser.MultiOrgThreshold <= 0 {
+		config.Parser.MultiOrgThreshold = 1
+	}
+
+	weakCrypto := &config.Parser.WeakCrypto
+	if weakCrypto.SignatureAlgorithms == nil {
+		weakCrypto.SignatureAlgorithms = []string{"MD2", "MD5", "SHA1"}
+	}
+
+	if weakCrypto.MinRSABits <= 0 {
+		weakCrypto.MinRSABits = 2048
+	}
+
+	if weakCrypto.MinECDSABits <= 0 {
+		weakCrypto.MinECDSABits = 256
+	}
+
+	if weakCrypto.MinDSABits <= 0 {
+		weakCrypto.MinDSABits = 2048
+	}
+
+	if config.CTLogs.BufferSize <= 0 {
+		config.CTLogs.BufferSize = 5000
+	}
+
+	// Key identifiers are matched in the lowercase hex format without separators used for authority_key_identifier
+	for i, keyID := range config.Parser.WatchedKeyIDs {
+		keyID = strings.ToLower(strings.TrimSpace(keyID))
+		config.Parser.WatchedKeyIDs[i] = strings.NewReplacer(":", "", " ", "").Replace(keyID)
+	}
+
+	if len(config.CTLogs.LogLists) == 0 {
+		config.CTLogs.LogLists = []string{loglist3.LogListURL}
+	}
+
+	switch config.CTLogs.LogListStatePreference = strings.ToLower(config.CTLogs.LogListStatePreference); config.CTLogs.LogListStatePreference {
+	case "":
+		config.CTLogs.LogListStatePreference = "permissive"
+	case "permissive", "first":
+	default:
+		log.Fatalln("CTLogs loglist_state_preference must be 'permissive' or 'first', got:", config.CTLogs.LogListStatePreference)
+	}
+
+	for _, endpoints := range config.CTLogs.Endpoints {
+		if endpoints.URL == "" {
+			log.Fatalln("CTLogs endpoints must have a url")
+		}
+	}
+
+	if config.CTLogs.LagAlert.STHRefreshInterval <= 0 {
+		config.CTLogs.LagAlert.STHRefreshInterval = time.Minute
+	}
+
+	if config.CTLogs.ProgressLog.Interval == 0 {
+		config.CTLogs.ProgressLog.Interval = time.Minute
+	}
+
+	if config.CTLogs.RemoveAbsentAfter == 0 {
+		config.CTLogs.RemoveAbsentAfter = 3
 	}
 
 	if config.Prometheus.Enabled {
@@ -173,6 +798,21 @@ func validateConfig(config Config) bool {
 			return false
 		}
 
+		validateServerConfig(&config.Prometheus.ServerConfig)
+
+		if config.Prometheus.SummaryURL == "" || !URLRegex.MatchString(config.Prometheus.SummaryURL) {
+			log.Println("Metrics summary URL is not set or does not match pattern '/...'")
+			config.Prometheus.SummaryURL = strings.TrimSuffix(config.Prometheus.MetricsURL, "/") + "/summary"
+		}
+
+		switch config.Prometheus.SubscriptionLabels = strings.ToLower(config.Prometheus.SubscriptionLabels); config.Prometheus.SubscriptionLabels {
+		case "":
+			config.Prometheus.SubscriptionLabels = "type"
+		case "type", "client", "none":
+		default:
+			log.Fatalln("Metrics subscription_labels must be 'type', 'client' or 'none', got:", config.Prometheus.SubscriptionLabels)
+		}
+
 		if config.Prometheus.Whitelist == nil {
 			config.Prometheus.Whitelist = []string{}
 		}
@@ -192,3 +832,55 @@ func validateConfig(config Config) bool {
 
 	return true
 }
+
+// validateServerConfig sets defaults for the timeouts and HTTP/2 setting of a server config.
+// WebSocket connections set their own deadlines after the upgrade, so these timeouts don't affect long-lived streams.
+func validateServerConfig(serverConfig *ServerConfig) {
+	if serverConfig.ReadTimeout <= 0 {
+		serverConfig.ReadTimeout = 10 * time.Second
+	}
+
+	if serverConfig.ReadHeaderTimeout <= 0 {
+		serverConfig.ReadHeaderTimeout = 2 * time.Second
+	}
+
+	if serverConfig.WriteTimeout <= 0 {
+		serverConfig.WriteTimeout = 10 * time.Second
+	}
+
+	if serverConfig.IdleTimeout <= 0 {
+		serverConfig.IdleTimeout = time.Minute
+	}
+
+	if serverConfig.CertReloadInterval <= 0 {
+		serverConfig.CertReloadInterval = time.Minute
+	}
+
+	if serverConfig.HTTP2 == nil {
+		http2 := true
+		serverConfig.HTTP2 = &http2
+	}
+}
+
+// validateSyslogConfig sets the defaults of the syslog output and exits if the network or address is invalid.
+func validateSyslogConfig(syslogConfig *SyslogConfig) {
+	switch syslogConfig.Network = strings.ToLower(syslogConfig.Network); syslogConfig.Network {
+	case "":
+		syslogConfig.Network = "local"
+	case "local":
+	case "udp", "tcp", "tls":
+		if syslogConfig.Address == "" {
+			log.Fatalf("Syslog address must be set for network '%s'\n", syslogConfig.Network)
+		}
+	default:
+		log.Fatalln("Syslog network must be 'local', 'udp', 'tcp' or 'tls', got:", syslogConfig.Network)
+	}
+
+	if syslogConfig.Facility == "" {
+		syslogConfig.Facility = "daemon"
+	}
+
+	if syslogConfig.Tag == "" {
+		syslogConfig.Tag = "certstream-server-go"
+	}
+}
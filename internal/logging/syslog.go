@@ -0,0 +1,222 @@
+// Package logging redirects the log of the server to syslog.
+package logging
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+// severityInfo is the syslog severity of all log messages, as the log has no levels.
+const severityInfo = 6
+
+const (
+	dialTimeout = 10 * time.Second
+	// reconnectInterval is the minimum time between two reconnects, so an unreachable server doesn't block every log line.
+	reconnectInterval = 30 * time.Second
+)
+
+// facilities maps the names of the syslog facilities to their codes (RFC 5424, 6.2.1).
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7, "uucp": 8,
+	"cron": 9, "authpriv": 10, "ftp": 11, "local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20,
+	"local5": 21, "local6": 22, "local7": 23,
+}
+
+// localSyslogPaths are the usual paths of the local syslog socket.
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SetupSyslog redirects the standard logger to syslog. If syslog can't be reached, the log stays on stderr.
+func SetupSyslog(syslogConfig config.SyslogConfig) {
+	writer, err := newSyslogWriter(syslogConfig)
+	if err != nil {
+		log.Println("Could not set up syslog, logging to stderr:", err)
+		return
+	}
+
+	if err = writer.connect(); err != nil {
+		log.Println("Could not connect to syslog, logging to stderr:", err)
+		return
+	}
+
+	log.Printf("Logging to syslog (%s %s)\n", syslogConfig.Network, syslogConfig.Address)
+
+	if syslogConfig.KeepStderr {
+		log.SetOutput(io.MultiWriter(os.Stderr, writer))
+		return
+	}
+
+	// Syslog adds its own timestamp to each message
+	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime | log.Lmicroseconds))
+	log.SetOutput(writer)
+}
+
+// syslogWriter writes each log line as RFC 5424 message to syslog. It reconnects if writing fails and falls back to
+// stderr while syslog is unreachable. It is safe for concurrent use.
+type syslogWriter struct {
+	mu        sync.Mutex
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	priority  int
+	hostname  string
+	tag       string
+	pid       int
+	conn      net.Conn
+	framing   framing
+	// lastConnect is the time of the last connection attempt.
+	lastConnect time.Time
+}
+
+// framing is the way messages are separated on the connection.
+type framing int
+
+const (
+	// framingNone sends each message as a single datagram.
+	framingNone framing = iota
+	// framingOctetCounting prefixes each message with its length (RFC 6587) for remote stream connections.
+	framingOctetCounting
+	// framingNewline terminates each message with a newline, as local stream sockets expect.
+	framingNewline
+)
+
+// newSyslogWriter creates a syslogWriter for the given config without connecting to syslog.
+func newSyslogWriter(syslogConfig config.SyslogConfig) (*syslogWriter, error) {
+	facility, ok := facilities[strings.ToLower(syslogConfig.Facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility '%s'", syslogConfig.Facility)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	writer := &syslogWriter{
+		network:  syslogConfig.Network,
+		address:  syslogConfig.Address,
+		priority: facility*8 + severityInfo,
+		hostname: hostname,
+		tag:      syslogConfig.Tag,
+		pid:      os.Getpid(),
+	}
+
+	if syslogConfig.Network == "tls" {
+		writer.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+		if syslogConfig.CAPath != "" {
+			caCerts, readErr := os.ReadFile(syslogConfig.CAPath)
+			if readErr != nil {
+				return nil, readErr
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caCerts) {
+				return nil, fmt.Errorf("no certificates found in '%s'", syslogConfig.CAPath)
+			}
+
+			writer.tlsConfig.RootCAs = pool
+		}
+	}
+
+	return writer, nil
+}
+
+// connect (re)establishes the connection to syslog.
+func (w *syslogWriter) connect() error {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	w.lastConnect = time.Now()
+
+	var err error
+
+	switch w.network {
+	case "local":
+		w.conn, w.framing, err = dialLocalSyslog()
+	case "tls":
+		w.conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", w.address, w.tlsConfig)
+		w.framing = framingOctetCounting
+	default:
+		w.conn, err = net.DialTimeout(w.network, w.address, dialTimeout)
+
+		w.framing = framingNone
+		if w.network == "tcp" {
+			w.framing = framingOctetCounting
+		}
+	}
+
+	if err != nil {
+		w.conn = nil
+	}
+
+	return err
+}
+
+// dialLocalSyslog connects to the first local syslog socket that accepts connections.
+func dialLocalSyslog() (net.Conn, framing, error) {
+	for _, path := range localSyslogPaths {
+		if conn, err := net.DialTimeout("unixgram", path, dialTimeout); err == nil {
+			return conn, framingNone, nil
+		}
+
+		if conn, err := net.DialTimeout("unix", path, dialTimeout); err == nil {
+			return conn, framingNewline, nil
+		}
+	}
+
+	return nil, framingNone, errors.New("no local syslog socket found")
+}
+
+// Write sends a single log line to syslog.
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		if _, err := w.conn.Write(w.format(msg)); err == nil {
+			return len(p), nil
+		}
+	}
+
+	if time.Since(w.lastConnect) < reconnectInterval {
+		return os.Stderr.Write(p)
+	}
+
+	if err := w.connect(); err == nil {
+		if _, err = w.conn.Write(w.format(msg)); err == nil {
+			return len(p), nil
+		}
+	}
+
+	return os.Stderr.Write(p)
+}
+
+// format formats the message as RFC 5424 syslog message with the framing of the current connection.
+func (w *syslogWriter) format(msg string) []byte {
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	line := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.priority, timestamp, w.hostname, w.tag, w.pid, msg)
+
+	switch w.framing {
+	case framingOctetCounting:
+		return []byte(fmt.Sprintf("%d %s", len(line), line))
+	case framingNewline:
+		return []byte(line + "\n")
+	default:
+		return []byte(line)
+	}
+}
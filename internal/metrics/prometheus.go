@@ -7,19 +7,26 @@ import (
 	"sync"
 	"time"
 
+	"github.com/d-Rickyy-b/certstream-server-go/internal/budget"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/certificatetransparency"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/sinks"
 	"github.com/d-Rickyy-b/certstream-server-go/internal/web"
 
 	"github.com/VictoriaMetrics/metrics"
 )
 
 var (
-	ctLogMetricsInitialized = false
-	ctLogMetricsInitMutex   = &sync.Mutex{}
-
+	// ctLogMetricsMutex guards the cached cert counts per log.
+	ctLogMetricsMutex            = &sync.Mutex{}
 	tempCertMetricsLastRefreshed = time.Time{}
 	tempCertMetrics              = certificatetransparency.CTMetrics{}
 
+	// entrySinks are the configured sinks, whose counters are exported.
+	entrySinks *sinks.Fanout
+
+	// watcher is the CT watcher, whose worker lag is exported.
+	watcher *certificatetransparency.Watcher
+
 	// Number of currently connected clients.
 	fullClientCount = metrics.NewGauge("certstreamservergo_clients_total{type=\"full\"}", func() float64 {
 		return float64(web.ClientHandler.ClientFullCount())
@@ -38,46 +45,162 @@ var (
 	processedPreCertificates = metrics.NewGauge("certstreamservergo_certificates_total{type=\"precert\"}", func() float64 {
 		return float64(certificatetransparency.GetProcessedPrecerts())
 	})
+
+	// Number of emitted CA and end-entity certificates, split by whether they were the logged certificate or part of the chain.
+	caCertificatesEntry = metrics.NewGauge(`certstreamservergo_certificates_by_ca_total{is_ca="true",position="entry"}`, func() float64 {
+		entry, _ := certificatetransparency.GetCACertificates()
+		return float64(entry)
+	})
+	caCertificatesChain = metrics.NewGauge(`certstreamservergo_certificates_by_ca_total{is_ca="true",position="chain"}`, func() float64 {
+		_, chain := certificatetransparency.GetCACertificates()
+		return float64(chain)
+	})
+	endEntityCertificatesEntry = metrics.NewGauge(`certstreamservergo_certificates_by_ca_total{is_ca="false",position="entry"}`, func() float64 {
+		entry, _ := certificatetransparency.GetEndEntityCertificates()
+		return float64(entry)
+	})
+	endEntityCertificatesChain = metrics.NewGauge(`certstreamservergo_certificates_by_ca_total{is_ca="false",position="chain"}`, func() float64 {
+		_, chain := certificatetransparency.GetEndEntityCertificates()
+		return float64(chain)
+	})
+
+	// Number of entries that were not broadcast because the scanner re-delivered an already emitted index.
+	duplicateIndices = metrics.NewGauge("certstreamservergo_duplicate_indices_total", func() float64 {
+		return float64(certificatetransparency.GetDuplicateIndices())
+	})
+
+	// Number of entries skipped during catch-up because they were older than the configured max_catch_up_age.
+	staleSkipped = metrics.NewGauge("certstreamservergo_catch_up_skipped_total", func() float64 {
+		return float64(certificatetransparency.GetStaleSkipped())
+	})
+
+	// Number of entries without certificate data, which are not emitted (or only as degraded entries).
+	emptyDERs = metrics.NewGauge("certstreamservergo_empty_der_total", func() float64 {
+		return float64(certificatetransparency.GetEmptyDERs())
+	})
+
+	// Number of entries suppressed by processing.collapse_reg_domains and the number of remembered reg-domain sets.
+	collapsedEntries = metrics.NewGauge("certstreamservergo_collapsed_entries_total", func() float64 {
+		return float64(certificatetransparency.GetCollapsedEntries())
+	})
+	collapseCacheSize = metrics.NewGauge("certstreamservergo_collapse_cache_size", func() float64 {
+		return float64(certificatetransparency.GetCollapseCacheSize())
+	})
+
+	// Number of entries suppressed by processing.reg_domain_rollup in favor of a reg_domain_summary.
+	rolledUpEntries = metrics.NewGauge("certstreamservergo_rolled_up_entries_total", func() float64 {
+		return float64(certificatetransparency.GetRolledUpEntries())
+	})
+
+	// Number of entries suppressed by processing.issuer_heartbeat because their issuer was already emitted in the window.
+	heartbeatSuppressed = metrics.NewGauge("certstreamservergo_heartbeat_suppressed_entries_total", func() float64 {
+		return float64(certificatetransparency.GetHeartbeatSuppressed())
+	})
+
+	// Number of entries suppressed by processing.dedup_window, the number of fingerprints currently in the window and
+	// the configured window in seconds.
+	dedupHits = metrics.NewGauge("certstreamservergo_dedup_hits_total", func() float64 {
+		return float64(certificatetransparency.GetDedupHits())
+	})
+	dedupEntries = metrics.NewGauge("certstreamservergo_dedup_window_entries", func() float64 {
+		return float64(certificatetransparency.GetDedupEntries())
+	})
+	dedupWindow = metrics.NewGauge("certstreamservergo_dedup_window_seconds", func() float64 {
+		return certificatetransparency.GetDedupWindow().Seconds()
+	})
+
+	// Number of certificates whose NotBefore was in the future when they were seen.
+	notYetValidCerts = metrics.NewGauge("certstreamservergo_not_yet_valid_certs_total", func() float64 {
+		return float64(certificatetransparency.GetNotYetValidCerts())
+	})
+
+	// Number of certificates whose issuer and serial number are in the revocation set and the size of the loaded set.
+	revokedSerialCerts = metrics.NewGauge("certstreamservergo_revoked_serial_certs_total", func() float64 {
+		return float64(certificatetransparency.GetRevokedSerialCerts())
+	})
+	revocationSetSize = metrics.NewGauge("certstreamservergo_revocation_set_size", func() float64 {
+		return float64(certificatetransparency.GetRevocationSetSize())
+	})
+
+	// Number of entries dropped by processing.entry_hook and the number of failed and timed out evaluations.
+	hookDropped = metrics.NewGauge("certstreamservergo_hook_dropped_entries_total", func() float64 {
+		return float64(certificatetransparency.GetHookDropped())
+	})
+	hookErrors = metrics.NewGauge("certstreamservergo_hook_errors_total", func() float64 {
+		return float64(certificatetransparency.GetHookErrors())
+	})
+	hookTimeouts = metrics.NewGauge("certstreamservergo_hook_timeouts_total", func() float64 {
+		return float64(certificatetransparency.GetHookTimeouts())
+	})
+
+	// Number of entries whose TBS differs from their precertificate or final certificate.
+	tbsMismatches = metrics.NewGauge("certstreamservergo_tbs_mismatches_total", func() float64 {
+		return float64(certificatetransparency.GetTBSMismatches())
+	})
+
+	// Number of entries flagged as the first certificate of an issuer not seen before.
+	newIssuers = metrics.NewGauge("certstreamservergo_new_issuers_total", func() float64 {
+		return float64(certificatetransparency.GetNewIssuers())
+	})
+
+	// Number of entries waiting to be broadcast and the capacity of that queue (ctlogs.buffer_size).
+	queueLength = metrics.NewGauge("certstreamservergo_queue_length", func() float64 {
+		return float64(certificatetransparency.GetQueueLength())
+	})
+	queueCapacity = metrics.NewGauge("certstreamservergo_queue_capacity", func() float64 {
+		return float64(certificatetransparency.GetQueueCapacity())
+	})
+
+	// Number of goroutines acquired by the ct workers and sinks and the size of the goroutine budget (0 = unlimited).
+	goroutinesUsed = metrics.NewGauge("certstreamservergo_goroutine_budget_used", func() float64 {
+		return float64(budget.Goroutines.Used())
+	})
+	goroutinesMax = metrics.NewGauge("certstreamservergo_goroutine_budget_max", func() float64 {
+		return float64(budget.Goroutines.Max())
+	})
+
+	// Number of domains for which the registrable domain could not be extracted and the raw domain was used instead.
+	regDomainFallbacks = metrics.NewGauge("certstreamservergo_regdomain_fallbacks_total", func() float64 {
+		return float64(certificatetransparency.GetRegDomainFallbacks())
+	})
 )
 
 // WritePrometheus provides an easy way to write metrics to a writer.
 func WritePrometheus(w io.Writer, exposeProcessMetrics bool) {
-	ctLogMetricsInitMutex.Lock()
-	if !ctLogMetricsInitialized {
-		initCtLogMetrics()
-	}
-	ctLogMetricsInitMutex.Unlock()
-
+	registerCtLogMetrics(certificatetransparency.GetLogOperators())
 	getSkippedCertMetrics()
+	getConversionFailureMetrics()
+	getSinkMetrics()
+	getWorkerLagMetrics()
+	getOperatorInFlightMetrics()
 
 	metrics.WritePrometheus(w, exposeProcessMetrics)
 }
 
 // For having metrics regarding each individual CT log, we need to register them manually.
-// initCtLogMetrics fetches all the CT Logs and registers one metric per log.
-func initCtLogMetrics() {
-	logs := certificatetransparency.GetLogOperators()
-
+// registerCtLogMetrics registers one metric per log of the given operators if it isn't registered yet. Registering
+// the gauges again on every scrape, instead of only on the first one, exports the logs that were counted later on as
+// well - including logs that were counted before their initialization (see certificatetransparency.LogMetrics.Inc).
+func registerCtLogMetrics(logs certificatetransparency.OperatorLogs) {
 	for operator, urls := range logs {
 		operator := operator // Copy variable to new scope
 
 		for i := 0; i < len(urls); i++ {
 			url := urls[i]
 			name := fmt.Sprintf("certstreamservergo_certs_by_log_total{url=\"%s\",operator=\"%s\"}", url, operator)
-			metrics.NewGauge(name, func() float64 {
+			metrics.GetOrCreateGauge(name, func() float64 {
 				return float64(getCertCountForLog(operator, url))
 			})
 		}
 	}
-
-	if len(logs) > 0 {
-		ctLogMetricsInitialized = true
-	}
 }
 
 // getCertCountForLog returns the number of certificates processed from a specific CT log.
 // It caches the result for 5 seconds. Subsequent calls to this method will return the cached result.
 func getCertCountForLog(operatorName, logname string) int64 {
+	ctLogMetricsMutex.Lock()
+	defer ctLogMetricsMutex.Unlock()
+
 	// Add some caching to avoid having to lock the mutex every time
 	if time.Since(tempCertMetricsLastRefreshed) > time.Second*5 {
 		tempCertMetricsLastRefreshed = time.Now()
@@ -116,3 +239,76 @@ func getSkippedCertMetrics() {
 		}
 	}
 }
+
+// getConversionFailureMetrics sets the number of entries per CT log that could not be converted to a log entry.
+func getConversionFailureMetrics() {
+	for operator, urls := range certificatetransparency.GetConversionFailures() {
+		for url, count := range urls {
+			metricName := fmt.Sprintf("certstreamservergo_conversion_failures_total{url=\"%s\",operator=\"%s\"}", url, operator)
+			metrics.GetOrCreateCounter(metricName).Set(uint64(count))
+		}
+	}
+}
+
+// SetSinks sets the sinks whose written, failed and dropped entries are exported as metrics.
+func SetSinks(fanout *sinks.Fanout) {
+	entrySinks = fanout
+}
+
+// getSinkMetrics sets the number of written, failed, dropped and filtered entries as well as the queue depth for each sink.
+func getSinkMetrics() {
+	for name, stats := range entrySinks.Stats() {
+		metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_sink_entries_total{sink=%q,result=\"written\"}", name)).Set(stats.Written)
+		metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_sink_entries_total{sink=%q,result=\"failed\"}", name)).Set(stats.Failed)
+		metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_sink_entries_total{sink=%q,result=\"dropped\"}", name)).Set(stats.Dropped)
+		metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_sink_entries_total{sink=%q,result=\"filtered\"}", name)).Set(stats.Filtered)
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_sink_queue_depth{sink=%q}", name), nil).Set(float64(stats.QueueDepth))
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_sink_queue_capacity{sink=%q}", name), nil).Set(float64(stats.QueueCapacity))
+	}
+}
+
+// SetWatcher sets the CT watcher whose worker lag is exported as metrics.
+func SetWatcher(w *certificatetransparency.Watcher) {
+	watcher = w
+}
+
+// getOperatorInFlightMetrics sets the number of in-flight requests of each operator with a concurrency limit.
+func getOperatorInFlightMetrics() {
+	for operator, inFlight := range certificatetransparency.GetOperatorInFlight() {
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_operator_in_flight_requests{operator=%q}", operator), nil).Set(float64(inFlight))
+	}
+}
+
+// getWorkerLagMetrics sets the lag of each worker, whether the lag exceeds the configured thresholds and the sizes
+// of its get-entries batches, as well as the number of logs waiting for the goroutine budget and whether the ccadb data is stale.
+func getWorkerLagMetrics() {
+	if watcher == nil {
+		return
+	}
+
+	status := watcher.Status()
+	metrics.GetOrCreateGauge("certstreamservergo_queued_logs", nil).Set(float64(len(status.QueuedLogs)))
+
+	ccadbStale := 0.0
+	if status.CCADBStale {
+		ccadbStale = 1
+	}
+	metrics.GetOrCreateGauge("certstreamservergo_ccadb_stale", nil).Set(ccadbStale)
+
+	for _, workerStatus := range status.Workers {
+		lagging := 0.0
+		if workerStatus.Lagging {
+			lagging = 1
+		}
+
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_worker_lag{url=%q}", workerStatus.URL), nil).Set(float64(workerStatus.Lag))
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_worker_lagging{url=%q}", workerStatus.URL), nil).Set(lagging)
+
+		// Batch sizes of the get-entries requests, to tune the batch size per log
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_get_entries_requests_total{url=%q}", workerStatus.URL), nil).Set(float64(workerStatus.Batches))
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_get_entries_requested_total{url=%q}", workerStatus.URL), nil).Set(float64(workerStatus.RequestedEntries))
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_get_entries_returned_total{url=%q}", workerStatus.URL), nil).Set(float64(workerStatus.ReturnedEntries))
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_get_entries_truncated_total{url=%q}", workerStatus.URL), nil).Set(float64(workerStatus.TruncatedBatches))
+		metrics.GetOrCreateGauge(fmt.Sprintf("certstreamservergo_get_entries_avg_batch_size{url=%q}", workerStatus.URL), nil).Set(workerStatus.AvgBatchSize)
+	}
+}
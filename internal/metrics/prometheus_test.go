@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certificatetransparency"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// TestRegisterCtLogMetricsLateLog checks that a log counted before it was initialized and after the first scrape is
+// exported by the following scrapes.
+func TestRegisterCtLogMetricsLateLog(t *testing.T) {
+	const operator, url = "Test Operator", "ct.example.com/late2026h1/"
+	wantLine := `certstreamservergo_certs_by_log_total{url="` + url + `",operator="` + operator + `"}`
+
+	var logMetrics certificatetransparency.LogMetrics
+	logMetrics.Init("Test Operator", "ct.example.com/early2026h1/")
+
+	scrape := func() string {
+		registerCtLogMetrics(logMetrics.OperatorLogMapping())
+
+		var buf bytes.Buffer
+		metrics.WritePrometheus(&buf, false)
+
+		return buf.String()
+	}
+
+	if output := scrape(); strings.Contains(output, wantLine) {
+		t.Fatalf("log is exported before it was counted:\n%s", output)
+	}
+
+	logMetrics.Inc(operator, url)
+	logMetrics.Init(operator, url)
+
+	if got := logMetrics.Get(operator, url); got != 1 {
+		t.Errorf("Get() = %d after Inc and Init, want 1", got)
+	}
+
+	if output := scrape(); !strings.Contains(output, wantLine) {
+		t.Errorf("log counted before Init is missing from the scrape:\n%s", output)
+	}
+}
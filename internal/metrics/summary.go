@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certificatetransparency"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/web"
+)
+
+// WriteSummary writes a human-readable summary of the most important metrics and the watcher status to w.
+// It only reads counters and copies of the internal state, so it's cheap to call.
+func WriteSummary(w io.Writer, status certificatetransparency.WatcherStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "certstream-server-go summary (%s)\n\n", time.Now().UTC().Format(time.RFC3339))
+
+	fmt.Fprintln(tw, "Processing")
+	fmt.Fprintf(tw, "  Certificates:\t%d\n", certificatetransparency.GetProcessedCerts())
+	fmt.Fprintf(tw, "  Precertificates:\t%d\n", certificatetransparency.GetProcessedPrecerts())
+	fmt.Fprintf(tw, "  Queue depth:\t%d / %d\n", certificatetransparency.GetQueueLength(), certificatetransparency.GetQueueCapacity())
+	fmt.Fprintf(tw, "  Duplicate indices:\t%d\n", certificatetransparency.GetDuplicateIndices())
+	fmt.Fprintf(tw, "  Skipped while catching up:\t%d\n", certificatetransparency.GetStaleSkipped())
+	fmt.Fprintf(tw, "  Deduplicated by fingerprint:\t%d (%d in window)\n", certificatetransparency.GetDedupHits(), certificatetransparency.GetDedupEntries())
+	fmt.Fprintf(tw, "  Collapsed by reg-domain:\t%d\n", certificatetransparency.GetCollapsedEntries())
+	fmt.Fprintf(tw, "  Rolled up by reg-domain:\t%d\n", certificatetransparency.GetRolledUpEntries())
+	fmt.Fprintf(tw, "  Suppressed by issuer heartbeat:\t%d\n", certificatetransparency.GetHeartbeatSuppressed())
+	fmt.Fprintf(tw, "  Not yet valid:\t%d\n", certificatetransparency.GetNotYetValidCerts())
+	fmt.Fprintf(tw, "  Revoked serials:\t%d (%d in revocation set)\n", certificatetransparency.GetRevokedSerialCerts(),
+		certificatetransparency.GetRevocationSetSize())
+	fmt.Fprintf(tw, "  Dropped by entry hook:\t%d (%d errors, %d timeouts)\n", certificatetransparency.GetHookDropped(),
+		certificatetransparency.GetHookErrors(), certificatetransparency.GetHookTimeouts())
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "Clients")
+	fmt.Fprintf(tw, "  Full:\t%d\n", web.ClientHandler.ClientFullCount())
+	fmt.Fprintf(tw, "  Lite:\t%d\n", web.ClientHandler.ClientLiteCount())
+	fmt.Fprintf(tw, "  Domains only:\t%d\n", web.ClientHandler.ClientDomainsCount())
+	fmt.Fprintln(tw)
+
+	catchingUp := 0
+	for _, workerStatus := range status.Workers {
+		if workerStatus.CatchingUp {
+			catchingUp++
+		}
+	}
+
+	fmt.Fprintln(tw, "Workers")
+	fmt.Fprintf(tw, "  Active:\t%d\n", len(status.Workers))
+	fmt.Fprintf(tw, "  Catching up:\t%d\n", catchingUp)
+	if len(status.QueuedLogs) > 0 {
+		fmt.Fprintf(tw, "  Queued (goroutine budget):\t%d\n", len(status.QueuedLogs))
+	}
+	if status.GoroutinesMax > 0 {
+		fmt.Fprintf(tw, "  Goroutine budget:\t%d / %d\n", status.GoroutinesUsed, status.GoroutinesMax)
+	}
+	fmt.Fprintf(tw, "  Loglist refreshed:\t%s\n", formatRefreshTime(status.LogListRefreshed))
+	fmt.Fprintf(tw, "  CCADB refreshed:\t%s\n", formatRefreshTime(status.CCADBRefreshed))
+	if status.CCADBFallback {
+		fmt.Fprintln(tw, "  CCADB:\tlast refresh failed, using previously loaded data")
+	}
+	if status.CCADBStale {
+		fmt.Fprintln(tw, "  CCADB:\tdata is older than the configured max staleness")
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "Certificates by operator")
+
+	certMetrics := certificatetransparency.GetCertMetrics()
+	operators := make([]string, 0, len(certMetrics))
+	for operator := range certMetrics {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	for _, operator := range operators {
+		var total int64
+		for _, count := range certMetrics[operator] {
+			total += count
+		}
+
+		fmt.Fprintf(tw, "  %s:\t%d\t(%d logs)\n", operator, total, len(certMetrics[operator]))
+	}
+
+	_ = tw.Flush()
+}
+
+// formatRefreshTime formats the given refresh time including how long ago it was.
+func formatRefreshTime(refreshed *time.Time) string {
+	if refreshed == nil {
+		return "never"
+	}
+
+	return fmt.Sprintf("%s (%s ago)", refreshed.UTC().Format(time.RFC3339), time.Since(*refreshed).Round(time.Second))
+}
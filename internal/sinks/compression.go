@@ -0,0 +1,55 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of the file, stdout and s3 sinks.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// parseCompression validates the configured compression. An empty value disables compression.
+func parseCompression(compression string) (string, error) {
+	switch compression = strings.ToLower(compression); compression {
+	case "":
+		return CompressionNone, nil
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return compression, nil
+	default:
+		return "", fmt.Errorf("unknown compression '%s', use '%s', '%s' or '%s'", compression, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+// newCompressor returns a streaming encoder writing to w. Closing it completes the gzip member or zstd frame, but
+// doesn't close w. Returns nil for CompressionNone.
+func newCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		// A single encoder goroutine keeps the memory usage bounded to one window
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, nil
+	}
+}
+
+// compressionExtension returns the file extension of the given compression, e.g. ".zst".
+func compressionExtension(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,122 @@
+package sinks
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+// writerSink writes entries as newline delimited JSON to an io.Writer, optionally compressed.
+type writerSink struct {
+	name      string
+	lite      bool
+	canonical bool
+	mu        sync.Mutex
+	writer    *bufio.Writer
+	// compressor is the gzip or zstd encoder between writer and the underlying io.Writer or nil without compression.
+	compressor io.WriteCloser
+	closer     io.Closer
+}
+
+// newFileSink creates a sink that appends entries to the file at the configured path. With compression, each run
+// appends a new gzip member or zstd frame, so the file stays readable as a whole.
+func newFileSink(sinkConfig config.SinkConfig) (*writerSink, error) {
+	if sinkConfig.Path == "" {
+		return nil, errors.New("no path configured")
+	}
+
+	file, err := os.OpenFile(sinkConfig.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newWriterSink(sinkConfig, file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	sink.closer = file
+
+	return sink, nil
+}
+
+// newStdoutSink creates a sink that writes entries to stdout.
+func newStdoutSink(sinkConfig config.SinkConfig) (*writerSink, error) {
+	return newWriterSink(sinkConfig, os.Stdout)
+}
+
+// newWriterSink creates a sink that writes entries to w with the configured compression.
+func newWriterSink(sinkConfig config.SinkConfig, w io.Writer) (*writerSink, error) {
+	compression, err := parseCompression(sinkConfig.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &writerSink{
+		name:      sinkName(sinkConfig),
+		lite:      sinkConfig.Lite,
+		canonical: sinkConfig.Canonical,
+	}
+
+	if sink.compressor, err = newCompressor(w, compression); err != nil {
+		return nil, err
+	}
+
+	if sink.compressor != nil {
+		w = sink.compressor
+	}
+
+	sink.writer = bufio.NewWriter(w)
+
+	return sink, nil
+}
+
+// sinkName returns the configured name of the sink or its type if no name is configured.
+func sinkName(sinkConfig config.SinkConfig) string {
+	if sinkConfig.Name != "" {
+		return sinkConfig.Name
+	}
+
+	return sinkConfig.Type
+}
+
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+// Write writes the JSON encoded entry as a single line. Writes are buffered and flushed once the buffer is full
+// or the sink is closed.
+func (s *writerSink) Write(entry *certstream.Entry) error {
+	data := entryJSON(entry, s.lite, s.canonical)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.writer.Write(data)
+
+	return err
+}
+
+func (s *writerSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := []error{s.writer.Flush()}
+
+	// Complete the gzip member or zstd frame before closing the file
+	if s.compressor != nil {
+		errs = append(errs, s.compressor.Close())
+	}
+
+	if s.closer != nil {
+		errs = append(errs, s.closer.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,43 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// pubsubScope is the OAuth2 scope required to publish to Pub/Sub.
+const pubsubScope = "https://www.googleapis.com/auth/pubsub"
+
+// newGCPTokenSource creates a token source for the Pub/Sub scope from the given credentials file (service account
+// key or authorized user). If the path is empty, the application default credentials are used: the file in
+// GOOGLE_APPLICATION_CREDENTIALS, the gcloud credentials or else the metadata server of GCE, GKE or Cloud Run.
+// Tokens are requested with the given client and cached until shortly before they expire.
+func newGCPTokenSource(credentialsFile string, httpClient *http.Client) (oauth2.TokenSource, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+
+	if credentialsFile == "" {
+		credentials, err := google.FindDefaultCredentials(ctx, pubsubScope)
+		if err != nil {
+			return nil, fmt.Errorf("could not find application default credentials: %w", err)
+		}
+
+		return credentials.TokenSource, nil
+	}
+
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := google.CredentialsFromJSON(ctx, data, pubsubScope)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse credentials file: %w", err)
+	}
+
+	return credentials.TokenSource, nil
+}
@@ -0,0 +1,59 @@
+package sinks
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+// hashChainGenesis is the message type of the first record written to a sink with a hash chain.
+const hashChainGenesis = "hash_chain_genesis"
+
+// hashChain links the entries written to a sink: the hash of each entry is the SHA-256 of the hash of the previous
+// entry (hex encoded) followed by the canonical JSON of the entry without prev_hash and hash. Each start of the sink
+// begins a new chain with a random genesis record, so consumers can verify that a stored sequence is complete and
+// unmodified. It is only used by the single worker of a sink and therefore not safe for concurrent use.
+type hashChain struct {
+	lite     bool
+	prevHash string
+}
+
+// newHashChain creates a hash chain and returns the genesis record, which must be written to the sink first.
+func newHashChain(sinkName string, lite bool) (*hashChain, certstream.Entry) {
+	seed := make([]byte, 16)
+	_, _ = rand.Read(seed)
+
+	now := time.Now()
+	digest := sha256.Sum256([]byte(sinkName + "\n" + now.UTC().Format(time.RFC3339Nano) + "\n" + hex.EncodeToString(seed)))
+
+	genesis := certstream.Entry{
+		MessageType: hashChainGenesis,
+		Hash:        hex.EncodeToString(digest[:]),
+	}
+	genesis.Data.Seen = float64(now.UnixMilli()) / 1_000
+
+	return &hashChain{lite: lite, prevHash: genesis.Hash}, genesis
+}
+
+// link sets prev_hash and hash of the entry. The chain only advances once the entry was written, see advance.
+func (c *hashChain) link(entry *certstream.Entry) {
+	entry.PrevHash = ""
+	entry.Hash = ""
+
+	content := certstream.CanonicalJSON(entryJSON(entry, c.lite, false))
+
+	hash := sha256.New()
+	hash.Write([]byte(c.prevHash))
+	hash.Write(content)
+
+	entry.PrevHash = c.prevHash
+	entry.Hash = hex.EncodeToString(hash.Sum(nil))
+}
+
+// advance makes the hash of the written entry the previous hash of the next entry.
+func (c *hashChain) advance(entry *certstream.Entry) {
+	c.prevHash = entry.Hash
+}
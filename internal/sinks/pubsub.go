@@ -0,0 +1,275 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	"github.com/VictoriaMetrics/metrics"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// pubsubPublishAttempts is the number of attempts to publish a batch before it is discarded.
+	pubsubPublishAttempts = 3
+	// pubsubMaxBatchMessages and pubsubMaxBatchBytes are the limits of a single publish request.
+	pubsubMaxBatchMessages = 1000
+	pubsubMaxBatchBytes    = 9 * 1024 * 1024
+	pubsubDefaultEndpoint  = "https://pubsub.googleapis.com"
+)
+
+// Ordering keys of the published messages.
+const (
+	pubsubOrderingNone     = "none"
+	pubsubOrderingLog      = "log"
+	pubsubOrderingOperator = "operator"
+)
+
+// pubsubMessage is a single message of a publish request. Data is base64 encoded by the json encoder.
+type pubsubMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// pubsubSink publishes entries as JSON messages to a Google Cloud Pub/Sub topic via the REST API.
+// Messages are published in batches, which are sent when they reach the configured size or age.
+type pubsubSink struct {
+	name        string
+	lite        bool
+	canonical   bool
+	publishURL  string
+	ordering    string
+	maxMessages int
+	maxDelay    time.Duration
+	httpClient  *http.Client
+	tokens      oauth2.TokenSource
+
+	mu         sync.Mutex
+	batch      []pubsubMessage
+	batchBytes int
+
+	published *metrics.Counter
+	failed    *metrics.Counter
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newPubSubSink creates a sink that publishes entries to the configured topic.
+func newPubSubSink(sinkConfig config.SinkConfig) (*pubsubSink, error) {
+	pubsubConfig := sinkConfig.PubSub
+	if pubsubConfig.Project == "" || pubsubConfig.Topic == "" {
+		return nil, errors.New("project and topic must be configured")
+	}
+
+	ordering := strings.ToLower(pubsubConfig.OrderingKey)
+	switch ordering {
+	case "":
+		ordering = pubsubOrderingNone
+	case pubsubOrderingNone, pubsubOrderingLog, pubsubOrderingOperator:
+	default:
+		return nil, fmt.Errorf("unknown ordering_key '%s', use '%s', '%s' or '%s'", pubsubConfig.OrderingKey, pubsubOrderingNone, pubsubOrderingLog, pubsubOrderingOperator)
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
+	tokens, err := newGCPTokenSource(pubsubConfig.CredentialsFile, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimRight(pubsubConfig.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = pubsubDefaultEndpoint
+	}
+
+	name := sinkName(sinkConfig)
+	sink := &pubsubSink{
+		name:        name,
+		lite:        sinkConfig.Lite,
+		canonical:   sinkConfig.Canonical,
+		publishURL:  fmt.Sprintf("%s/v1/projects/%s/topics/%s:publish", endpoint, pubsubConfig.Project, pubsubConfig.Topic),
+		ordering:    ordering,
+		maxMessages: pubsubConfig.MaxBatchMessages,
+		maxDelay:    pubsubConfig.MaxBatchDelay,
+		httpClient:  httpClient,
+		tokens:      tokens,
+		published:   metrics.GetOrCreateCounter(fmt.Sprintf(`certstreamservergo_pubsub_messages_total{sink=%q,result="published"}`, name)),
+		failed:      metrics.GetOrCreateCounter(fmt.Sprintf(`certstreamservergo_pubsub_messages_total{sink=%q,result="failed"}`, name)),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	if sink.maxMessages <= 0 || sink.maxMessages > pubsubMaxBatchMessages {
+		sink.maxMessages = 100
+	}
+
+	if sink.maxDelay <= 0 {
+		sink.maxDelay = time.Second
+	}
+
+	go sink.publishPeriodically()
+
+	return sink, nil
+}
+
+func (s *pubsubSink) Name() string {
+	return s.name
+}
+
+// Write adds the entry to the current batch and publishes the batch once it reaches the maximum size.
+func (s *pubsubSink) Write(entry *certstream.Entry) error {
+	data := entryJSON(entry, s.lite, s.canonical)
+
+	message := pubsubMessage{
+		Data: bytes.TrimSpace(data),
+		Attributes: map[string]string{
+			"message_type": entry.MessageType,
+			"operator":     entry.Data.Source.Operator,
+			"log_url":      entry.Data.Source.NormalizedURL,
+		},
+	}
+
+	switch s.ordering {
+	case pubsubOrderingLog:
+		message.OrderingKey = entry.Data.Source.NormalizedURL
+	case pubsubOrderingOperator:
+		message.OrderingKey = entry.Data.Source.Operator
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep the request below the size limit of the API
+	if s.batchBytes+len(message.Data) > pubsubMaxBatchBytes {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+
+	s.batch = append(s.batch, message)
+	s.batchBytes += len(message.Data)
+
+	if len(s.batch) >= s.maxMessages {
+		return s.flush()
+	}
+
+	return nil
+}
+
+// publishPeriodically publishes the current batch every maxDelay until the sink is closed.
+func (s *pubsubSink) publishPeriodically() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.maxDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if err := s.flush(); err != nil {
+				log.Printf("Error while publishing batch of sink '%s': %s\n", s.name, err)
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// flush publishes the current batch and starts a new one. The caller must hold the mutex.
+// Failed requests are retried with an increasing delay. If all attempts fail, the batch is discarded.
+func (s *pubsubSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	batch := s.batch
+	s.batch = nil
+	s.batchBytes = 0
+
+	var err error
+	for attempt := 1; attempt <= pubsubPublishAttempts; attempt++ {
+		var retryable bool
+		if retryable, err = s.publish(batch); err == nil {
+			s.published.Add(len(batch))
+			return nil
+		}
+
+		if !retryable {
+			break
+		}
+
+		if attempt < pubsubPublishAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+
+	s.failed.Add(len(batch))
+
+	return fmt.Errorf("failed to publish batch, discarding %d entries: %w", len(batch), err)
+}
+
+// publish sends a single publish request. It returns whether a failed request may be retried.
+func (s *pubsubSink) publish(batch []pubsubMessage) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	token, err := s.tokens.Token()
+	if err != nil {
+		return true, fmt.Errorf("could not request access token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string][]pubsubMessage{"messages": batch})
+	if err != nil {
+		return false, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.publishURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(request)
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return false, nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	retryable := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError
+
+	return retryable, fmt.Errorf("publish failed: %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
+
+// Close publishes the current batch and stops the periodic publishing.
+func (s *pubsubSink) Close() error {
+	close(s.stop)
+	<-s.stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flush()
+}
@@ -0,0 +1,127 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Formats of the entries in the redis stream.
+const (
+	redisFormatJSON   = "json"
+	redisFormatFields = "fields"
+)
+
+// redisTimeout is the maximum duration of a single XADD including reconnects of the client.
+const redisTimeout = 5 * time.Second
+
+// redisSink appends entries to a redis stream via XADD.
+// Connection failures are handled by the client, which reconnects transparently on the next command.
+type redisSink struct {
+	name      string
+	lite      bool
+	canonical bool
+	format    string
+	stream    string
+	maxLen    int64
+	approx    bool
+	client    *redis.Client
+}
+
+// newRedisSink creates a sink that appends entries to the configured redis stream.
+func newRedisSink(sinkConfig config.SinkConfig) (*redisSink, error) {
+	redisConfig := sinkConfig.Redis
+	if redisConfig.Address == "" || redisConfig.Stream == "" {
+		return nil, errors.New("address and stream must be configured")
+	}
+
+	format := strings.ToLower(redisConfig.Format)
+	switch format {
+	case "":
+		format = redisFormatJSON
+	case redisFormatJSON, redisFormatFields:
+	default:
+		return nil, fmt.Errorf("unknown format '%s', use '%s' or '%s'", redisConfig.Format, redisFormatJSON, redisFormatFields)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisConfig.Address,
+		Username: redisConfig.Username,
+		Password: redisConfig.Password,
+		DB:       redisConfig.DB,
+	})
+
+	return &redisSink{
+		name:      sinkName(sinkConfig),
+		lite:      sinkConfig.Lite,
+		canonical: sinkConfig.Canonical,
+		format:    format,
+		stream:    redisConfig.Stream,
+		maxLen:    redisConfig.MaxLen,
+		approx:    !redisConfig.ExactTrim,
+		client:    client,
+	}, nil
+}
+
+func (s *redisSink) Name() string {
+	return s.name
+}
+
+// Write appends the entry to the stream. The stream is trimmed to the configured maximum length.
+func (s *redisSink) Write(entry *certstream.Entry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	args := &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.approx && s.maxLen > 0,
+		Values: s.values(entry),
+	}
+
+	return s.client.XAdd(ctx, args).Err()
+}
+
+// values returns the fields of the stream message for the entry. In the json format, the whole entry is stored in
+// the "entry" field. The fields format contains the most commonly used fields of the entry flattened.
+func (s *redisSink) values(entry *certstream.Entry) []any {
+	if s.format == redisFormatJSON {
+		data := entryJSON(entry, s.lite, s.canonical)
+
+		return []any{"entry", bytes.TrimSpace(data)}
+	}
+
+	data := entry.Data
+	leafCert := data.LeafCert
+
+	return []any{
+		"message_type", entry.MessageType,
+		"update_type", data.UpdateType,
+		"cert_index", data.CertIndex,
+		"cert_link", data.CertLink,
+		"seen", data.Seen,
+		"source_name", data.Source.Name,
+		"source_url", data.Source.URL,
+		"operator", data.Source.Operator,
+		"fingerprint", leafCert.Fingerprint,
+		"sha256", leafCert.SHA256,
+		"serial_number", leafCert.SerialNumber,
+		"not_before", leafCert.NotBefore,
+		"not_after", leafCert.NotAfter,
+		"ca_owner", leafCert.CAOwner,
+		"all_domains", strings.Join(leafCert.AllDomains, ","),
+	}
+}
+
+// Close closes the connections to redis. Queued entries were already written by the fanout at this point.
+func (s *redisSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,276 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// s3UploadAttempts is the number of attempts to upload a batch before it is discarded.
+	s3UploadAttempts = 3
+	// s3PartSize is the size of the parts for multipart uploads of large batches.
+	s3PartSize = 16 * 1024 * 1024
+)
+
+// s3Sink batches entries into NDJSON objects and uploads them to an S3 compatible object store.
+// Batches are rotated when they reach the configured size or age.
+type s3Sink struct {
+	name           string
+	lite           bool
+	canonical      bool
+	client         *minio.Client
+	bucket         string
+	prefix         string
+	compression    string
+	maxBatchSize   int
+	rotateInterval time.Duration
+
+	mu          sync.Mutex
+	buffer      bytes.Buffer
+	compressor  io.WriteCloser
+	entries     int
+	batchStart  time.Time
+	objectCount int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newS3Sink creates a sink that uploads batches of entries to the configured bucket.
+func newS3Sink(sinkConfig config.SinkConfig) (*s3Sink, error) {
+	s3Config := sinkConfig.S3
+	if s3Config.Endpoint == "" || s3Config.Bucket == "" {
+		return nil, errors.New("endpoint and bucket must be configured")
+	}
+
+	compression, err := parseCompression(sinkConfig.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if sinkConfig.Compression == "" && s3Config.Gzip {
+		compression = CompressionGzip
+	}
+
+	client, err := minio.New(s3Config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(s3Config.AccessKey, s3Config.SecretKey, ""),
+		Secure: !s3Config.Insecure,
+		Region: s3Config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &s3Sink{
+		name:           sinkName(sinkConfig),
+		lite:           sinkConfig.Lite,
+		canonical:      sinkConfig.Canonical,
+		client:         client,
+		bucket:         s3Config.Bucket,
+		prefix:         s3Config.Prefix,
+		compression:    compression,
+		maxBatchSize:   s3Config.MaxBatchSize,
+		rotateInterval: s3Config.RotateInterval,
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+
+	if sink.maxBatchSize <= 0 {
+		sink.maxBatchSize = 64 * 1024 * 1024
+	}
+
+	if sink.rotateInterval <= 0 {
+		sink.rotateInterval = 5 * time.Minute
+	}
+
+	go sink.rotate()
+
+	return sink, nil
+}
+
+func (s *s3Sink) Name() string {
+	return s.name
+}
+
+// Write adds the entry to the current batch and uploads the batch once it reaches the maximum size. The upload
+// happens without holding the mutex, so other writers are not blocked by it.
+func (s *s3Sink) Write(entry *certstream.Entry) error {
+	data := entryJSON(entry, s.lite, s.canonical)
+
+	s.mu.Lock()
+	batch, err := s.add(data)
+	s.mu.Unlock()
+
+	if err != nil || batch == nil {
+		return err
+	}
+
+	return s.upload(batch)
+}
+
+// add writes the data to the current batch and returns the completed batch once it reached the maximum size.
+// The caller must hold the mutex.
+func (s *s3Sink) add(data []byte) (*s3Batch, error) {
+	if s.entries == 0 {
+		s.batchStart = time.Now()
+
+		var err error
+		if s.compressor, err = newCompressor(&s.buffer, s.compression); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if s.compressor != nil {
+		_, err = s.compressor.Write(data)
+	} else {
+		_, err = s.buffer.Write(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.entries++
+
+	if s.buffer.Len() < s.maxBatchSize {
+		return nil, nil
+	}
+
+	return s.takeBatch()
+}
+
+// rotate uploads the current batch every rotateInterval until the sink is closed.
+func (s *s3Sink) rotate() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.rotateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.Printf("Error while uploading batch of sink '%s': %s\n", s.name, err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// s3Batch is a completed batch that is ready to be uploaded.
+type s3Batch struct {
+	key     string
+	data    []byte
+	entries int
+}
+
+// flush uploads the current batch and starts a new one.
+func (s *s3Sink) flush() error {
+	s.mu.Lock()
+	batch, err := s.takeBatch()
+	s.mu.Unlock()
+
+	if err != nil || batch == nil {
+		return err
+	}
+
+	return s.upload(batch)
+}
+
+// takeBatch completes the current batch and starts a new one. It returns nil if the batch is empty. The caller must
+// hold the mutex. The new batch is started even if the current one could not be completed, which discards it.
+func (s *s3Sink) takeBatch() (*s3Batch, error) {
+	if s.entries == 0 {
+		return nil, nil
+	}
+
+	entries := s.entries
+
+	// Complete the gzip member or zstd frame of the batch
+	var err error
+	if s.compressor != nil {
+		err = s.compressor.Close()
+		s.compressor = nil
+	}
+
+	// The data is handed to the upload, so the next batch is written to a new buffer
+	data := s.buffer.Bytes()
+	s.buffer = bytes.Buffer{}
+	s.entries = 0
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete batch, discarding %d entries: %w", entries, err)
+	}
+
+	return &s3Batch{key: s.objectKey(), data: data, entries: entries}, nil
+}
+
+// upload uploads the batch. Failed uploads are retried with an increasing delay. If all attempts fail, the batch is
+// discarded.
+func (s *s3Sink) upload(batch *s3Batch) error {
+	var err error
+	for attempt := 1; attempt <= s3UploadAttempts; attempt++ {
+		err = s.putObject(batch.key, batch.data)
+		if err == nil {
+			log.Printf("Sink '%s' uploaded %d entries to '%s'\n", s.name, batch.entries, batch.key)
+			return nil
+		}
+
+		if attempt < s3UploadAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+
+	return fmt.Errorf("failed to upload '%s' after %d attempts, discarding %d entries: %w", batch.key, s3UploadAttempts, batch.entries, err)
+}
+
+// putObject puts a single object into the bucket. Objects larger than the part size are uploaded via multipart upload.
+func (s *s3Sink) putObject(key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	contentType := "application/x-ndjson"
+	options := minio.PutObjectOptions{ContentType: contentType, PartSize: s3PartSize}
+	if s.compression != CompressionNone {
+		options.ContentEncoding = s.compression
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), options)
+
+	return err
+}
+
+// objectKey returns the key for the current batch, e.g. "certstream/2024/08/01/13/20240801T130501Z-0001.ndjson.gz".
+func (s *s3Sink) objectKey() string {
+	s.objectCount++
+
+	start := s.batchStart.UTC()
+	name := fmt.Sprintf("%s-%04d.ndjson", start.Format("20060102T150405Z"), s.objectCount)
+
+	name += compressionExtension(s.compression)
+
+	return path.Join(s.prefix, start.Format("2006/01/02/15"), name)
+}
+
+// Close uploads the current batch and stops the rotation.
+func (s *s3Sink) Close() error {
+	close(s.stop)
+	<-s.stopped
+
+	return s.flush()
+}
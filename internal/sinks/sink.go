@@ -0,0 +1,376 @@
+// Package sinks provides destinations besides the websocket clients, to which all emitted entries are written.
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/budget"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+)
+
+const (
+	// defaultQueueSize is the number of entries buffered per sink if no queue size is configured.
+	defaultQueueSize = 1000
+	// defaultBlockTimeout is the time to wait for space in a full queue with the block overflow policy.
+	defaultBlockTimeout = 100 * time.Millisecond
+)
+
+// Sink is a destination that entries are written to.
+type Sink interface {
+	// Name returns the name of the sink used in logs and metrics.
+	Name() string
+	// Write writes a single entry to the sink.
+	Write(entry *certstream.Entry) error
+	// Close flushes pending data and releases all resources of the sink.
+	Close() error
+}
+
+// Entry types a sink can be restricted to.
+const (
+	EntryTypesAll     = "all"
+	EntryTypesPrecert = "precert"
+	EntryTypesFinal   = "final"
+)
+
+// Overflow policies for entries that don't fit into the queue of a sink.
+const (
+	OverflowDrop  = "drop"
+	OverflowBlock = "block"
+)
+
+// queuedSink wraps a Sink with its entry type filter and a queue, so that slow sinks don't block the certHandler.
+// The queue is drained by one or more goroutines, so that errors and panics of the sink only affect the sink itself.
+type queuedSink struct {
+	sink       Sink
+	entryTypes string
+	// watchedOnly restricts the sink to entries that match a watched key identifier.
+	watchedOnly bool
+	queue       chan certstream.Entry
+	// overflow is the policy for entries while the queue is full, blockTimeout the time to wait with OverflowBlock.
+	overflow     string
+	blockTimeout time.Duration
+	dropped      atomic.Uint64
+	written      atomic.Uint64
+	failed       atomic.Uint64
+	// filtered counts the entries not queued because they didn't match the filters of the sink.
+	filtered atomic.Uint64
+	done     sync.WaitGroup
+	// goroutines is the number of goroutines acquired from the goroutine budget for this sink.
+	goroutines int
+	// chain links the written entries if hash_chain is enabled, genesis is its first record.
+	chain   *hashChain
+	genesis certstream.Entry
+}
+
+// wants checks if the entry type and watched key identifier filter of the sink match the given entry.
+func (s *queuedSink) wants(entry *certstream.Entry) bool {
+	if s.watchedOnly && len(entry.Data.LeafCert.WatchedKeyIDs) == 0 {
+		return false
+	}
+
+	switch s.entryTypes {
+	case EntryTypesPrecert:
+		return entry.Data.UpdateType == "PrecertLogEntry"
+	case EntryTypesFinal:
+		return entry.Data.UpdateType == "X509LogEntry"
+	default:
+		return true
+	}
+}
+
+// run writes the queued entries to the sink until the queue is closed.
+func (s *queuedSink) run() {
+	defer s.done.Done()
+
+	if s.chain != nil {
+		if err := s.write(&s.genesis); err != nil {
+			log.Printf("Error while writing the hash chain genesis to sink '%s': %s\n", s.sink.Name(), err)
+		}
+	}
+
+	for entry := range s.queue {
+		if s.chain != nil {
+			s.chain.link(&entry)
+		}
+
+		if err := s.write(&entry); err != nil {
+			if s.failed.Add(1)%1000 == 1 {
+				log.Printf("Error while writing to sink '%s': %s\n", s.sink.Name(), err)
+			}
+
+			continue
+		}
+
+		if s.chain != nil {
+			s.chain.advance(&entry)
+		}
+
+		s.written.Add(1)
+	}
+}
+
+// write writes a single entry to the sink. A panic of the sink is returned as error instead of crashing the server.
+func (s *queuedSink) write(entry *certstream.Entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sink panicked: %v", r)
+		}
+	}()
+
+	return s.sink.Write(entry)
+}
+
+// enqueue adds the entry to the queue according to the overflow policy. Returns false if the entry was dropped.
+func (s *queuedSink) enqueue(entry certstream.Entry) bool {
+	select {
+	case s.queue <- entry:
+		return true
+	default:
+	}
+
+	if s.overflow != OverflowBlock {
+		return false
+	}
+
+	timer := time.NewTimer(s.blockTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.queue <- entry:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Fanout distributes entries to all configured sinks according to their entry type filters.
+type Fanout struct {
+	sinks     []*queuedSink
+	closeOnce sync.Once
+}
+
+// NewFanout creates the sinks from the given configs and starts writing to them in the background.
+// Creating the sinks fails if their goroutines exceed the goroutine budget.
+func NewFanout(sinkConfigs []config.SinkConfig) (*Fanout, error) {
+	fanout := &Fanout{}
+
+	for _, sinkConfig := range sinkConfigs {
+		goroutines := sinkGoroutines(sinkConfig)
+		if !budget.Goroutines.TryAcquire(goroutines) {
+			fanout.Close()
+			return nil, fmt.Errorf("could not create sink '%s': goroutine budget of %d exceeded", sinkConfig.Name, budget.Goroutines.Max())
+		}
+
+		sink, err := newSink(sinkConfig)
+		if err != nil {
+			budget.Goroutines.Release(goroutines)
+			fanout.Close()
+
+			return nil, fmt.Errorf("could not create sink '%s': %w", sinkConfig.Name, err)
+		}
+
+		entryTypes := strings.ToLower(sinkConfig.EntryTypes)
+		switch entryTypes {
+		case "", EntryTypesAll:
+			entryTypes = EntryTypesAll
+		case EntryTypesPrecert, EntryTypesFinal:
+		default:
+			_ = sink.Close()
+			budget.Goroutines.Release(goroutines)
+			fanout.Close()
+
+			return nil, fmt.Errorf("invalid entry_types '%s' for sink '%s'", sinkConfig.EntryTypes, sinkConfig.Name)
+		}
+
+		overflow := strings.ToLower(sinkConfig.Overflow)
+		switch overflow {
+		case "":
+			overflow = OverflowDrop
+		case OverflowDrop, OverflowBlock:
+		default:
+			_ = sink.Close()
+			budget.Goroutines.Release(goroutines)
+			fanout.Close()
+
+			return nil, fmt.Errorf("invalid overflow '%s' for sink '%s'", sinkConfig.Overflow, sinkConfig.Name)
+		}
+
+		workers := sinkWorkers(sinkConfig)
+		if sinkConfig.HashChain && workers > 1 {
+			_ = sink.Close()
+			budget.Goroutines.Release(goroutines)
+			fanout.Close()
+
+			return nil, fmt.Errorf("hash_chain of sink '%s' requires a single worker", sinkConfig.Name)
+		}
+
+		queueSize := sinkConfig.QueueSize
+		if queueSize <= 0 {
+			queueSize = defaultQueueSize
+		}
+
+		blockTimeout := sinkConfig.BlockTimeout
+		if blockTimeout <= 0 {
+			blockTimeout = defaultBlockTimeout
+		}
+
+		queued := &queuedSink{
+			sink:         sink,
+			entryTypes:   entryTypes,
+			watchedOnly:  sinkConfig.WatchedOnly,
+			queue:        make(chan certstream.Entry, queueSize),
+			overflow:     overflow,
+			blockTimeout: blockTimeout,
+			goroutines:   goroutines,
+		}
+
+		if sinkConfig.HashChain {
+			queued.chain, queued.genesis = newHashChain(sink.Name(), sinkConfig.Lite)
+			log.Printf("Sink '%s' starts a new hash chain with genesis %s\n", sink.Name(), queued.genesis.Hash)
+		}
+
+		queued.done.Add(workers)
+		for i := 0; i < workers; i++ {
+			go queued.run()
+		}
+
+		log.Printf("Writing %s entries to sink '%s' (%d workers, queue size %d, overflow %s)\n", entryTypes, sink.Name(), workers, queueSize, overflow)
+		fanout.sinks = append(fanout.sinks, queued)
+	}
+
+	return fanout, nil
+}
+
+// sinkGoroutines returns the number of goroutines a sink of the given config runs: its workers writing the queued
+// entries and - for the s3, pubsub and sqlite sinks - one sending the batches periodically.
+func sinkGoroutines(sinkConfig config.SinkConfig) int {
+	switch strings.ToLower(sinkConfig.Type) {
+	case "s3", "pubsub", "sqlite":
+		return sinkWorkers(sinkConfig) + 1
+	default:
+		return sinkWorkers(sinkConfig)
+	}
+}
+
+// sinkWorkers returns the number of goroutines writing the queued entries to the sink, at least one.
+func sinkWorkers(sinkConfig config.SinkConfig) int {
+	return max(sinkConfig.Workers, 1)
+}
+
+// entryJSON returns the JSON encoded entry terminated by a newline. Lite omits the chain and DER representation of
+// the certificate, canonical encodes the entry canonically (see certstream.CanonicalJSON).
+func entryJSON(entry *certstream.Entry, lite, canonical bool) []byte {
+	data := entry.JSONNoCache()
+	if lite {
+		data = entry.JSONLiteNoCache()
+	}
+
+	if canonical {
+		data = append(certstream.CanonicalJSON(data), '\n')
+	}
+
+	return data
+}
+
+// newSink creates a single sink from the given config.
+func newSink(sinkConfig config.SinkConfig) (Sink, error) {
+	switch strings.ToLower(sinkConfig.Type) {
+	case "file":
+		return newFileSink(sinkConfig)
+	case "stdout":
+		return newStdoutSink(sinkConfig)
+	case "s3":
+		return newS3Sink(sinkConfig)
+	case "redis":
+		return newRedisSink(sinkConfig)
+	case "pubsub":
+		return newPubSubSink(sinkConfig)
+	case "sqlite":
+		return newSQLiteSink(sinkConfig)
+	default:
+		return nil, fmt.Errorf("unknown sink type '%s'", sinkConfig.Type)
+	}
+}
+
+// Dispatch queues the entry for all sinks whose entry type filter matches. If the queue of a sink is full, the entry
+// is dropped for that sink - right away or, with OverflowBlock, once the block timeout of the sink passed.
+func (f *Fanout) Dispatch(entry certstream.Entry) {
+	if f == nil {
+		return
+	}
+
+	for _, s := range f.sinks {
+		if !s.wants(&entry) {
+			s.filtered.Add(1)
+			continue
+		}
+
+		if !s.enqueue(entry) {
+			if s.dropped.Add(1)%1000 == 1 {
+				log.Printf("Queue of sink '%s' is full, dropping entries. Dropped entries: %d\n", s.sink.Name(), s.dropped.Load())
+			}
+		}
+	}
+}
+
+// Close stops accepting new entries, writes all queued entries and closes all sinks.
+func (f *Fanout) Close() error {
+	if f == nil {
+		return nil
+	}
+
+	var errs []error
+
+	f.closeOnce.Do(func() {
+		for _, s := range f.sinks {
+			close(s.queue)
+			s.done.Wait()
+
+			if err := s.sink.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("could not close sink '%s': %w", s.sink.Name(), err))
+			}
+
+			budget.Goroutines.Release(s.goroutines)
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// SinkStats holds the counters and the current queue depth of a single sink.
+type SinkStats struct {
+	Written       uint64
+	Failed        uint64
+	Dropped       uint64
+	Filtered      uint64
+	QueueDepth    int
+	QueueCapacity int
+}
+
+// Stats returns the counters of all sinks by their name.
+func (f *Fanout) Stats() map[string]SinkStats {
+	stats := make(map[string]SinkStats)
+	if f == nil {
+		return stats
+	}
+
+	for _, s := range f.sinks {
+		stats[s.sink.Name()] = SinkStats{
+			Written:       s.written.Load(),
+			Failed:        s.failed.Load(),
+			Dropped:       s.dropped.Load(),
+			Filtered:      s.filtered.Load(),
+			QueueDepth:    len(s.queue),
+			QueueCapacity: cap(s.queue),
+		}
+	}
+
+	return stats
+}
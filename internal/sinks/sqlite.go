@@ -0,0 +1,291 @@
+package sinks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	// Pure Go SQLite driver, so the server can still be built without cgo
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the sqlite sink. The domains of each entry are stored in a separate table, so
+// that entries can be queried by domain via an index.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	id            INTEGER PRIMARY KEY,
+	entry_id      TEXT NOT NULL,
+	message_type  TEXT NOT NULL,
+	update_type   TEXT NOT NULL,
+	seen          REAL NOT NULL,
+	log_url       TEXT NOT NULL,
+	operator      TEXT NOT NULL,
+	cert_index    INTEGER NOT NULL,
+	fingerprint   TEXT NOT NULL,
+	sha256        TEXT NOT NULL,
+	serial_number TEXT NOT NULL,
+	subject       TEXT,
+	issuer        TEXT,
+	ca_owner      TEXT NOT NULL,
+	not_before    INTEGER NOT NULL,
+	not_after     INTEGER NOT NULL,
+	all_domains   TEXT NOT NULL,
+	entry         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS entries_seen ON entries (seen);
+CREATE INDEX IF NOT EXISTS entries_sha256 ON entries (sha256);
+CREATE TABLE IF NOT EXISTS domains (
+	entry  INTEGER NOT NULL,
+	domain TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS domains_domain ON domains (domain);
+CREATE INDEX IF NOT EXISTS domains_entry ON domains (entry);
+`
+
+const (
+	sqliteInsertEntry = `INSERT INTO entries (entry_id, message_type, update_type, seen, log_url, operator, cert_index,
+	fingerprint, sha256, serial_number, subject, issuer, ca_owner, not_before, not_after, all_domains, entry)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	sqliteInsertDomain = `INSERT INTO domains (entry, domain) VALUES (?, ?)`
+)
+
+// sqliteSink inserts entries into a local SQLite database. Entries are inserted in batched transactions, which are
+// committed when they reach the configured size or age. Entries older than the retention are pruned periodically.
+type sqliteSink struct {
+	name          string
+	lite          bool
+	canonical     bool
+	db            *sql.DB
+	maxEntries    int
+	maxDelay      time.Duration
+	retention     time.Duration
+	pruneInterval time.Duration
+
+	mu        sync.Mutex
+	batch     []*certstream.Entry
+	lastPrune time.Time
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newSQLiteSink opens (or creates) the database at the configured path and starts committing batches in the background.
+func newSQLiteSink(sinkConfig config.SinkConfig) (*sqliteSink, error) {
+	if sinkConfig.Path == "" {
+		return nil, errors.New("no path configured")
+	}
+
+	db, err := sql.Open("sqlite", sinkConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single connection keeps the pragmas for all statements and avoids lock contention between connections
+	db.SetMaxOpenConns(1)
+
+	// WAL allows reading the database (e.g. with the sqlite3 cli) while the server is writing to it
+	for _, statement := range []string{"PRAGMA journal_mode=WAL", "PRAGMA synchronous=NORMAL", "PRAGMA busy_timeout=5000", sqliteSchema} {
+		if _, err = db.Exec(statement); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("could not set up database: %w", err)
+		}
+	}
+
+	sqliteConfig := sinkConfig.SQLite
+	sink := &sqliteSink{
+		name:          sinkName(sinkConfig),
+		lite:          sinkConfig.Lite,
+		canonical:     sinkConfig.Canonical,
+		db:            db,
+		maxEntries:    sqliteConfig.MaxBatchEntries,
+		maxDelay:      sqliteConfig.MaxBatchDelay,
+		retention:     sqliteConfig.Retention,
+		pruneInterval: sqliteConfig.PruneInterval,
+		lastPrune:     time.Now(),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	if sink.maxEntries <= 0 {
+		sink.maxEntries = 1000
+	}
+
+	if sink.maxDelay <= 0 {
+		sink.maxDelay = time.Second
+	}
+
+	if sink.pruneInterval <= 0 {
+		sink.pruneInterval = 10 * time.Minute
+	}
+
+	go sink.commitPeriodically()
+
+	return sink, nil
+}
+
+func (s *sqliteSink) Name() string {
+	return s.name
+}
+
+// Write adds the entry to the current batch and commits the batch once it reaches the maximum size.
+func (s *sqliteSink) Write(entry *certstream.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batch = append(s.batch, entry)
+	if len(s.batch) >= s.maxEntries {
+		return s.flush()
+	}
+
+	return nil
+}
+
+// commitPeriodically commits the current batch every maxDelay and prunes old entries every pruneInterval until the
+// sink is closed.
+func (s *sqliteSink) commitPeriodically() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.maxDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if err := s.flush(); err != nil {
+				log.Printf("Error while committing batch of sink '%s': %s\n", s.name, err)
+			}
+
+			if s.retention > 0 && time.Since(s.lastPrune) >= s.pruneInterval {
+				s.lastPrune = time.Now()
+				if err := s.prune(); err != nil {
+					log.Printf("Error while pruning entries of sink '%s': %s\n", s.name, err)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// flush inserts the current batch in a single transaction and starts a new one. The caller must hold the mutex.
+// If the transaction fails, the batch is discarded.
+func (s *sqliteSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	batch := s.batch
+	s.batch = nil
+
+	if err := s.insert(batch); err != nil {
+		return fmt.Errorf("failed to insert batch, discarding %d entries: %w", len(batch), err)
+	}
+
+	return nil
+}
+
+// insert inserts the entries and their domains in a single transaction.
+func (s *sqliteSink) insert(batch []*certstream.Entry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	insertEntry, err := tx.PrepareContext(ctx, sqliteInsertEntry)
+	if err != nil {
+		return err
+	}
+	defer insertEntry.Close()
+
+	insertDomain, err := tx.PrepareContext(ctx, sqliteInsertDomain)
+	if err != nil {
+		return err
+	}
+	defer insertDomain.Close()
+
+	for _, entry := range batch {
+		data := entry.Data
+		leafCert := data.LeafCert
+
+		result, execErr := insertEntry.ExecContext(ctx,
+			data.EntryID, entry.MessageType, data.UpdateType, data.Seen, data.Source.NormalizedURL, data.Source.Operator,
+			data.CertIndex, leafCert.Fingerprint, leafCert.SHA256, leafCert.SerialNumber,
+			leafCert.Subject.Aggregated, leafCert.Issuer.Aggregated, leafCert.CAOwner, leafCert.NotBefore, leafCert.NotAfter,
+			strings.Join(leafCert.AllDomains, ","), strings.TrimSpace(string(entryJSON(entry, s.lite, s.canonical))))
+		if execErr != nil {
+			return execErr
+		}
+
+		rowID, idErr := result.LastInsertId()
+		if idErr != nil {
+			return idErr
+		}
+
+		for _, domain := range leafCert.AllDomains {
+			if _, execErr = insertDomain.ExecContext(ctx, rowID, domain); execErr != nil {
+				return execErr
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// prune deletes the entries that were seen longer than the retention ago, including their domains.
+// The caller must hold the mutex.
+func (s *sqliteSink) prune() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cutoff := float64(time.Now().Add(-s.retention).UnixMilli()) / 1_000
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM domains WHERE entry IN (SELECT id FROM entries WHERE seen < ?)`, cutoff); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM entries WHERE seen < ?`, cutoff)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if pruned, _ := result.RowsAffected(); pruned > 0 {
+		log.Printf("Sink '%s' pruned %d entries older than %s\n", s.name, pruned, s.retention)
+	}
+
+	return nil
+}
+
+// Close commits the current batch, stops the periodic commits and closes the database.
+func (s *sqliteSink) Close() error {
+	close(s.stop)
+	<-s.stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.Join(s.flush(), s.db.Close())
+}
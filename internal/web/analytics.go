@@ -0,0 +1,209 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+
+	psl "golang.org/x/net/publicsuffix"
+)
+
+const (
+	// analyticsDefaultTop and analyticsMaxTop are the default and maximum length of the top lists of a query.
+	analyticsDefaultTop = 10
+	analyticsMaxTop     = 100
+)
+
+// analytics holds the rolling counters of the analytics endpoint. It is set up by NewWebsocketServer and is nil if
+// analytics are disabled.
+var analytics *rollingCounters
+
+// analyticsBucket holds the counts of a single minute.
+type analyticsBucket struct {
+	minute     int64
+	total      int64
+	operators  map[string]int64
+	regDomains map[string]int64
+	// truncated counts the reg-domains not counted because the bucket already held the maximum number of reg-domains.
+	truncated int64
+}
+
+// rollingCounters counts certificates by operator and registrable domain in per-minute buckets over a rolling window.
+// Memory is bounded by the number of buckets and the maximum number of reg-domains per bucket. It is safe for concurrent use.
+type rollingCounters struct {
+	mu         sync.Mutex
+	buckets    []analyticsBucket
+	maxDomains int
+}
+
+// newRollingCounters creates rollingCounters that cover the given window with at most maxDomains reg-domains per minute.
+func newRollingCounters(window time.Duration, maxDomains int) *rollingCounters {
+	minutes := max(int((window+time.Minute-1)/time.Minute), 1)
+
+	return &rollingCounters{buckets: make([]analyticsBucket, minutes), maxDomains: maxDomains}
+}
+
+// RecordAnalytics counts the certificate of the entry for the analytics endpoint. It does nothing if analytics are disabled.
+func RecordAnalytics(entry *certstream.Entry) {
+	if analytics == nil || entry.MessageType != "certificate_update" {
+		return
+	}
+
+	analytics.record(time.Now(), entry.Data.Source.Operator, entry.Data.LeafCert.AllRegDomains)
+}
+
+// record counts a single certificate of the given operator and reg-domains in the bucket of the given time.
+func (c *rollingCounters) record(now time.Time, operator string, regDomains []string) {
+	minute := now.Unix() / 60
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bucket := &c.buckets[minute%int64(len(c.buckets))]
+	if bucket.minute != minute {
+		*bucket = analyticsBucket{minute: minute, operators: make(map[string]int64), regDomains: make(map[string]int64)}
+	}
+
+	bucket.total++
+	bucket.operators[operator]++
+
+	for _, regDomain := range regDomains {
+		if _, ok := bucket.regDomains[regDomain]; !ok && len(bucket.regDomains) >= c.maxDomains {
+			bucket.truncated++
+			continue
+		}
+
+		bucket.regDomains[regDomain]++
+	}
+}
+
+// analyticsCount is the count of a single operator or reg-domain.
+type analyticsCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// analyticsResult is the response of the analytics endpoint.
+type analyticsResult struct {
+	Window       string `json:"window"`
+	Certificates int64  `json:"certificates"`
+	// TruncatedDomains is the number of reg-domain counts dropped because of the per-minute limit. Counts of
+	// reg-domains are lower bounds if it is not zero.
+	TruncatedDomains int64            `json:"truncated_domains"`
+	TopOperators     []analyticsCount `json:"top_operators"`
+	TopRegDomains    []analyticsCount `json:"top_reg_domains"`
+	// RegDomain is the count of the queried domain, if a domain was given.
+	RegDomain *analyticsCount `json:"reg_domain,omitempty"`
+}
+
+// query sums the buckets within the window before now. If regDomain is not empty, its count is included.
+func (c *rollingCounters) query(now time.Time, window time.Duration, top int, regDomain string) analyticsResult {
+	minutes := min(max(int64((window+time.Minute-1)/time.Minute), 1), int64(len(c.buckets)))
+	currentMinute := now.Unix() / 60
+
+	result := analyticsResult{Window: (time.Duration(minutes) * time.Minute).String()}
+	operators := make(map[string]int64)
+	regDomains := make(map[string]int64)
+
+	c.mu.Lock()
+	for i := range c.buckets {
+		bucket := &c.buckets[i]
+		if bucket.minute <= currentMinute-minutes || bucket.minute > currentMinute {
+			continue
+		}
+
+		result.Certificates += bucket.total
+		result.TruncatedDomains += bucket.truncated
+
+		for operator, count := range bucket.operators {
+			operators[operator] += count
+		}
+
+		for domain, count := range bucket.regDomains {
+			regDomains[domain] += count
+		}
+	}
+	c.mu.Unlock()
+
+	result.TopOperators = topCounts(operators, top)
+	result.TopRegDomains = topCounts(regDomains, top)
+
+	if regDomain != "" {
+		result.RegDomain = &analyticsCount{Name: regDomain, Count: regDomains[regDomain]}
+	}
+
+	return result
+}
+
+// topCounts returns the n largest counts of the given map, sorted by count and name.
+func topCounts(counts map[string]int64, n int) []analyticsCount {
+	result := make([]analyticsCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, analyticsCount{Name: name, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result[:min(n, len(result))]
+}
+
+// analyticsHandler answers queries for the certificate counts within a window (query parameter "window", e.g. "5m",
+// defaults to the whole window). "domain" adds the count of the registrable domain of the given domain (e.g.
+// "*.example.com") and "top" sets the length of the top lists.
+func analyticsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := time.Duration(len(analytics.buckets)) * time.Minute
+	if value := query.Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "window must be a positive duration, e.g. '5m'", http.StatusBadRequest)
+			return
+		}
+
+		window = parsed
+	}
+
+	top := analyticsDefaultTop
+	if value := query.Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > analyticsMaxTop {
+			http.Error(w, "top must be an integer between 0 and "+strconv.Itoa(analyticsMaxTop), http.StatusBadRequest)
+			return
+		}
+
+		top = parsed
+	}
+
+	var regDomain string
+	if domain := strings.ToLower(strings.TrimSpace(query.Get("domain"))); domain != "" {
+		domain = strings.TrimPrefix(domain, "*.")
+
+		var err error
+		if regDomain, err = psl.EffectiveTLDPlusOne(domain); err != nil {
+			regDomain = domain
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(analytics.query(time.Now(), window, top, regDomain)); err != nil {
+		log.Println("Error while encoding analytics: ", err)
+	}
+}
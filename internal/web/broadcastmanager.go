@@ -1,16 +1,29 @@
 package web
 
 import (
+	"fmt"
 	"log"
+	"math"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	"github.com/gorilla/websocket"
 )
 
 type BroadcastManager struct {
 	Broadcast  chan certstream.Entry
 	clients    []*client
 	clientLock sync.RWMutex
+	// clientCount mirrors len(clients), so it can be checked per entry without taking the lock.
+	clientCount atomic.Int64
+	// draining is set on shutdown, after which new clients are rejected.
+	draining atomic.Bool
 }
 
 // registerClient adds a client to the list of clients of the BroadcastManager.
@@ -18,6 +31,7 @@ type BroadcastManager struct {
 func (bm *BroadcastManager) registerClient(c *client) {
 	bm.clientLock.Lock()
 	bm.clients = append(bm.clients, c)
+	bm.clientCount.Store(int64(len(bm.clients)))
 	log.Printf("Clients: %d, Capacity: %d\n", len(bm.clients), cap(bm.clients))
 	bm.clientLock.Unlock()
 }
@@ -33,16 +47,80 @@ func (bm *BroadcastManager) unregisterClient(c *client) {
 			bm.clients[i] = bm.clients[len(bm.clients)-1]
 			bm.clients[len(bm.clients)-1] = nil
 			bm.clients = bm.clients[:len(bm.clients)-1]
+			bm.clientCount.Store(int64(len(bm.clients)))
 
 			// Close the broadcast channel of the client, otherwise this leads to a memory leak
 			close(c.broadcastChan)
 
+			recordConnectionClosed(c.closeReason, c.connectedAt)
+			unregisterClientCounters(c.name)
+
 			break
 		}
 	}
 	bm.clientLock.Unlock()
 }
 
+// Drain disconnects all clients gracefully on shutdown. New clients are rejected, the entries queued for the clients
+// are sent and each connection is closed with a close frame (1001, going away) and the reason "server shutting down",
+// which includes the suggested reconnect delay in seconds if it is greater than zero. Connections that are not drained
+// within the timeout are closed without a close frame.
+func (bm *BroadcastManager) Drain(timeout, reconnectDelay time.Duration) {
+	bm.draining.Store(true)
+	deadline := time.Now().Add(timeout)
+
+	// Let the broadcaster hand the remaining entries to the clients first
+	for len(bm.Broadcast) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownReason(reconnectDelay))
+
+	bm.clientLock.RLock()
+	clients := slices.Clone(bm.clients)
+	bm.clientLock.RUnlock()
+
+	log.Printf("Draining %d clients...\n", len(clients))
+
+	for _, c := range clients {
+		select {
+		case c.drain <- drainRequest{deadline: deadline, closeMessage: closeMessage}:
+		default:
+		}
+	}
+
+	timeoutTimer := time.NewTimer(time.Until(deadline))
+	defer timeoutTimer.Stop()
+
+	forced := 0
+	for _, c := range clients {
+		select {
+		case <-c.done:
+		case <-timeoutTimer.C:
+			// The timer only fires once, all remaining clients are closed immediately
+			timeoutTimer.Reset(0)
+			_ = c.conn.Close()
+			forced++
+		}
+	}
+
+	log.Printf("Drained %d clients (%d closed after the timeout)\n", len(clients)-forced, forced)
+}
+
+// shutdownReason returns the reason of the close frame sent to clients on shutdown.
+func shutdownReason(reconnectDelay time.Duration) string {
+	if reconnectDelay <= 0 {
+		return "server shutting down"
+	}
+
+	return fmt.Sprintf("server shutting down; reconnect_after=%d", int64(math.Ceil(reconnectDelay.Seconds())))
+}
+
+// HasClients returns true if at least one client is connected. It is cheap enough to be called for every entry.
+func (bm *BroadcastManager) HasClients() bool {
+	return bm.clientCount.Load() > 0
+}
+
 // ClientFullCount returns the current number of clients connected to the service on the `full` endpoint.
 func (bm *BroadcastManager) ClientFullCount() (count int64) {
 	return bm.clientCountByType(SubTypeFull)
@@ -85,33 +163,54 @@ func (bm *BroadcastManager) GetSkippedCerts() map[string]uint64 {
 	return skippedCerts
 }
 
+// payloadKey identifies an encoded variant of an entry. Clients with the same key receive the same payload.
+type payloadKey struct {
+	subType        SubscriptionType
+	format         string
+	pem            bool
+	chain          string
+	canonical      bool
+	matchedRules   string
+	matchedDomains string
+}
+
 // broadcaster is run in a goroutine and handles the dispatching of entries to clients.
 func (bm *BroadcastManager) broadcaster() {
 	for {
 		entry := <-bm.Broadcast
-		dataLite := entry.JSONLite()
-		dataFull := entry.JSON()
-		dataDomain := entry.JSONDomains()
-		var data []byte
+
+		// Each variant of the entry is only encoded once and reused for all clients with the same payload key.
+		payloads := make(map[payloadKey][]byte, 4)
+
+		now := time.Now()
 
 		bm.clientLock.RLock()
 		for _, c := range bm.clients {
-			switch c.subType {
-			case SubTypeLite:
-				data = dataLite
-			case SubTypeFull:
-				data = dataFull
-			case SubTypeDomain:
-				data = dataDomain
-			default:
-				log.Printf("Unknown subscription type '%d' for client '%s'. Skipping this client!\n", c.subType, c.name)
+			var match filterMatch
+			if !c.wants(&entry, &match) {
+				c.counters.record(deliveryResultFiltered)
+				continue
+			}
+
+			// The rate limit only applies to the entries that passed the client's filters
+			if c.limiter != nil && !c.limiter.allow(now) {
+				c.counters.record(deliveryResultRateLimited)
+				c.rateLimited.Add(1)
+
+				continue
+			}
+
+			data := c.payload(&entry, match, payloads)
+			if data == nil {
 				continue
 			}
 
 			select {
 			case c.broadcastChan <- data:
+				c.counters.record(deliveryResultDelivered)
 			default:
 				// Default case is executed if the client's broadcast channel is full.
+				c.counters.record(deliveryResultDropped)
 				c.skippedCerts++
 				if c.skippedCerts%1000 == 1 {
 					log.Printf("Not providing client '%s' with cert because client's buffer is full. The client can't keep up. Skipped certs: %d\n", c.name, c.skippedCerts)
@@ -121,3 +220,116 @@ func (bm *BroadcastManager) broadcaster() {
 		bm.clientLock.RUnlock()
 	}
 }
+
+// payload returns the encoded entry for the client's subscription type and options. For filtered clients the payload
+// includes the rules of its filter and the domains that matched, as collected by wants. Payloads are stored in the
+// given cache.
+func (c *client) payload(entry *certstream.Entry, match filterMatch, cache map[payloadKey][]byte) []byte {
+	key := payloadKey{
+		subType:        c.subType,
+		format:         c.options.format,
+		pem:            c.options.pem && c.subType == SubTypeFull,
+		canonical:      c.options.canonical && c.options.format == formatJSON,
+		matchedRules:   strings.Join(match.rules, "\x00"),
+		matchedDomains: strings.Join(match.domains, "\x00"),
+	}
+
+	if c.subType == SubTypeFull {
+		key.chain = c.options.chain
+	}
+
+	if data, ok := cache[key]; ok {
+		return data
+	}
+
+	var variant certstream.Entry
+	switch key.chain {
+	case chainCompact:
+		variant = entry.WithCompactChain()
+	case chainNone:
+		variant = entry.Clone()
+		variant.Data.Chain = nil
+	default:
+		variant = entry.Clone()
+	}
+
+	variant.MatchedRules = match.rules
+	variant.MatchedDomains = match.domains
+
+	data, ok := encodePayload(&variant, key)
+	if !ok {
+		log.Printf("Unknown subscription type '%d' for client '%s'. Skipping this client!\n", c.subType, c.name)
+		return nil
+	}
+
+	if maxSize := config.AppConfig.Webserver.MaxMessageSize; maxSize > 0 && len(data) > maxSize {
+		data = trimPayload(&variant, key, maxSize)
+	}
+
+	cache[key] = data
+
+	return data
+}
+
+// encodePayload encodes the variant of an entry for the given payload key. Returns false for unknown subscription types.
+func encodePayload(variant *certstream.Entry, key payloadKey) ([]byte, bool) {
+	cbor := key.format == formatCBOR
+
+	var data []byte
+	switch {
+	case key.subType == SubTypeLite && cbor:
+		data = variant.CBORLiteNoCache()
+	case key.subType == SubTypeLite:
+		data = variant.JSONLiteNoCache()
+	case key.subType == SubTypeFull && key.pem && cbor:
+		data = variant.CBORPEMNoCache()
+	case key.subType == SubTypeFull && key.pem:
+		data = variant.JSONPEMNoCache()
+	case key.subType == SubTypeFull && cbor:
+		data = variant.CBORNoCache()
+	case key.subType == SubTypeFull:
+		data = variant.JSONNoCache()
+	case key.subType == SubTypeDomain && cbor:
+		data = variant.CBORDomains()
+	case key.subType == SubTypeDomain:
+		data = variant.JSONDomains()
+	default:
+		return nil, false
+	}
+
+	if key.canonical {
+		data = certstream.CanonicalJSON(data)
+	}
+
+	return data, true
+}
+
+// trimPayload handles entries whose payload exceeds the maximum message size. Depending on the oversized_action,
+// the entry is either skipped or trimmed: for the full stream, the chain is removed first and if that is not
+// enough, the entry is sent in its lite form (without as_der/as_pem). Entries that are still too large are skipped.
+// Returns nil if the entry is skipped.
+func trimPayload(variant *certstream.Entry, key payloadKey, maxSize int) []byte {
+	if config.AppConfig.Webserver.OversizedAction != oversizedActionTrim || key.subType != SubTypeFull {
+		recordOversizedMessage(oversizedActionSkip)
+		return nil
+	}
+
+	variant.Data.Chain = nil
+	variant.Data.CompactChain = nil
+	if data, _ := encodePayload(variant, key); len(data) <= maxSize {
+		recordOversizedMessage(oversizedActionTrim)
+		return data
+	}
+
+	liteKey := key
+	liteKey.subType = SubTypeLite
+	liteKey.pem = false
+	if data, _ := encodePayload(variant, liteKey); len(data) <= maxSize {
+		recordOversizedMessage(oversizedActionTrim)
+		return data
+	}
+
+	recordOversizedMessage(oversizedActionSkip)
+
+	return nil
+}
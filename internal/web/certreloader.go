@@ -0,0 +1,111 @@
+package web
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader provides the TLS certificate of a server and reloads it when the certificate or key file changes on
+// disk, e.g. after a renewal by an ACME client. Changes are detected by periodically comparing the modification times.
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+// newCertReloader loads the certificate and starts checking the files for changes every interval.
+func newCertReloader(certPath, keyPath string, interval time.Duration) (*certReloader, error) {
+	reloader := &certReloader{certPath: certPath, keyPath: keyPath}
+
+	modTime, err := reloader.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reloader.load(modTime); err != nil {
+		return nil, err
+	}
+
+	go reloader.watch(interval)
+
+	return reloader, nil
+}
+
+// GetCertificate returns the currently loaded certificate. It is used as tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.certificate, nil
+}
+
+// latestModTime returns the latest modification time of the certificate and key file.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	certInfo, err := os.Stat(r.certPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(r.keyPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+
+	return certInfo.ModTime(), nil
+}
+
+// load reads the certificate and key and replaces the current certificate.
+func (r *certReloader) load(modTime time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("could not load certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.certificate = &certificate
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+// watch reloads the certificate whenever one of the files was modified. If the new files can't be loaded (e.g.
+// because only one of them was written yet), the previous certificate is kept and loading is retried next time.
+func (r *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		modTime, err := r.latestModTime()
+		if err != nil {
+			log.Printf("Could not check certificate '%s' for changes: %s\n", r.certPath, err)
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := r.load(modTime); err != nil {
+			log.Printf("Could not reload certificate '%s', keeping the previous one: %s\n", r.certPath, err)
+			continue
+		}
+
+		log.Printf("Reloaded certificate '%s'\n", r.certPath)
+	}
+}
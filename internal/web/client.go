@@ -1,10 +1,23 @@
 package web
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
 	"github.com/gorilla/websocket"
 )
 
@@ -16,22 +29,372 @@ const (
 
 type SubscriptionType int
 
+// String returns the name of the subscription type as used in metric labels.
+func (t SubscriptionType) String() string {
+	switch t {
+	case SubTypeFull:
+		return "full"
+	case SubTypeLite:
+		return "lite"
+	case SubTypeDomain:
+		return "domain"
+	default:
+		return "unknown"
+	}
+}
+
+// Wire formats a client can choose for the entries sent to it.
+const (
+	formatJSON = "json"
+	formatCBOR = "cbor"
+)
+
+// Chain forms a client of the full stream can choose: the full chain certificates, only the issuer identifiers
+// of each chain certificate (compact_chain) or no chain at all.
+const (
+	chainFull    = "full"
+	chainCompact = "compact"
+	chainNone    = "none"
+)
+
+// maxSerialPatternLength is the maximum length of the serial_prefix and serial_regex subscription options.
+const maxSerialPatternLength = 256
+
+// subscriptionOptions holds the options a client can choose per connection via query parameters.
+type subscriptionOptions struct {
+	// pem makes the full stream provide certificates as PEM (as_pem) instead of base64 encoded DER (as_der).
+	pem bool
+	// filter is the parsed filter expression. Only entries matching the filter are sent to the client.
+	filter filterNode
+	// format is the wire format of the entries, either formatJSON (text frames) or formatCBOR (binary frames).
+	format string
+	// chain is the form of the chain of the full stream, one of chainFull, chainCompact or chainNone.
+	chain string
+	// canonical encodes JSON entries with sorted keys and without whitespace, see certstream.CanonicalJSON.
+	canonical bool
+	// minSAN and maxSAN bound the number of SANs of the certificate. maxSAN is -1 if there is no upper bound.
+	minSAN int
+	maxSAN int
+	// minSCT and maxSCT bound the number of embedded SCTs. If set, precertificates are not sent as they contain no SCTs.
+	// minSCT is 0 and maxSCT is -1 if there is no bound.
+	minSCT int
+	maxSCT int
+	// isCA only sends entries whose leaf certificate is (true) or isn't (false) a CA certificate. Nil sends both.
+	isCA *bool
+	// serialPrefix only sends entries whose leaf serial number (uppercase hex without separators) starts with the prefix.
+	serialPrefix string
+	// serialRegex only sends entries whose leaf serial number matches the case-insensitive regular expression.
+	serialRegex *regexp.Regexp
+	// startedOnly only sends certificates whose validity period started before they were seen.
+	startedOnly bool
+	// maxRate is the maximum number of entries per second requested by the client. Zero requests no limit.
+	maxRate float64
+	// issuerTrust only sends entries whose issuing CA has one of the trust statuses, see certstream.IssuerTrustTrusted.
+	issuerTrust []string
+}
+
+// parseSubscriptionOptions reads the subscription options from the query parameters of the given url.
+func parseSubscriptionOptions(u *url.URL) (subscriptionOptions, error) {
+	query := u.Query()
+
+	pem, _ := strconv.ParseBool(query.Get("pem"))
+	canonical, _ := strconv.ParseBool(query.Get("canonical"))
+	startedOnly, _ := strconv.ParseBool(query.Get("started_only"))
+
+	options := subscriptionOptions{
+		pem:         pem,
+		format:      formatJSON,
+		chain:       chainFull,
+		canonical:   canonical,
+		startedOnly: startedOnly,
+		maxSAN:      -1,
+		maxSCT:      -1,
+	}
+
+	switch format := strings.ToLower(query.Get("format")); format {
+	case "", formatJSON:
+	case formatCBOR:
+		options.format = formatCBOR
+	default:
+		return subscriptionOptions{}, fmt.Errorf("unknown format '%s', use '%s' or '%s'", format, formatJSON, formatCBOR)
+	}
+
+	switch chain := strings.ToLower(query.Get("chain")); chain {
+	case "", chainFull:
+	case chainCompact, chainNone:
+		options.chain = chain
+	default:
+		return subscriptionOptions{}, fmt.Errorf("unknown chain '%s', use '%s', '%s' or '%s'", chain, chainFull, chainCompact, chainNone)
+	}
+
+	if expression := query.Get("filter"); expression != "" {
+		filter, err := parseFilter(expression)
+		if err != nil {
+			return subscriptionOptions{}, err
+		}
+
+		options.filter = filter
+	}
+
+	var err error
+	if options.minSAN, err = parseCountBound(query, "min_san", 0); err != nil {
+		return subscriptionOptions{}, err
+	}
+
+	if options.maxSAN, err = parseCountBound(query, "max_san", -1); err != nil {
+		return subscriptionOptions{}, err
+	}
+
+	if options.maxSAN >= 0 && options.minSAN > options.maxSAN {
+		return subscriptionOptions{}, fmt.Errorf("min_san (%d) must not be greater than max_san (%d)", options.minSAN, options.maxSAN)
+	}
+
+	if options.minSCT, err = parseCountBound(query, "min_sct", 0); err != nil {
+		return subscriptionOptions{}, err
+	}
+
+	if options.maxSCT, err = parseCountBound(query, "max_sct", -1); err != nil {
+		return subscriptionOptions{}, err
+	}
+
+	if options.maxSCT >= 0 && options.minSCT > options.maxSCT {
+		return subscriptionOptions{}, fmt.Errorf("min_sct (%d) must not be greater than max_sct (%d)", options.minSCT, options.maxSCT)
+	}
+
+	if value := query.Get("is_ca"); value != "" {
+		isCA, parseErr := strconv.ParseBool(value)
+		if parseErr != nil {
+			return subscriptionOptions{}, fmt.Errorf("is_ca must be a boolean, got '%s'", value)
+		}
+
+		options.isCA = &isCA
+	}
+
+	if options.serialPrefix, err = parseSerialPrefix(query.Get("serial_prefix")); err != nil {
+		return subscriptionOptions{}, err
+	}
+
+	if value := query.Get("max_rate"); value != "" {
+		maxRate, parseErr := strconv.ParseFloat(value, 64)
+		if parseErr != nil || !(maxRate > 0) || math.IsInf(maxRate, 0) {
+			return subscriptionOptions{}, fmt.Errorf("max_rate must be a positive number, got '%s'", value)
+		}
+
+		options.maxRate = maxRate
+	}
+
+	if pattern := query.Get("serial_regex"); pattern != "" {
+		if len(pattern) > maxSerialPatternLength {
+			return subscriptionOptions{}, fmt.Errorf("serial_regex must not be longer than %d characters", maxSerialPatternLength)
+		}
+
+		serialRegex, compileErr := regexp.Compile("(?i)" + pattern)
+		if compileErr != nil {
+			return subscriptionOptions{}, fmt.Errorf("invalid serial_regex: %w", compileErr)
+		}
+
+		options.serialRegex = serialRegex
+	}
+
+	if options.issuerTrust, err = parseIssuerTrust(query.Get("issuer_trust")); err != nil {
+		return subscriptionOptions{}, err
+	}
+
+	return options, nil
+}
+
+// parseIssuerTrust reads the comma separated list of trust statuses of the issuer_trust option.
+// The trust status is derived from the ccadb issuer record, so the option requires it to be enabled.
+func parseIssuerTrust(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if !config.AppConfig.CCADB.IssuerRecord.Enabled {
+		return nil, errors.New("issuer_trust requires ccadb.issuer_record to be enabled")
+	}
+
+	var statuses []string
+	for _, status := range strings.Split(value, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+
+		switch status {
+		case certstream.IssuerTrustTrusted, certstream.IssuerTrustDistrusted, certstream.IssuerTrustRevoked, certstream.IssuerTrustUnknown:
+			statuses = append(statuses, status)
+		default:
+			return nil, fmt.Errorf("unknown issuer_trust '%s', use '%s', '%s', '%s' or '%s'", status, certstream.IssuerTrustTrusted,
+				certstream.IssuerTrustDistrusted, certstream.IssuerTrustRevoked, certstream.IssuerTrustUnknown)
+		}
+	}
+
+	return statuses, nil
+}
+
+// parseCountBound reads a non-negative count from the given query parameter or returns the default if it is not set.
+func parseCountBound(query url.Values, name string, defaultValue int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	bound, err := strconv.Atoi(value)
+	if err != nil || bound < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+
+	return bound, nil
+}
+
+// parseSerialPrefix normalizes a serial number prefix to the format of the serial_number field: uppercase hex without
+// separators. Colons and spaces, as used by many tools to display serial numbers, are removed.
+func parseSerialPrefix(value string) (string, error) {
+	if len(value) > maxSerialPatternLength {
+		return "", fmt.Errorf("serial_prefix must not be longer than %d characters", maxSerialPatternLength)
+	}
+
+	prefix := strings.ToUpper(strings.NewReplacer(":", "", " ", "").Replace(value))
+	for _, char := range prefix {
+		if !strings.ContainsRune("0123456789ABCDEF", char) {
+			return "", fmt.Errorf("serial_prefix must be hexadecimal, got '%s'", value)
+		}
+	}
+
+	return prefix, nil
+}
+
+// matchesSerialNumber checks if the serial number of the leaf certificate matches the serial prefix and regex of the options.
+func (o subscriptionOptions) matchesSerialNumber(entry *certstream.Entry) bool {
+	serialNumber := entry.Data.LeafCert.SerialNumber
+
+	if !strings.HasPrefix(serialNumber, o.serialPrefix) {
+		return false
+	}
+
+	return o.serialRegex == nil || o.serialRegex.MatchString(serialNumber)
+}
+
+// matchesSANCount checks if the number of SANs of the entry is within the bounds of the options.
+func (o subscriptionOptions) matchesSANCount(entry *certstream.Entry) bool {
+	sanCount := entry.Data.LeafCert.CertTypeExt.SANCount
+
+	return sanCount >= o.minSAN && (o.maxSAN < 0 || sanCount <= o.maxSAN)
+}
+
+// matchesSCTCount checks if the number of embedded SCTs of the entry is within the bounds of the options.
+// Without bounds, all entries match. With bounds, only final certificates can match.
+func (o subscriptionOptions) matchesSCTCount(entry *certstream.Entry) bool {
+	if o.minSCT == 0 && o.maxSCT < 0 {
+		return true
+	}
+
+	if entry.Data.UpdateType != "X509LogEntry" || entry.MessageType != "certificate_update" {
+		return false
+	}
+
+	sctCount := entry.Data.LeafCert.CertTypeExt.SCTCount
+
+	return sctCount >= o.minSCT && (o.maxSCT < 0 || sctCount <= o.maxSCT)
+}
+
+// wants checks if the given entry passes the client's SAN and SCT count bounds, CA restriction, serial number
+// patterns, validity restriction and filter. The rules and domains that matched the filter are added to match.
+// Degraded entries and reg-domain summaries contain no domains, so they are not sent to the domains-only stream.
+func (c *client) wants(entry *certstream.Entry, match *filterMatch) bool {
+	if c.subType == SubTypeDomain && (entry.MessageType == "degraded_entry" || entry.MessageType == "reg_domain_summary") {
+		return false
+	}
+
+	if !c.options.matchesSANCount(entry) || !c.options.matchesSCTCount(entry) {
+		return false
+	}
+
+	if c.options.isCA != nil && entry.Data.LeafCert.IsCA != *c.options.isCA {
+		return false
+	}
+
+	if !c.options.matchesSerialNumber(entry) {
+		return false
+	}
+
+	if c.options.startedOnly && entry.MessageType == "certificate_update" && !entry.ValidityStarted() {
+		return false
+	}
+
+	if c.options.issuerTrust != nil && !slices.Contains(c.options.issuerTrust, entry.Data.LeafCert.IssuerTrust) {
+		return false
+	}
+
+	return c.options.filter == nil || c.options.filter.matches(entry, match)
+}
+
 // client represents a single client's connection to the server.
 type client struct {
 	conn          *websocket.Conn
 	broadcastChan chan []byte
 	name          string
 	subType       SubscriptionType
+	options       subscriptionOptions
 	skippedCerts  uint64
+	connectedAt   time.Time
+	// limiter limits the rate of entries sent to the client and is nil if the client is not rate limited.
+	// rateLimited counts the entries dropped by the limiter, which are reported to the client in stats frames.
+	limiter     *tokenBucket
+	rateLimited atomic.Uint64
+	// counters count the delivered, filtered and dropped entries for the subscription metrics.
+	counters subscriptionCounters
+
+	// drain asks the broadcastHandler to send the queued entries and close the connection on shutdown. done is
+	// closed when the broadcastHandler stopped.
+	drain chan drainRequest
+	done  chan struct{}
+
+	// closeReason is the reason why the connection was closed. Only the first reason set is kept.
+	closeReason     string
+	closeReasonOnce sync.Once
+}
+
+// drainRequest is sent to the broadcastHandler of each client on shutdown.
+type drainRequest struct {
+	deadline     time.Time
+	closeMessage []byte
 }
 
-func newClient(conn *websocket.Conn, subType SubscriptionType, name string, certBufferSize int) *client {
-	return &client{
+func newClient(conn *websocket.Conn, subType SubscriptionType, options subscriptionOptions, name string, certBufferSize int) *client {
+	c := &client{
 		conn:          conn,
 		broadcastChan: make(chan []byte, certBufferSize),
 		name:          name,
 		subType:       subType,
+		options:       options,
+		connectedAt:   time.Now(),
+		counters:      newSubscriptionCounters(subType, name),
+		drain:         make(chan drainRequest, 1),
+		done:          make(chan struct{}),
 	}
+
+	if rate := effectiveRate(options.maxRate, config.AppConfig.Webserver.MaxClientRate); rate > 0 {
+		c.limiter = newTokenBucket(rate)
+	}
+
+	return c
+}
+
+// setCloseReason stores the reason why the connection was closed, unless a reason was already set before.
+func (c *client) setCloseReason(reason string) {
+	c.closeReasonOnce.Do(func() {
+		c.closeReason = reason
+	})
+}
+
+// writeErrorReason returns the close reason for an error that occurred while writing to the client.
+// Writes can only time out if the client doesn't read the messages fast enough.
+func writeErrorReason(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return closeReasonSlowClient
+	}
+
+	return closeReasonError
 }
 
 // Each client has a broadcastHandler that runs in the background and sends out the broadcast messages to the client.
@@ -39,14 +402,36 @@ func (c *client) broadcastHandler() {
 	writeWait := 60 * time.Second
 	pingTicker := time.NewTicker(30 * time.Second)
 
+	messageType := websocket.TextMessage
+	if c.options.format == formatCBOR {
+		messageType = websocket.BinaryMessage
+	}
+
+	// Rate limited clients are informed about the entries dropped due to the rate limit via stats frames
+	var statsTick <-chan time.Time
+	var reportedRateLimited uint64
+
+	if c.limiter != nil {
+		statsTicker := time.NewTicker(statsInterval)
+		defer statsTicker.Stop()
+
+		statsTick = statsTicker.C
+	}
+
+	// closeSent is set if the drain already sent a close frame with the shutdown reason, which must be the only one.
+	closeSent := false
+
 	defer func() {
 		log.Println("Closing broadcast handler for client:", c.conn.RemoteAddr())
 
 		pingTicker.Stop()
 
-		_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-		_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		if !closeSent {
+			_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		}
 		_ = c.conn.Close()
+		close(c.done)
 	}()
 
 	for {
@@ -55,14 +440,44 @@ func (c *client) broadcastHandler() {
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.setCloseReason(writeErrorReason(err))
 				return
 			}
+		case <-statsTick:
+			rateLimited := c.rateLimited.Load()
+			if rateLimited == reportedRateLimited {
+				continue
+			}
+
+			frame, err := encodeStatsFrame(c.options.format, rateLimited, c.limiter.rate)
+			if err != nil {
+				log.Printf("Error while encoding stats frame: %v\n", err)
+				continue
+			}
+
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+			if writeErr := c.conn.WriteMessage(messageType, frame); writeErr != nil {
+				c.setCloseReason(writeErrorReason(writeErr))
+				return
+			}
+
+			reportedRateLimited = rateLimited
+		case request := <-c.drain:
+			c.setCloseReason(closeReasonShutdown)
+			c.flush(messageType, request.deadline)
+			_ = c.conn.WriteControl(websocket.CloseMessage, request.closeMessage, request.deadline)
+			closeSent = true
+
+			return
 		case message := <-c.broadcastChan:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
+			w, err := c.conn.NextWriter(messageType)
 			if err != nil {
 				log.Printf("Error while getting next writer: %v\n", err)
+				c.setCloseReason(writeErrorReason(err))
+
 				return
 			}
 
@@ -73,12 +488,34 @@ func (c *client) broadcastHandler() {
 
 			if closeErr := w.Close(); closeErr != nil {
 				log.Printf("Error while closing: %v\n", closeErr)
+				c.setCloseReason(writeErrorReason(closeErr))
+
 				return
 			}
 		}
 	}
 }
 
+// flush sends the entries queued for the client until the queue is empty or the deadline is exceeded.
+func (c *client) flush(messageType int, deadline time.Time) {
+	_ = c.conn.SetWriteDeadline(deadline)
+
+	for {
+		select {
+		case message, ok := <-c.broadcastChan:
+			if !ok {
+				return
+			}
+
+			if err := c.conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
 // listenWebsocket is running in the background on a goroutine and listens for messages from the client.
 // It responds to ping messages with a pong message. It closes the connection if the client sends
 // a close message or no ping is received within 65 seconds.
@@ -115,16 +552,20 @@ func (c *client) listenWebsocket() {
 		if readErr != nil {
 			if websocket.IsUnexpectedCloseError(readErr, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				log.Printf("Unexpected websocket close error: %v\n", readErr)
+				c.setCloseReason(closeReasonError)
 			}
 
 			if strings.Contains(strings.ToLower(readErr.Error()), "i/o timeout") {
 				log.Printf("No ping received from client: %v\n", c.conn.RemoteAddr())
+				c.setCloseReason(closeReasonTimeout)
 				closeMessage := websocket.FormatCloseMessage(websocket.CloseNoStatusReceived, "No ping received!")
 				c.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(5*time.Second)) //nolint:errcheck
 			} else if strings.Contains(strings.ToLower(readErr.Error()), "an existing connection was forcibly closed by the remote host") {
 				log.Printf("Connection to client lost: %v\n", c.conn.RemoteAddr())
 			}
 
+			c.setCloseReason(closeReasonNormal)
+
 			log.Printf("Disconnecting client %v!\n", c.conn.RemoteAddr())
 
 			break
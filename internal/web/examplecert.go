@@ -2,33 +2,66 @@ package web
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
 )
 
-var exampleCert certstream.Entry
+// exampleEncodings holds the encoded representations of the example certificate.
+// It is never modified after it was stored, so it can be read by any number of handlers.
+type exampleEncodings struct {
+	full    []byte
+	lite    []byte
+	domains []byte
+}
+
+// exampleCert is replaced atomically by SetExampleCert, so the example endpoints never race with updates.
+var exampleCert atomic.Pointer[exampleEncodings]
+
+// emptyExampleCert is served until the first example certificate was stored.
+var emptyExampleCert = encodeExampleCert(certstream.Entry{})
+
+// loadExampleCert returns the current example certificate or an empty one if none was set yet.
+func loadExampleCert() *exampleEncodings {
+	if example := exampleCert.Load(); example != nil {
+		return example
+	}
+
+	return emptyExampleCert
+}
+
+// encodeExampleCert encodes the entry in all formats offered by the example endpoints.
+func encodeExampleCert(cert certstream.Entry) *exampleEncodings {
+	return &exampleEncodings{
+		full:    cert.JSONNoCache(),
+		lite:    cert.JSONLiteNoCache(),
+		domains: cert.JSONDomains(),
+	}
+}
 
 // exampleFull handles requests to the /full-stream/example.json endpoint.
 // It returns a JSON representation of the full example certificate.
 func exampleFull(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(exampleCert.JSON()) //nolint:errcheck
+	w.Write(loadExampleCert().full) //nolint:errcheck
 }
 
 // exampleLite handles requests to the /example.json endpoint.
 // It returns a JSON representation of the lite example certificate.
 func exampleLite(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(exampleCert.JSONLite()) //nolint:errcheck
+	w.Write(loadExampleCert().lite) //nolint:errcheck
 }
 
 // exampleDomains handles requests to the /domains-only/example.json endpoint.
 // It returns a JSON representation of the domain data.
 func exampleDomains(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(exampleCert.JSONDomains()) //nolint:errcheck
+	w.Write(loadExampleCert().domains) //nolint:errcheck
 }
 
+// SetExampleCert stores the entry as the example certificate. It is safe for concurrent use.
+// The entry is encoded once here, so the handlers only read immutable byte slices.
 func SetExampleCert(cert certstream.Entry) {
-	exampleCert = cert
+	exampleCert.Store(encodeExampleCert(cert))
 }
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+// TestSetExampleCertConcurrent updates the example certificate while the example endpoints are read. Run it with
+// -race to detect unsynchronized access.
+func TestSetExampleCertConcurrent(t *testing.T) {
+	const writers, readers, iterations = 4, 8, 200
+
+	handlers := []http.HandlerFunc{exampleFull, exampleLite, exampleDomains}
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				entry := certstream.Entry{MessageType: "certificate_update"}
+				entry.Data.LeafCert.AllDomains = []string{fmt.Sprintf("writer%d-%d.example.com", w, i)}
+				SetExampleCert(entry)
+			}
+		}(w)
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+
+		go func(r int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				recorder := httptest.NewRecorder()
+				handlers[(r+i)%len(handlers)](recorder, httptest.NewRequest(http.MethodGet, "/example.json", nil))
+
+				if !json.Valid(recorder.Body.Bytes()) {
+					t.Errorf("example endpoint returned invalid JSON: %q", recorder.Body.String())
+					return
+				}
+			}
+		}(r)
+	}
+
+	wg.Wait()
+
+	entry := certstream.Entry{MessageType: "certificate_update"}
+	entry.Data.LeafCert.AllDomains = []string{"last.example.com"}
+	SetExampleCert(entry)
+
+	recorder := httptest.NewRecorder()
+	exampleDomains(recorder, httptest.NewRequest(http.MethodGet, "/domains-only/example.json", nil))
+
+	var domains struct {
+		Data []string `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &domains); err != nil {
+		t.Fatalf("could not decode domains example: %s", err)
+	}
+
+	if len(domains.Data) != 1 || domains.Data[0] != "last.example.com" {
+		t.Errorf("domains example = %q, want the last stored certificate", domains.Data)
+	}
+}
@@ -0,0 +1,542 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+const (
+	// maxFilterLength is the maximum length of a filter expression in bytes.
+	maxFilterLength = 1024
+	// maxFilterDepth is the maximum nesting depth of parentheses and NOT operators in a filter expression.
+	maxFilterDepth = 16
+	// maxFilterPredicates is the maximum number of predicates in a single filter expression.
+	maxFilterPredicates = 32
+)
+
+var errInvalidFilter = errors.New("invalid filter")
+
+// filterNode is a node of a parsed filter expression that can be evaluated against an entry.
+type filterNode interface {
+	// matches checks if the entry matches the node. If match is not nil, the rules of the node and the domains that
+	// matched the entry are added to it, so the entry only has to be evaluated once.
+	matches(entry *certstream.Entry, match *filterMatch) bool
+	String() string
+}
+
+// filterMatch describes why an entry matched a filter.
+type filterMatch struct {
+	// rules are the predicates of the filter that matched the entry.
+	rules []string
+	// domains are the domains of the leaf certificate that satisfied a domain predicate, without duplicates.
+	domains []string
+}
+
+// andNode matches if all of its children match.
+type andNode []filterNode
+
+// matches only reports the rules of the children if the conjunction as a whole matched. The rules and domains added
+// by the children before one of them didn't match are removed again.
+func (n andNode) matches(entry *certstream.Entry, match *filterMatch) bool {
+	var rules, domains int
+	if match != nil {
+		rules, domains = len(match.rules), len(match.domains)
+	}
+
+	for _, child := range n {
+		if !child.matches(entry, match) {
+			if match != nil {
+				match.rules, match.domains = match.rules[:rules], match.domains[:domains]
+			}
+
+			return false
+		}
+	}
+
+	return true
+}
+
+func (n andNode) String() string {
+	return joinNodes(n, " AND ")
+}
+
+// orNode matches if at least one of its children matches.
+type orNode []filterNode
+
+// matches reports the rules of all children that matched. Without a match to fill, it stops at the first matching child.
+func (n orNode) matches(entry *certstream.Entry, match *filterMatch) bool {
+	matched := false
+
+	for _, child := range n {
+		if child.matches(entry, match) {
+			if match == nil {
+				return true
+			}
+
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func (n orNode) String() string {
+	return joinNodes(n, " OR ")
+}
+
+// joinNodes joins the string representation of the given nodes with the separator and wraps them in parentheses.
+func joinNodes(nodes []filterNode, separator string) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.String()
+	}
+
+	return "(" + strings.Join(parts, separator) + ")"
+}
+
+// notNode inverts the result of its child.
+type notNode struct {
+	child filterNode
+}
+
+// matches reports the negation as a whole, since the rules within it did not match.
+// A negation never contributes matched domains.
+func (n notNode) matches(entry *certstream.Entry, match *filterMatch) bool {
+	if n.child.matches(entry, nil) {
+		return false
+	}
+
+	if match != nil {
+		match.rules = append(match.rules, n.String())
+	}
+
+	return true
+}
+
+func (n notNode) String() string {
+	return "NOT " + n.child.String()
+}
+
+// predicate is a single comparison such as 'domain~=bank' within a filter expression.
+type predicate struct {
+	field    string
+	operator string
+	value    string
+	match    func(entry *certstream.Entry) bool
+	// matchDomains appends the domains that satisfy the predicate. It is only set for domain predicates.
+	matchDomains func(entry *certstream.Entry, domains []string) []string
+}
+
+func (p predicate) matches(entry *certstream.Entry, match *filterMatch) bool {
+	if !p.match(entry) {
+		return false
+	}
+
+	if match != nil {
+		match.rules = append(match.rules, p.String())
+		if p.matchDomains != nil {
+			match.domains = p.matchDomains(entry, match.domains)
+		}
+	}
+
+	return true
+}
+
+// String returns the predicate in the form it was written in, e.g. 'domain~=bank'.
+func (p predicate) String() string {
+	value := p.value
+	if strings.ContainsAny(value, " \t()=~") || value == "" {
+		value = `"` + value + `"`
+	}
+
+	return p.field + p.operator + value
+}
+
+// predicateBuilder validates the operator and value of a predicate and returns the function used to match entries.
+type predicateBuilder func(operator, value string) (func(entry *certstream.Entry) bool, error)
+
+// filterFields maps the field names usable in filter expressions to their predicate builders.
+var filterFields = map[string]predicateBuilder{
+	"domain":          buildDomainPredicate,
+	"cert_type":       buildChoicePredicate(func(e *certstream.Entry) string { return e.Data.LeafCert.CertType }, "single", "multi", "wildcard"),
+	"validation_type": buildChoicePredicate(func(e *certstream.Entry) string { return e.Data.LeafCert.ValidationType }, "dv", "ov", "iv", "ev"),
+	"issuer":          buildIssuerPredicate,
+	"precert":         buildBoolPredicate(func(e *certstream.Entry) bool { return e.Data.UpdateType == "PrecertLogEntry" }),
+	"new_issuer":      buildBoolPredicate(func(e *certstream.Entry) bool { return e.Data.LeafCert.NewIssuer }),
+	"is_ca":           buildBoolPredicate(func(e *certstream.Entry) bool { return e.Data.LeafCert.IsCA }),
+}
+
+// buildDomainPredicate matches if any of the domains of the leaf certificate equals (=) or contains (~=) the value.
+func buildDomainPredicate(operator, value string) (func(entry *certstream.Entry) bool, error) {
+	value = strings.ToLower(value)
+
+	compare, err := stringComparison(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(entry *certstream.Entry) bool {
+		for _, domain := range entry.Data.LeafCert.AllDomains {
+			if compare(strings.ToLower(domain), value) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// buildDomainCollector returns a function that appends the domains of the leaf certificate that equal (=) or
+// contain (~=) the value and are not yet in domains.
+func buildDomainCollector(operator, value string) (func(entry *certstream.Entry, domains []string) []string, error) {
+	value = strings.ToLower(value)
+
+	compare, err := stringComparison(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(entry *certstream.Entry, domains []string) []string {
+		for _, domain := range entry.Data.LeafCert.AllDomains {
+			if compare(strings.ToLower(domain), value) && !slices.Contains(domains, domain) {
+				domains = append(domains, domain)
+			}
+		}
+
+		return domains
+	}, nil
+}
+
+// buildIssuerPredicate matches if the CA owner or the organization or common name of the issuer
+// equals (=) or contains (~=) the value.
+func buildIssuerPredicate(operator, value string) (func(entry *certstream.Entry) bool, error) {
+	value = strings.ToLower(value)
+
+	compare, err := stringComparison(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(entry *certstream.Entry) bool {
+		leafCert := &entry.Data.LeafCert
+		candidates := []*string{&leafCert.CAOwner, leafCert.Issuer.O, leafCert.Issuer.CN}
+
+		for _, candidate := range candidates {
+			if candidate != nil && compare(strings.ToLower(*candidate), value) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// buildChoicePredicate returns a predicateBuilder for fields that only allow the given (lowercase) values.
+func buildChoicePredicate(getter func(entry *certstream.Entry) string, choices ...string) predicateBuilder {
+	return func(operator, value string) (func(entry *certstream.Entry) bool, error) {
+		if operator != "=" {
+			return nil, fmt.Errorf("operator '%s' not supported, use '='", operator)
+		}
+
+		value = strings.ToLower(value)
+
+		for _, choice := range choices {
+			if value == choice {
+				return func(entry *certstream.Entry) bool {
+					return strings.ToLower(getter(entry)) == value
+				}, nil
+			}
+		}
+
+		return nil, fmt.Errorf("value '%s' not allowed, use one of %s", value, strings.Join(choices, ", "))
+	}
+}
+
+// buildBoolPredicate returns a predicateBuilder for boolean fields.
+func buildBoolPredicate(getter func(entry *certstream.Entry) bool) predicateBuilder {
+	return func(operator, value string) (func(entry *certstream.Entry) bool, error) {
+		if operator != "=" {
+			return nil, fmt.Errorf("operator '%s' not supported, use '='", operator)
+		}
+
+		expected, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("value '%s' is not a boolean", value)
+		}
+
+		return func(entry *certstream.Entry) bool {
+			return getter(entry) == expected
+		}, nil
+	}
+}
+
+// stringComparison returns the comparison function for the given string operator.
+func stringComparison(operator string) (func(s, value string) bool, error) {
+	switch operator {
+	case "=":
+		return func(s, value string) bool { return s == value }, nil
+	case "~=":
+		return strings.Contains, nil
+	default:
+		return nil, fmt.Errorf("unknown operator '%s'", operator)
+	}
+}
+
+type filterTokenKind int
+
+const (
+	tokenWord filterTokenKind = iota
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenEnd
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+// tokenizeFilter splits a filter expression into its tokens. Values containing whitespace, parentheses
+// or operator characters can be put in double quotes.
+func tokenizeFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for pos := 0; pos < len(expression); {
+		char := expression[pos]
+
+		switch {
+		case char == ' ' || char == '\t':
+			pos++
+		case char == '(':
+			tokens = append(tokens, filterToken{kind: tokenLeftParen, text: "(", pos: pos})
+			pos++
+		case char == ')':
+			tokens = append(tokens, filterToken{kind: tokenRightParen, text: ")", pos: pos})
+			pos++
+		case char == '=':
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: "=", pos: pos})
+			pos++
+		case char == '~':
+			if !strings.HasPrefix(expression[pos:], "~=") {
+				return nil, fmt.Errorf("%w: expected '~=' at position %d", errInvalidFilter, pos)
+			}
+
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: "~=", pos: pos})
+			pos += 2
+		case char == '"':
+			end := strings.IndexByte(expression[pos+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated quote at position %d", errInvalidFilter, pos)
+			}
+
+			tokens = append(tokens, filterToken{kind: tokenWord, text: expression[pos+1 : pos+1+end], pos: pos})
+			pos += end + 2
+		default:
+			start := pos
+			for pos < len(expression) && !strings.ContainsRune(" \t()=~\"", rune(expression[pos])) {
+				pos++
+			}
+
+			tokens = append(tokens, filterToken{kind: tokenWord, text: expression[start:pos], pos: start})
+		}
+	}
+
+	tokens = append(tokens, filterToken{kind: tokenEnd, pos: len(expression)})
+
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser for filter expressions.
+type filterParser struct {
+	tokens     []filterToken
+	pos        int
+	depth      int
+	predicates int
+}
+
+// parseFilter parses a filter expression into a tree of filterNodes.
+//
+// Grammar:
+//
+//	expression = term { "OR" term }
+//	term       = factor { "AND" factor }
+//	factor     = "NOT" factor | "(" expression ")" | predicate
+//	predicate  = field ( "=" | "~=" ) value
+func parseFilter(expression string) (filterNode, error) {
+	if len(expression) > maxFilterLength {
+		return nil, fmt.Errorf("%w: expression longer than %d characters", errInvalidFilter, maxFilterLength)
+	}
+
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := filterParser{tokens: tokens}
+
+	node, err := parser.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := parser.peek(); token.kind != tokenEnd {
+		return nil, fmt.Errorf("%w: unexpected '%s' at position %d", errInvalidFilter, token.text, token.pos)
+	}
+
+	return node, nil
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEnd {
+		p.pos++
+	}
+
+	return token
+}
+
+// isKeyword checks if the next token is the given keyword (case-insensitive).
+func (p *filterParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == tokenWord && strings.EqualFold(token.text, keyword)
+}
+
+func (p *filterParser) parseExpression() (filterNode, error) {
+	node, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	children := orNode{node}
+	for p.isKeyword("OR") {
+		p.next()
+
+		node, err = p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+
+	return children, nil
+}
+
+func (p *filterParser) parseTerm() (filterNode, error) {
+	node, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	children := andNode{node}
+	for p.isKeyword("AND") {
+		p.next()
+
+		node, err = p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+
+	return children, nil
+}
+
+func (p *filterParser) parseFactor() (filterNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.depth > maxFilterDepth {
+		return nil, fmt.Errorf("%w: expression nested deeper than %d levels", errInvalidFilter, maxFilterDepth)
+	}
+
+	if p.isKeyword("NOT") {
+		p.next()
+
+		child, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{child: child}, nil
+	}
+
+	if p.peek().kind == tokenLeftParen {
+		p.next()
+
+		node, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		if token := p.next(); token.kind != tokenRightParen {
+			return nil, fmt.Errorf("%w: expected ')' at position %d", errInvalidFilter, token.pos)
+		}
+
+		return node, nil
+	}
+
+	return p.parsePredicate()
+}
+
+func (p *filterParser) parsePredicate() (filterNode, error) {
+	fieldToken := p.next()
+	if fieldToken.kind != tokenWord {
+		return nil, fmt.Errorf("%w: expected field name at position %d", errInvalidFilter, fieldToken.pos)
+	}
+
+	field := strings.ToLower(fieldToken.text)
+
+	builder, ok := filterFields[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field '%s' at position %d", errInvalidFilter, fieldToken.text, fieldToken.pos)
+	}
+
+	operatorToken := p.next()
+	if operatorToken.kind != tokenOperator {
+		return nil, fmt.Errorf("%w: expected operator after '%s' at position %d", errInvalidFilter, fieldToken.text, operatorToken.pos)
+	}
+
+	valueToken := p.next()
+	if valueToken.kind != tokenWord {
+		return nil, fmt.Errorf("%w: expected value after '%s%s' at position %d", errInvalidFilter, fieldToken.text, operatorToken.text, valueToken.pos)
+	}
+
+	p.predicates++
+	if p.predicates > maxFilterPredicates {
+		return nil, fmt.Errorf("%w: expression contains more than %d predicates", errInvalidFilter, maxFilterPredicates)
+	}
+
+	match, err := builder(operatorToken.text, valueToken.text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", errInvalidFilter, field, err.Error())
+	}
+
+	node := predicate{field: field, operator: operatorToken.text, value: valueToken.text, match: match}
+	if field == "domain" {
+		// The operator was already validated by the builder
+		node.matchDomains, _ = buildDomainCollector(operatorToken.text, valueToken.text)
+	}
+
+	return node, nil
+}
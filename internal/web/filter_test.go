@@ -0,0 +1,63 @@
+package web
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/certstream"
+)
+
+func TestFilterMatches(t *testing.T) {
+	entry := &certstream.Entry{}
+	entry.Data.LeafCert.AllDomains = []string{"login.bank.example", "www.example.org"}
+	entry.Data.LeafCert.CertType = "Multi"
+
+	tests := []struct {
+		expression string
+		matches    bool
+		rules      []string
+		domains    []string
+	}{
+		{expression: "domain~=bank", matches: true, rules: []string{"domain~=bank"}, domains: []string{"login.bank.example"}},
+		{expression: "domain~=bank AND cert_type=wildcard", matches: false},
+		// The rules and domains of an AND that didn't match must not be reported by the enclosing OR.
+		{
+			expression: "(domain~=bank AND cert_type=wildcard) OR domain~=example.org",
+			matches:    true,
+			rules:      []string{"domain~=example.org"},
+			domains:    []string{"www.example.org"},
+		},
+		{
+			expression: "domain~=bank OR domain~=example",
+			matches:    true,
+			rules:      []string{"domain~=bank", "domain~=example"},
+			domains:    []string{"login.bank.example", "www.example.org"},
+		},
+		{expression: "NOT domain~=shop AND cert_type=multi", matches: true, rules: []string{"NOT domain~=shop", "cert_type=multi"}},
+		{expression: "NOT domain~=bank", matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			filter, err := parseFilter(tt.expression)
+			if err != nil {
+				t.Fatalf("parseFilter() error = %s", err)
+			}
+
+			if got := filter.matches(entry, nil); got != tt.matches {
+				t.Errorf("matches(nil) = %t, want %t", got, tt.matches)
+			}
+
+			var match filterMatch
+			if got := filter.matches(entry, &match); got != tt.matches {
+				t.Errorf("matches() = %t, want %t", got, tt.matches)
+			}
+			if len(match.rules) != len(tt.rules) || len(tt.rules) > 0 && !reflect.DeepEqual(match.rules, tt.rules) {
+				t.Errorf("rules = %q, want %q", match.rules, tt.rules)
+			}
+			if len(match.domains) != len(tt.domains) || len(tt.domains) > 0 && !reflect.DeepEqual(match.domains, tt.domains) {
+				t.Errorf("domains = %q, want %q", match.domains, tt.domains)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Reasons for closed or rejected websocket connections used as metric labels.
+const (
+	closeReasonNormal         = "normal"
+	closeReasonTimeout        = "timeout"
+	closeReasonSlowClient     = "slow_client"
+	closeReasonError          = "error"
+	closeReasonShutdown       = "shutdown"
+	rejectReasonAuthFail      = "auth_fail"
+	rejectReasonInvalidOption = "invalid_options"
+	rejectReasonShutdown      = "shutdown"
+)
+
+// Actions for messages exceeding the maximum message size (webserver.oversized_action), also used as metric labels.
+const (
+	oversizedActionTrim = "trim"
+	oversizedActionSkip = "skip"
+)
+
+var (
+	// Number of websocket connections that were successfully upgraded.
+	openedConnections = metrics.NewCounter("certstreamservergo_websocket_connections_opened_total")
+
+	// Duration of websocket connections from the upgrade until the client was unregistered.
+	connectionDuration = metrics.NewHistogram("certstreamservergo_websocket_connection_duration_seconds")
+)
+
+// recordConnectionClosed updates the metrics for a websocket connection that was closed for the given reason.
+func recordConnectionClosed(reason string, connectedAt time.Time) {
+	metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_websocket_connections_closed_total{reason=%q}", reason)).Inc()
+	connectionDuration.UpdateDuration(connectedAt)
+}
+
+// recordConnectionRejected updates the metrics for a websocket connection that was rejected for the given reason.
+func recordConnectionRejected(reason string) {
+	metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_websocket_connections_rejected_total{reason=%q}", reason)).Inc()
+}
+
+// recordOversizedMessage counts a message that exceeded the maximum message size and was trimmed or skipped.
+func recordOversizedMessage(action string) {
+	metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_oversized_messages_total{action=%q}", action)).Inc()
+}
+
+// Results of delivering an entry to a subscription, used as metric labels.
+const (
+	deliveryResultDelivered = "delivered"
+	deliveryResultFiltered  = "filtered"
+	deliveryResultDropped   = "dropped"
+	// deliveryResultRateLimited entries were dropped because the client exceeded its rate limit.
+	deliveryResultRateLimited = "rate_limited"
+)
+
+// subscriptionCounters count the entries delivered to, filtered out for, dropped for a subscription because its
+// buffer was full and dropped due to its rate limit. The counters are shared by all clients with the same label and nil if subscription metrics are disabled.
+type subscriptionCounters struct {
+	delivered   *metrics.Counter
+	filtered    *metrics.Counter
+	dropped     *metrics.Counter
+	rateLimited *metrics.Counter
+}
+
+// newSubscriptionCounters returns the counters for the given client according to prometheus.subscription_labels:
+// "type" labels them by subscription type, "client" by the name of the client and "none" disables them.
+func newSubscriptionCounters(subType SubscriptionType, clientName string) subscriptionCounters {
+	var label string
+
+	switch config.AppConfig.Prometheus.SubscriptionLabels {
+	case "client":
+		label = fmt.Sprintf("client=%q", clientName)
+	case "type":
+		label = fmt.Sprintf("type=%q", subType.String())
+	default:
+		return subscriptionCounters{}
+	}
+
+	counter := func(result string) *metrics.Counter {
+		return metrics.GetOrCreateCounter(fmt.Sprintf("certstreamservergo_subscription_entries_total{%s,result=%q}", label, result))
+	}
+
+	return subscriptionCounters{
+		delivered:   counter(deliveryResultDelivered),
+		filtered:    counter(deliveryResultFiltered),
+		dropped:     counter(deliveryResultDropped),
+		rateLimited: counter(deliveryResultRateLimited),
+	}
+}
+
+// record counts a single entry with the given result.
+func (s subscriptionCounters) record(result string) {
+	var counter *metrics.Counter
+
+	switch result {
+	case deliveryResultDelivered:
+		counter = s.delivered
+	case deliveryResultFiltered:
+		counter = s.filtered
+	case deliveryResultDropped:
+		counter = s.dropped
+	case deliveryResultRateLimited:
+		counter = s.rateLimited
+	}
+
+	if counter != nil {
+		counter.Inc()
+	}
+}
+
+// unregisterClientCounters removes the subscription counters of a disconnected client, so that the number of metrics
+// doesn't grow with every connection. Counters labeled by type are kept.
+func unregisterClientCounters(clientName string) {
+	if config.AppConfig.Prometheus.SubscriptionLabels != "client" {
+		return
+	}
+
+	for _, result := range []string{deliveryResultDelivered, deliveryResultFiltered, deliveryResultDropped, deliveryResultRateLimited} {
+		metrics.UnregisterMetric(fmt.Sprintf("certstreamservergo_subscription_entries_total{client=%q,result=%q}", clientName, result))
+	}
+}
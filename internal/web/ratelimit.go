@@ -0,0 +1,77 @@
+package web
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// statsInterval is the interval in which rate limited clients receive a stats frame, if entries were dropped.
+const statsInterval = 10 * time.Second
+
+// tokenBucket limits the rate of entries sent to a client. The bucket holds up to one second worth of entries, so short
+// bursts are sent without delay. It is only used by the broadcaster and therefore not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full tokenBucket allowing rate entries per second.
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := max(rate, 1)
+
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// allow refills the bucket for the time passed since the last call and takes a token if one is available.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// effectiveRate returns the rate limit of a client that requested the given rate, bounded by the operator's maximum.
+// Zero means that the client is not rate limited.
+func effectiveRate(requested, maximum float64) float64 {
+	switch {
+	case requested <= 0:
+		return maximum
+	case maximum <= 0:
+		return requested
+	default:
+		return min(requested, maximum)
+	}
+}
+
+// statsFrame is sent to rate limited clients to report the number of entries dropped due to the rate limit.
+type statsFrame struct {
+	MessageType string         `json:"message_type"`
+	Data        statsFrameData `json:"data"`
+}
+
+type statsFrameData struct {
+	// RateLimited is the total number of entries dropped for the client since it connected.
+	RateLimited uint64  `json:"rate_limited"`
+	MaxRate     float64 `json:"max_rate"`
+}
+
+// encodeStatsFrame encodes a stats frame in the given wire format.
+func encodeStatsFrame(format string, rateLimited uint64, maxRate float64) ([]byte, error) {
+	frame := statsFrame{MessageType: "stats", Data: statsFrameData{RateLimited: rateLimited, MaxRate: maxRate}}
+
+	if format == formatCBOR {
+		return cbor.Marshal(frame)
+	}
+
+	return json.Marshal(frame)
+}
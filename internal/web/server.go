@@ -1,12 +1,18 @@
 package web
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -16,11 +22,18 @@ import (
 	"github.com/d-Rickyy-b/certstream-server-go/internal/config"
 
 	"github.com/gorilla/websocket"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
 	ClientHandler = BroadcastManager{}
 	upgrader      websocket.Upgrader
+
+	// ErrNotFound and ErrBadRequest can be wrapped by the errors of callbacks to respond with 404 or 400 respectively.
+	ErrNotFound   = errors.New("not found")
+	ErrBadRequest = errors.New("bad request")
 )
 
 type WebServer struct {
@@ -30,17 +43,98 @@ type WebServer struct {
 	server    *http.Server
 	certPath  string
 	keyPath   string
+	// basePath is prefixed to all routes of the server, e.g. "/certstream". It is empty for the root.
+	basePath string
+}
+
+// path returns the given url prefixed with the base path of the server.
+func (ws *WebServer) path(url string) string {
+	return ws.basePath + url
+}
+
+// normalizeBasePath makes sure that the base path starts with a slash and doesn't end with one.
+// The root ("/" or "") results in an empty base path.
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return ""
+	}
+
+	return "/" + basePath
 }
 
 // RegisterPrometheus registers a new handler that listens on the given url and calls the given function
 // in order to provide metrics for a prometheus server. This function signature was used, because VictoriaMetrics
 // offers exactly this function signature.
 func (ws *WebServer) RegisterPrometheus(url string, callback func(w io.Writer, exposeProcessMetrics bool)) {
-	ws.routes.HandleFunc(url, func(w http.ResponseWriter, r *http.Request) {
+	ws.routes.HandleFunc(ws.path(url), func(w http.ResponseWriter, r *http.Request) {
 		callback(w, config.AppConfig.Prometheus.ExposeSystemMetrics)
 	})
 }
 
+// RegisterSummary registers a new handler that listens on the given url and responds with the plain text
+// summary written by the given callback.
+func (ws *WebServer) RegisterSummary(url string, callback func(w io.Writer)) {
+	ws.routes.HandleFunc(ws.path(url), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		callback(w)
+	})
+}
+
+// RegisterStatus registers a new handler that listens on the given url and responds with the JSON encoded
+// return value of the given callback.
+func (ws *WebServer) RegisterStatus(url string, callback func() any) {
+	ws.routes.HandleFunc(ws.path(url), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(callback()); err != nil {
+			log.Println("Error while encoding status: ", err)
+		}
+	})
+}
+
+// RegisterInclusionProof registers a new handler that listens on the given url and responds with the JSON encoded
+// inclusion proof returned by the callback for the log and index given in the query parameters "log" and "index".
+// Errors of the log are reported with status 502.
+func (ws *WebServer) RegisterInclusionProof(url string, callback func(ctx context.Context, logURL string, index int64) (any, error)) {
+	ws.routes.HandleFunc(ws.path(url), func(w http.ResponseWriter, r *http.Request) {
+		logURL := r.URL.Query().Get("log")
+		index, parseErr := strconv.ParseInt(r.URL.Query().Get("index"), 10, 64)
+
+		if logURL == "" || parseErr != nil {
+			http.Error(w, "query parameters 'log' and 'index' are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+		defer cancel()
+
+		proof, err := callback(ctx, logURL, index)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrBadRequest):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, ErrNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			default:
+				log.Printf("Could not fetch inclusion proof for index %d of '%s': %s\n", index, logURL, err)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+			}
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if encodeErr := json.NewEncoder(w).Encode(proof); encodeErr != nil {
+			log.Println("Error while encoding inclusion proof: ", encodeErr)
+		}
+	})
+}
+
 // IPWhitelist returns a middleware that checks if the IP of the client is in the whitelist.
 func IPWhitelist(whitelist []string) func(next http.Handler) http.Handler {
 	// build a list of whitelisted IPs and CIDRs
@@ -97,6 +191,10 @@ func IPWhitelist(whitelist []string) func(next http.Handler) http.Handler {
 			}
 
 			log.Printf("IP %s not in whitelist, rejecting request\n", r.RemoteAddr)
+			if websocket.IsWebSocketUpgrade(r) {
+				recordConnectionRejected(rejectReasonAuthFail)
+			}
+
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		})
@@ -112,7 +210,7 @@ func initFullWebsocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setupClient(connection, SubTypeFull, r.RemoteAddr)
+	setupClient(connection, SubTypeFull, r.URL, r.RemoteAddr)
 }
 
 // initLiteWebsocket is called when a client connects to the / endpoint.
@@ -124,7 +222,7 @@ func initLiteWebsocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setupClient(connection, SubTypeLite, r.RemoteAddr)
+	setupClient(connection, SubTypeLite, r.URL, r.RemoteAddr)
 }
 
 // initDomainWebsocket is called when a client connects to the /domains-only endpoint.
@@ -136,7 +234,7 @@ func initDomainWebsocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setupClient(connection, SubTypeDomain, r.RemoteAddr)
+	setupClient(connection, SubTypeDomain, r.URL, r.RemoteAddr)
 }
 
 // upgradeConnection upgrades the connection to a websocket and returns the connection.
@@ -167,18 +265,60 @@ func upgradeConnection(w http.ResponseWriter, r *http.Request) (*websocket.Conn,
 }
 
 // setupClient initializes a client struct and starts the broadcastHandler and websocket listener.
-func setupClient(connection *websocket.Conn, subscriptionType SubscriptionType, name string) {
-	c := newClient(connection, subscriptionType, name, 300)
+// If the subscription options in the url are invalid, the connection is closed with the reason as close message.
+func setupClient(connection *websocket.Conn, subscriptionType SubscriptionType, requestURL *url.URL, name string) {
+	if ClientHandler.draining.Load() {
+		recordConnectionRejected(rejectReasonShutdown)
+		closeConnection(connection, websocket.CloseTryAgainLater, shutdownReason(config.AppConfig.Webserver.ShutdownDrain.ReconnectDelay))
+
+		return
+	}
+
+	options, optionsErr := parseSubscriptionOptions(requestURL)
+	if optionsErr != nil {
+		log.Printf("Rejecting client '%s' due to invalid subscription options: %s\n", name, optionsErr)
+		recordConnectionRejected(rejectReasonInvalidOption)
+		closeConnection(connection, websocket.ClosePolicyViolation, optionsErr.Error())
+
+		return
+	}
+
+	// The CBOR format can also be negotiated via the websocket subprotocol instead of the query parameter.
+	if connection.Subprotocol() == formatCBOR {
+		options.format = formatCBOR
+	}
+
+	openedConnections.Inc()
+
+	c := newClient(connection, subscriptionType, options, name, 300)
 	go c.broadcastHandler()
 	go c.listenWebsocket()
 
 	ClientHandler.registerClient(c)
 }
 
+// closeConnection sends a close message with the given code and reason to the client and closes the connection.
+func closeConnection(connection *websocket.Conn, code int, reason string) {
+	// Control frames are limited to 125 bytes, of which 2 bytes are taken by the close code.
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	closeMessage := websocket.FormatCloseMessage(code, reason)
+	_ = connection.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(5*time.Second))
+	_ = connection.Close()
+}
+
 // setupWebsocketRoutes configures all the routes necessary for the websocket webserver.
-func setupWebsocketRoutes(r *chi.Mux) {
+func setupWebsocketRoutes(r *chi.Mux, basePath string) {
 	r.Use(middleware.Recoverer)
-	r.Route("/", func(r chi.Router) {
+
+	root := basePath
+	if root == "" {
+		root = "/"
+	}
+
+	r.Route(root, func(r chi.Router) {
 		r.Route(config.AppConfig.Webserver.FullURL, func(r chi.Router) {
 			r.HandleFunc("/", initFullWebsocket)
 			r.HandleFunc("/example.json", exampleFull)
@@ -193,10 +333,15 @@ func setupWebsocketRoutes(r *chi.Mux) {
 			r.HandleFunc("/", initDomainWebsocket)
 			r.HandleFunc("/example.json", exampleDomains)
 		})
+
+		if analytics != nil {
+			r.Get(config.AppConfig.Webserver.Analytics.URL, analyticsHandler)
+		}
 	})
 }
 
-func (ws *WebServer) initServer() {
+// initServer creates the http.Server with the timeouts and HTTP/2 setting of the given server config.
+func (ws *WebServer) initServer(serverConfig config.ServerConfig) {
 	addr := fmt.Sprintf("%s:%d", ws.networkIf, ws.port)
 
 	tlsConfig := &tls.Config{
@@ -211,14 +356,39 @@ func (ws *WebServer) initServer() {
 		},
 	}
 
+	var handler http.Handler = ws.routes
+
+	// Over TLS, HTTP/2 is negotiated via ALPN by the http.Server itself. Without TLS, h2c offers HTTP/2 to clients with
+	// prior knowledge or an upgrade header. HTTP/1.1 requests - including websocket upgrades - are passed through as is.
+	enableHTTP2 := serverConfig.HTTP2 == nil || *serverConfig.HTTP2
+	useTLS := ws.certPath != "" && ws.keyPath != ""
+
+	if enableHTTP2 && !useTLS {
+		handler = h2c.NewHandler(ws.routes, &http2.Server{IdleTimeout: serverConfig.IdleTimeout})
+	}
+
+	if useTLS {
+		reloader, err := newCertReloader(ws.certPath, ws.keyPath, serverConfig.CertReloadInterval)
+		if err != nil {
+			log.Fatalf("Error while loading TLS certificate of webserver on %s: %s\n", addr, err)
+		}
+
+		tlsConfig.GetCertificate = reloader.GetCertificate
+	}
+
 	ws.server = &http.Server{
 		Addr:              addr,
-		Handler:           ws.routes,
+		Handler:           handler,
 		TLSConfig:         tlsConfig,
-		IdleTimeout:       time.Minute,
-		ReadTimeout:       10 * time.Second,
-		ReadHeaderTimeout: 2 * time.Second,
-		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       serverConfig.IdleTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+	}
+
+	if !enableHTTP2 {
+		// A non-nil, empty map disables the automatic HTTP/2 support of the http.Server.
+		ws.server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
 	}
 }
 
@@ -230,6 +400,7 @@ func NewMetricsServer(networkIf string, port int, certPath, keyPath string) *Web
 		routes:    chi.NewRouter(),
 		certPath:  certPath,
 		keyPath:   keyPath,
+		basePath:  normalizeBasePath(config.AppConfig.Prometheus.BasePath),
 	}
 	server.routes.Use(middleware.Recoverer)
 
@@ -242,7 +413,7 @@ func NewMetricsServer(networkIf string, port int, certPath, keyPath string) *Web
 		server.routes.Use(IPWhitelist(config.AppConfig.Prometheus.Whitelist))
 	}
 
-	server.initServer()
+	server.initServer(config.AppConfig.Prometheus.ServerConfig)
 
 	return server
 }
@@ -257,10 +428,12 @@ func NewWebsocketServer(networkIf string, port int, certPath, keyPath string) *W
 		routes:    chi.NewRouter(),
 		certPath:  certPath,
 		keyPath:   keyPath,
+		basePath:  normalizeBasePath(config.AppConfig.Webserver.BasePath),
 	}
 
 	upgrader = websocket.Upgrader{
 		EnableCompression: config.AppConfig.Webserver.CompressionEnabled,
+		Subprotocols:      []string{formatCBOR},
 	}
 
 	if config.AppConfig.Webserver.RealIP {
@@ -272,8 +445,12 @@ func NewWebsocketServer(networkIf string, port int, certPath, keyPath string) *W
 		server.routes.Use(IPWhitelist(config.AppConfig.Webserver.Whitelist))
 	}
 
-	setupWebsocketRoutes(server.routes)
-	server.initServer()
+	if analyticsConfig := config.AppConfig.Webserver.Analytics; analyticsConfig.Enabled {
+		analytics = newRollingCounters(analyticsConfig.Window, analyticsConfig.MaxDomains)
+	}
+
+	setupWebsocketRoutes(server.routes, server.basePath)
+	server.initServer(config.AppConfig.Webserver.ServerConfig)
 
 	ClientHandler.Broadcast = make(chan certstream.Entry, 10_000)
 	go ClientHandler.broadcaster()
@@ -288,7 +465,8 @@ func (ws *WebServer) Start() {
 
 	var err error
 	if ws.keyPath != "" && ws.certPath != "" {
-		err = ws.server.ListenAndServeTLS(ws.certPath, ws.keyPath)
+		// The certificate is provided by the certReloader via TLSConfig.GetCertificate
+		err = ws.server.ListenAndServeTLS("", "")
 	} else {
 		err = ws.server.ListenAndServe()
 	}